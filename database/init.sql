@@ -5,8 +5,109 @@ CREATE SCHEMA IF NOT EXISTS notifications_schema AUTHORIZATION postgres;
 CREATE TABLE IF NOT EXISTS notifications_schema.notification (
     id SERIAL PRIMARY KEY,
     key TEXT,
+    subject TEXT,
     message TEXT NOT NULL,
+    type TEXT NOT NULL DEFAULT 'Info',
     status TEXT NOT NULL,
     delivery_channel TEXT NOT NULL, 
+    user_id TEXT,
+    slack_channel TEXT,
+    destination TEXT,
+    provider TEXT,
+    provider_message_id TEXT,
+    provider_response_code INTEGER,
+    request_id TEXT,
+    resolved BOOLEAN NOT NULL DEFAULT FALSE,
+    deduplication_key TEXT,
+    duplicate_of INTEGER REFERENCES notifications_schema.notification (id),
+    attempt_count INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    last_error TEXT,
+    lease_owner TEXT,
+    lease_expires_at TIMESTAMP,
     created_at TIMESTAMP default current_timestamp
-)
\ No newline at end of file
+);
+
+CREATE INDEX IF NOT EXISTS notification_due_idx ON notifications_schema.notification (status, delivery_channel, next_attempt_at);
+CREATE INDEX IF NOT EXISTS notification_lease_idx ON notifications_schema.notification (status, lease_expires_at);
+CREATE INDEX IF NOT EXISTS notification_deduplication_idx ON notifications_schema.notification (deduplication_key, created_at);
+
+-- Publishes the id of every inserted pending notification, so all replicas of the service are woken up to send it
+CREATE OR REPLACE FUNCTION notifications_schema.notify_notification_created() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('notification_created', NEW.id::TEXT);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notification_created_trigger ON notifications_schema.notification;
+CREATE TRIGGER notification_created_trigger AFTER INSERT ON notifications_schema.notification
+    FOR EACH ROW WHEN (NEW.status = 'pending') EXECUTE FUNCTION notifications_schema.notify_notification_created();
+
+CREATE TABLE IF NOT EXISTS notifications_schema.inbox_item (
+    id SERIAL PRIMARY KEY,
+    notification_id INTEGER NOT NULL UNIQUE REFERENCES notifications_schema.notification (id),
+    user_id TEXT NOT NULL,
+    key TEXT,
+    message TEXT NOT NULL,
+    read_at TIMESTAMP,
+    archived_at TIMESTAMP,
+    created_at TIMESTAMP default current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS inbox_item_user_id_idx ON notifications_schema.inbox_item (user_id, archived_at, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS notifications_schema.slack_thread (
+    id SERIAL PRIMARY KEY,
+    destination TEXT NOT NULL DEFAULT 'default',
+    key TEXT NOT NULL,
+    channel TEXT NOT NULL,
+    channel_id TEXT NOT NULL,
+    ts TEXT NOT NULL,
+    created_at TIMESTAMP default current_timestamp,
+    UNIQUE (destination, key, channel)
+);
+
+CREATE TABLE IF NOT EXISTS notifications_schema.attachment (
+    id SERIAL PRIMARY KEY,
+    notification_id INTEGER NOT NULL REFERENCES notifications_schema.notification (id),
+    blob_id TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP default current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS attachment_notification_id_idx ON notifications_schema.attachment (notification_id);
+
+
+CREATE TABLE IF NOT EXISTS notifications_schema.dead_letter (
+    id SERIAL PRIMARY KEY,
+    notification_id INTEGER NOT NULL UNIQUE REFERENCES notifications_schema.notification (id),
+    key TEXT,
+    delivery_channel TEXT NOT NULL,
+    destination TEXT,
+    provider TEXT,
+    attempt_count INTEGER NOT NULL,
+    last_error TEXT,
+    provider_response_code INTEGER,
+    payload_content_type TEXT,
+    payload TEXT,
+    created_at TIMESTAMP default current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS dead_letter_created_at_idx ON notifications_schema.dead_letter (created_at);
+
+-- Every send of a notification to the provider of its delivery channel
+CREATE TABLE IF NOT EXISTS notifications_schema.delivery_attempt (
+    id SERIAL PRIMARY KEY,
+    notification_id INTEGER NOT NULL REFERENCES notifications_schema.notification (id),
+    attempt_number INTEGER NOT NULL,
+    provider TEXT,
+    started_at TIMESTAMP NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    outcome TEXT NOT NULL,
+    error TEXT,
+    provider_response_code INTEGER,
+    UNIQUE (notification_id, attempt_number)
+);
@@ -0,0 +1,33 @@
+package blobstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+const LocalStore = "local"
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore stores the content of attachments.
+// Blobs are immutable and referenced by the id returned when they are stored.
+type BlobStore interface {
+	// Put stores the content read from the reader and returns the id of the new blob and its size.
+	Put(content io.Reader) (string, int64, error)
+	// Open returns a reader of the content of the blob. The reader has to be closed by the caller.
+	Open(id string) (io.ReadCloser, error)
+	// Size returns the size of the blob in bytes.
+	Size(id string) (int64, error)
+	// Delete removes the blob.
+	Delete(id string) error
+}
+
+// NewBlobStore creates the blob store of the given kind.
+func NewBlobStore(kind string, localPath string) (BlobStore, error) {
+	switch kind {
+	case "", LocalStore:
+		return NewLocalBlobStore(localPath)
+	}
+	return nil, fmt.Errorf("unsupported blob store %q", kind)
+}
@@ -0,0 +1,108 @@
+package blobstore
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+const blobDirPermissions = 0750
+
+// LocalBlobStore keeps the blobs as files in a directory of the local filesystem.
+// The blobs are uploaded, referenced and sent by any replica, so the directory has to be shared by all of them.
+type LocalBlobStore struct {
+	dir string
+}
+
+// NewLocalBlobStore requires the directory to be configured; a default directory, e.g. under the temporary
+// directory, would be private to every replica.
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	if dir == "" {
+		return nil, errors.New("the local blob store requires a local_path shared by all replicas")
+	}
+
+	if err := os.MkdirAll(dir, blobDirPermissions); err != nil {
+		return nil, err
+	}
+
+	return &LocalBlobStore{dir: dir}, nil
+}
+
+// Put writes the content to a new file. The file is written under a temporary name
+// and renamed when complete, so a partially written blob is never visible.
+func (store *LocalBlobStore) Put(content io.Reader) (string, int64, error) {
+	id := uuid.New().String()
+
+	file, err := os.CreateTemp(store.dir, ".upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(file.Name())
+
+	size, err := io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := os.Rename(file.Name(), store.path(id)); err != nil {
+		return "", 0, err
+	}
+
+	return id, size, nil
+}
+
+func (store *LocalBlobStore) Open(id string) (io.ReadCloser, error) {
+	if !isValidId(id) {
+		return nil, ErrBlobNotFound
+	}
+
+	file, err := os.Open(store.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return file, err
+}
+
+func (store *LocalBlobStore) Size(id string) (int64, error) {
+	if !isValidId(id) {
+		return 0, ErrBlobNotFound
+	}
+
+	info, err := os.Stat(store.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, ErrBlobNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (store *LocalBlobStore) Delete(id string) error {
+	if !isValidId(id) {
+		return ErrBlobNotFound
+	}
+
+	err := os.Remove(store.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrBlobNotFound
+	}
+	return err
+}
+
+func (store *LocalBlobStore) path(id string) string {
+	return filepath.Join(store.dir, id)
+}
+
+// Only ids generated by the store are accepted, so an id can never point outside of the directory.
+func isValidId(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil
+}
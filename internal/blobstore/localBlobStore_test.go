@@ -0,0 +1,50 @@
+package blobstore_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalBlobStore_PutAndOpen(t *testing.T) {
+	store, err := blobstore.NewLocalBlobStore(t.TempDir())
+	require.NoError(t, err)
+
+	id, size, err := store.Put(strings.NewReader("settlement report"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(17), size)
+
+	storedSize, err := store.Size(id)
+	require.NoError(t, err)
+	assert.Equal(t, size, storedSize)
+
+	reader, err := store.Open(id)
+	require.NoError(t, err)
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "settlement report", string(content))
+}
+
+func TestLocalBlobStore_RequiresDirectory(t *testing.T) {
+	_, err := blobstore.NewLocalBlobStore("")
+	assert.Error(t, err)
+}
+
+func TestLocalBlobStore_UnknownOrInvalidId(t *testing.T) {
+	store, err := blobstore.NewLocalBlobStore(t.TempDir())
+	require.NoError(t, err)
+
+	_, err = store.Open("9b2f3a49-3f4e-4a8e-9d59-7f6f4a0f1a2b")
+	assert.ErrorIs(t, err, blobstore.ErrBlobNotFound)
+
+	_, err = store.Open("../../etc/passwd")
+	assert.ErrorIs(t, err, blobstore.ErrBlobNotFound)
+
+	_, err = store.Size("../secret")
+	assert.ErrorIs(t, err, blobstore.ErrBlobNotFound)
+}
@@ -0,0 +1,69 @@
+package blobstore
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// OverlayBlobStore keeps the new blobs in memory while the existing blobs are read from the base store,
+// which is never modified. It lets the content of attachments be used without storing it, e.g. for a preview.
+type OverlayBlobStore struct {
+	base  BlobStore
+	lock  sync.RWMutex
+	blobs map[string][]byte
+}
+
+func NewOverlayBlobStore(base BlobStore) *OverlayBlobStore {
+	return &OverlayBlobStore{base: base, blobs: make(map[string][]byte)}
+}
+
+func (store *OverlayBlobStore) Put(content io.Reader) (string, int64, error) {
+	blob, err := io.ReadAll(content)
+	if err != nil {
+		return "", 0, err
+	}
+
+	id := uuid.New().String()
+	store.lock.Lock()
+	store.blobs[id] = blob
+	store.lock.Unlock()
+
+	return id, int64(len(blob)), nil
+}
+
+func (store *OverlayBlobStore) Open(id string) (io.ReadCloser, error) {
+	if blob, present := store.blob(id); present {
+		return io.NopCloser(bytes.NewReader(blob)), nil
+	}
+	return store.base.Open(id)
+}
+
+func (store *OverlayBlobStore) Size(id string) (int64, error) {
+	if blob, present := store.blob(id); present {
+		return int64(len(blob)), nil
+	}
+	return store.base.Size(id)
+}
+
+// Delete removes a blob kept in memory; the blobs of the base store are not deleted.
+func (store *OverlayBlobStore) Delete(id string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if _, present := store.blobs[id]; !present {
+		return ErrBlobNotFound
+	}
+	delete(store.blobs, id)
+	return nil
+}
+
+func (store *OverlayBlobStore) blob(id string) ([]byte, bool) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	blob, present := store.blobs[id]
+	return blob, present
+}
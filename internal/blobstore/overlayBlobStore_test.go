@@ -0,0 +1,42 @@
+package blobstore_test
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverlayBlobStore_KeepsNewBlobsInMemory(t *testing.T) {
+	dir := t.TempDir()
+	base, err := blobstore.NewLocalBlobStore(dir)
+	require.NoError(t, err)
+	storedId, _, err := base.Put(strings.NewReader("stored report"))
+	require.NoError(t, err)
+
+	overlay := blobstore.NewOverlayBlobStore(base)
+	id, size, err := overlay.Put(strings.NewReader("settlement report"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(17), size)
+
+	for blobId, expected := range map[string]string{id: "settlement report", storedId: "stored report"} {
+		reader, err := overlay.Open(blobId)
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		assert.Equal(t, expected, string(content))
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	_, err = base.Size(id)
+	assert.ErrorIs(t, err, blobstore.ErrBlobNotFound)
+	assert.ErrorIs(t, overlay.Delete(storedId), blobstore.ErrBlobNotFound)
+}
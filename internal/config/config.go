@@ -4,7 +4,10 @@ import (
 	"embed"
 	"flag"
 	"fmt"
+	"math"
 	"os"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,18 +18,110 @@ const (
 	ErrExitStatus int = 2
 )
 
+// The retry policy of the channels for which none is configured.
+const (
+	defaultRetryBaseDelay   = 30 * time.Second
+	defaultRetryMultiplier  = 2
+	defaultRetryMaxDelay    = time.Hour
+	defaultRetryMaxAttempts = 5
+)
+
+// The worker pool of the channels for which none is configured.
+const (
+	defaultDeliveryConcurrency = 2
+	defaultDeliveryQueueSize   = 100
+)
+
+// The shutdown grace period when none is configured.
+const defaultShutdownGracePeriod = 20 * time.Second
+
+// The timeouts of the HTTP connections of the clients when none are configured.
+const (
+	defaultServerReadHeaderTimeout = 10 * time.Second
+	defaultServerReadTimeout       = time.Minute
+	defaultServerIdleTimeout       = time.Minute
+)
+
+// The circuit breaker of the channels for which none is configured.
+const (
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitCoolDown         = 30 * time.Second
+	defaultCircuitSuccessThreshold = 1
+)
+
 // Config represents the composition of yml settings.
 type Config struct {
 	Email struct {
-		From       string   `yaml:"from"`
-		Password   string   `yaml:"password"`
-		Recipients []string `yaml:"recipients"`
-		SmtpHost   string   `yaml:"smtp_host"`
-		SmtpPort   string   `yaml:"smtp_port"`
+		// The settings of the default destination.
+		EmailDestination `yaml:",inline"`
+		// Named destination profiles which could be targeted by the notifications.
+		Destinations map[string]EmailDestination `yaml:"destinations"`
+		// The profile used by the notifications which do not target one; defaults to 'default' - the settings above.
+		DefaultDestination string `yaml:"default_destination"`
 	} `yaml:"email"`
 	Slack struct {
-		WebhookUrl string `yaml:"webhook_url"`
+		// The settings of the default destination.
+		SlackDestination `yaml:",inline"`
+		// Named destination profiles which could be targeted by the notifications.
+		Destinations map[string]SlackDestination `yaml:"destinations"`
+		// The profile used by the notifications which do not target one; defaults to 'default' - the settings above.
+		DefaultDestination string `yaml:"default_destination"`
 	} `yaml:"slack"`
+	Queue struct {
+		// The message broker to which the notifications are published; only 'nats' (default) is supported.
+		Broker string `yaml:"broker"`
+		// The url of the broker, e.g. nats://localhost:4222; the Queue channel is disabled when it is empty.
+		Url      string `yaml:"url"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+		// The subject (or the exchange for brokers which route by exchanges) of the published notifications.
+		Subject string `yaml:"subject"`
+	} `yaml:"queue"`
+	Sink struct {
+		// stdout or file; the Sink channel is disabled when it is empty.
+		Output string `yaml:"output"`
+		// The file of the file output, which is rotated once it reaches the max size.
+		Path         string `yaml:"path"`
+		MaxSizeBytes int64  `yaml:"max_size_bytes"`
+		// The count of the rotated files which are kept.
+		MaxBackups int `yaml:"max_backups"`
+		// Routes the notifications of all delivery channels to the sink instead of the 3rd party services.
+		// Honored only in the development environments.
+		CaptureAllChannels bool `yaml:"capture_all_channels"`
+	} `yaml:"sink"`
+	Delivery struct {
+		// The time for which a replica claims the notifications which it sends. The claims are renewed while
+		// the notifications are queued or being sent, and the expired claims of a crashed replica are released.
+		LeaseDuration time.Duration `yaml:"lease_duration"`
+		// The period of the polling for the due notifications, e.g. the scheduled retries. The created notifications
+		// wake all replicas right away, unless the connection which listens for them is down; the polling then falls
+		// back to the fallback period until the connection is restored.
+		PollingInterval         time.Duration `yaml:"polling_interval"`
+		FallbackPollingInterval time.Duration `yaml:"fallback_polling_interval"`
+		// The settings of the channels which are not overridden per channel.
+		Defaults DeliverySettings `yaml:"defaults"`
+		// The settings per delivery channel, e.g. 'Email' or 'Slack'.
+		Channels map[string]DeliverySettings `yaml:"channels"`
+	} `yaml:"delivery"`
+	Deduplication struct {
+		// The time within which a pushed notification which repeats an earlier one is deduplicated; 0 disables
+		// the deduplication.
+		Window time.Duration `yaml:"window"`
+	} `yaml:"deduplication"`
+	DeadLetters struct {
+		// The size of the dead-letter queue from which an alert is logged for every new dead letter.
+		AlertThreshold int64 `yaml:"alert_threshold"`
+	} `yaml:"dead_letters"`
+	Attachments struct {
+		// The blob store for the content of the attachments; only 'local' is supported.
+		Store string `yaml:"store"`
+		// The directory of the 'local' store; required, as it has to be shared by all replicas.
+		LocalPath string `yaml:"local_path"`
+		// The maximum size of a single attachment in bytes.
+		MaxSizeBytes int64 `yaml:"max_size_bytes"`
+		// The media types which are accepted for attachments.
+		AllowedContentTypes []string `yaml:"allowed_content_types"`
+	} `yaml:"attachments"`
 	Database struct {
 		Dialect  string `yaml:"dialect"`
 		Host     string `yaml:"host"`
@@ -35,6 +130,240 @@ type Config struct {
 		Dbname   string `yaml:"dbname"`
 		Password string `yaml:"password"`
 	} `yaml:"database"`
+	Admin struct {
+		// The API keys which authorize the requests to the admin APIs. The keys could also be given by
+		// the ADMIN_API_KEYS environment variable; the admin APIs reject all requests when no key is set.
+		ApiKeys []string `yaml:"api_keys"`
+	} `yaml:"admin"`
+	Shutdown struct {
+		// The time for which a stopping replica finishes the requests in progress and sends the notifications which
+		// it has claimed, before it aborts them.
+		GracePeriod time.Duration `yaml:"grace_period"`
+	} `yaml:"shutdown"`
+	Server struct {
+		// The time for which the headers of a request are awaited, so a slow client does not hold its connection.
+		ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+		// The time for which a whole request, including its body, is awaited.
+		ReadTimeout time.Duration `yaml:"read_timeout"`
+		// The time for which an idle keep-alive connection is kept open for the next request.
+		IdleTimeout time.Duration `yaml:"idle_timeout"`
+	} `yaml:"server"`
+}
+
+// EmailDestination represents the sender and the recipients of emails together with the providers used to send them.
+type EmailDestination struct {
+	From       string   `yaml:"from"`
+	Recipients []string `yaml:"recipients"`
+	// The settings of the SMTP server; used as the only provider when no providers are listed.
+	SmtpSettings `yaml:",inline"`
+	// The providers through which the emails are sent, in the order in which they are tried.
+	// A send falls through to the next provider when a provider fails with a transient error.
+	Providers []EmailProvider `yaml:"providers"`
+	Dkim      struct {
+		// The signing domain; DKIM signing is disabled when it is empty.
+		Domain        string   `yaml:"domain"`
+		SignedHeaders []string `yaml:"signed_headers"`
+		// simple or relaxed (default).
+		HeaderCanonicalization string `yaml:"header_canonicalization"`
+		BodyCanonicalization   string `yaml:"body_canonicalization"`
+		// Multiple keys could be listed for key rotation; the key with the latest
+		// not_before which is not in the future is used for signing.
+		Keys []DkimKey `yaml:"keys"`
+	} `yaml:"dkim"`
+}
+
+// SmtpSettings represents the connection to an SMTP server.
+type SmtpSettings struct {
+	SmtpHost string `yaml:"smtp_host"`
+	SmtpPort string `yaml:"smtp_port"`
+	// The SMTP username; defaults to the sender address.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// none, starttls_optional (default), starttls_required or implicit.
+	TlsMode string `yaml:"tls_mode"`
+	// none, plain (default), login or cram-md5.
+	Auth               string `yaml:"auth"`
+	CaCertFile         string `yaml:"ca_cert_file"`
+	MaxIdleConnections int    `yaml:"max_idle_connections"`
+}
+
+// EmailProvider represents an SMTP server or an HTTP email API through which emails are sent.
+type EmailProvider struct {
+	// The name of the provider which is recorded on the delivered notifications.
+	Name string `yaml:"name"`
+	// smtp (default) or http_api.
+	Kind         string `yaml:"kind"`
+	SmtpSettings `yaml:",inline"`
+	// The endpoint and the key of the HTTP email API.
+	ApiUrl string `yaml:"api_url"`
+	ApiKey string `yaml:"api_key"`
+}
+
+// SlackDestination represents a Slack workspace and channel to which messages are posted.
+type SlackDestination struct {
+	// The connection to Slack; used as the only provider when no providers are listed.
+	SlackConnection `yaml:",inline"`
+	DefaultChannel  string `yaml:"default_channel"`
+	// The providers through which the messages are posted, in the order in which they are tried.
+	// A send falls through to the next provider when a provider fails with a transient error.
+	Providers []SlackProvider `yaml:"providers"`
+}
+
+// SlackConnection represents an incoming webhook or a bot of the Slack Web API.
+type SlackConnection struct {
+	WebhookUrl string `yaml:"webhook_url"`
+	// When a bot token is set, messages are posted over the Slack Web API instead of the webhook.
+	BotToken   string `yaml:"bot_token"`
+	ApiBaseUrl string `yaml:"api_base_url"`
+}
+
+// SlackProvider represents a named connection through which Slack messages are posted.
+type SlackProvider struct {
+	// The name of the provider which is recorded on the delivered notifications.
+	Name            string `yaml:"name"`
+	SlackConnection `yaml:",inline"`
+}
+
+// DeliverySettings represents how the notifications of a delivery channel are sent.
+type DeliverySettings struct {
+	// The deadline of a single send, including the fall through to the other providers.
+	Timeout time.Duration `yaml:"timeout"`
+	Retry   RetryPolicy   `yaml:"retry"`
+	// The count of the workers which send the notifications of the channel concurrently.
+	Concurrency int `yaml:"concurrency"`
+	// The capacity of the queue of the notifications waiting for a worker of the channel.
+	QueueSize int `yaml:"queue_size"`
+	// The limits of the sends of the whole channel and of each of its destinations, e.g. a Slack channel.
+	RateLimit            RateLimit              `yaml:"rate_limit"`
+	DestinationRateLimit RateLimit              `yaml:"destination_rate_limit"`
+	CircuitBreaker       CircuitBreakerSettings `yaml:"circuit_breaker"`
+}
+
+// CircuitBreakerSettings represents when the circuit of a delivery channel whose provider is down is opened,
+// which defers the sends of the channel, and when it is closed again.
+type CircuitBreakerSettings struct {
+	// The count of the consecutive transient failures which opens the circuit.
+	FailureThreshold int `yaml:"failure_threshold"`
+	// The time for which an open circuit defers the sends before it lets a trial send through.
+	CoolDown time.Duration `yaml:"cool_down"`
+	// The count of the consecutive successful trial sends which closes the half-open circuit.
+	SuccessThreshold int `yaml:"success_threshold"`
+}
+
+// RateLimit represents a token bucket which allows the given count of sends per period on average, with bursts
+// of up to the burst count of sends. The sends are not limited when the count is not set.
+type RateLimit struct {
+	Count int `yaml:"count"`
+	// The period of the count; a second when it is not set.
+	Period time.Duration `yaml:"period"`
+	// The count of the sends which could be made at once after an idle time; 1 when it is not set.
+	Burst int `yaml:"burst"`
+}
+
+// RetryPolicy represents the schedule of the retries of the notifications whose sends failed transiently.
+// The delay before a retry grows exponentially with the count of the attempts, up to the max delay.
+type RetryPolicy struct {
+	// The delay before the first retry.
+	BaseDelay time.Duration `yaml:"base_delay"`
+	// The factor by which the delay grows with every attempt.
+	Multiplier float64       `yaml:"multiplier"`
+	MaxDelay   time.Duration `yaml:"max_delay"`
+	// The count of the attempts, including the first one, after which the notification is dead-lettered.
+	MaxAttempts int `yaml:"max_attempts"`
+	// The fraction of the delay by which it is randomized, e.g. 0.2 for ±20%, so the retries of the notifications
+	// which failed together are spread out.
+	Jitter float64 `yaml:"jitter"`
+}
+
+// Delay returns the delay before the next attempt of a notification which has been attempted the given count
+// of times. The random value in [0, 1) selects the jitter.
+func (policy RetryPolicy) Delay(attempts int, random float64) time.Duration {
+	delay := float64(policy.BaseDelay) * math.Pow(policy.Multiplier, float64(max(attempts-1, 0)))
+	delay = math.Min(delay, float64(policy.MaxDelay))
+	delay *= 1 + policy.Jitter*(2*random-1)
+	return time.Duration(delay)
+}
+
+// AdminApiKeys returns the configured admin API keys together with the comma-separated keys
+// of the ADMIN_API_KEYS environment variable.
+func (config *Config) AdminApiKeys() []string {
+	var keys []string
+	for _, key := range append(config.Admin.ApiKeys, strings.Split(os.Getenv("ADMIN_API_KEYS"), ",")...) {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// ShutdownGracePeriod returns the configured shutdown grace period or the default one.
+func (config *Config) ShutdownGracePeriod() time.Duration {
+	return firstPositive(config.Shutdown.GracePeriod, defaultShutdownGracePeriod)
+}
+
+// ServerReadHeaderTimeout returns the configured timeout for the headers of a request or the default one.
+func (config *Config) ServerReadHeaderTimeout() time.Duration {
+	return firstPositive(config.Server.ReadHeaderTimeout, defaultServerReadHeaderTimeout)
+}
+
+// ServerReadTimeout returns the configured timeout for a whole request or the default one.
+func (config *Config) ServerReadTimeout() time.Duration {
+	return firstPositive(config.Server.ReadTimeout, defaultServerReadTimeout)
+}
+
+// ServerIdleTimeout returns the configured timeout of the idle keep-alive connections or the default one.
+func (config *Config) ServerIdleTimeout() time.Duration {
+	return firstPositive(config.Server.IdleTimeout, defaultServerIdleTimeout)
+}
+
+// ChannelDelivery returns the delivery settings of the channel; the settings which are not set
+// for the channel fall back to the defaults.
+func (config *Config) ChannelDelivery(deliveryChannel string) DeliverySettings {
+	settings := config.Delivery.Channels[deliveryChannel]
+	defaults := config.Delivery.Defaults
+	if settings.Timeout <= 0 {
+		settings.Timeout = defaults.Timeout
+	}
+	settings.Concurrency = firstPositive(settings.Concurrency, defaults.Concurrency, defaultDeliveryConcurrency)
+	settings.QueueSize = firstPositive(settings.QueueSize, defaults.QueueSize, defaultDeliveryQueueSize)
+	if settings.RateLimit.Count <= 0 {
+		settings.RateLimit = defaults.RateLimit
+	}
+	if settings.DestinationRateLimit.Count <= 0 {
+		settings.DestinationRateLimit = defaults.DestinationRateLimit
+	}
+
+	breaker := &settings.CircuitBreaker
+	breaker.FailureThreshold = firstPositive(
+		breaker.FailureThreshold, defaults.CircuitBreaker.FailureThreshold, defaultCircuitFailureThreshold)
+	breaker.CoolDown = firstPositive(breaker.CoolDown, defaults.CircuitBreaker.CoolDown, defaultCircuitCoolDown)
+	breaker.SuccessThreshold = firstPositive(
+		breaker.SuccessThreshold, defaults.CircuitBreaker.SuccessThreshold, defaultCircuitSuccessThreshold)
+
+	retry := &settings.Retry
+	retry.BaseDelay = firstPositive(retry.BaseDelay, defaults.Retry.BaseDelay, defaultRetryBaseDelay)
+	retry.Multiplier = firstPositive(retry.Multiplier, defaults.Retry.Multiplier, defaultRetryMultiplier)
+	retry.MaxDelay = firstPositive(retry.MaxDelay, defaults.Retry.MaxDelay, defaultRetryMaxDelay)
+	retry.MaxAttempts = firstPositive(retry.MaxAttempts, defaults.Retry.MaxAttempts, defaultRetryMaxAttempts)
+	retry.Jitter = firstPositive(retry.Jitter, defaults.Retry.Jitter)
+	return settings
+}
+
+// Returns the first of the values which is set, or zero when none is.
+func firstPositive[T int | float64 | time.Duration](values ...T) T {
+	for _, value := range values {
+		if value > 0 {
+			return value
+		}
+	}
+	return 0
+}
+
+// DkimKey represents a DKIM signing key published under the selector.
+type DkimKey struct {
+	Selector       string    `yaml:"selector"`
+	PrivateKeyFile string    `yaml:"private_key_file"`
+	NotBefore      time.Time `yaml:"not_before"`
 }
 
 type ServiceEnv struct {
@@ -3,4 +3,13 @@ package db
 const (
 	SCHEMA             string = "notifications_schema"
 	NOTIFICATION_TABLE string = "notification"
+	INBOX_ITEM_TABLE   string = "inbox_item"
+	SLACK_THREAD_TABLE string = "slack_thread"
+	ATTACHMENT_TABLE   string = "attachment"
+	DEAD_LETTER_TABLE  string = "dead_letter"
+	// The history of the sends of the notifications.
+	DELIVERY_ATTEMPT_TABLE string = "delivery_attempt"
 )
+
+// The Postgres channel on which the id of every inserted notification is published by a trigger.
+const NOTIFICATION_CREATED_CHANNEL string = "notification_created"
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	internal_logger "github.com/plyovchev/notifications-service/internal/logger"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 	"gorm.io/gorm/schema"
 )
@@ -30,9 +32,12 @@ type DbClient interface {
 	Delete(value interface{}) *gorm.DB
 	Where(query interface{}, args ...interface{}) *gorm.DB
 	Preload(column string, conditions ...interface{}) *gorm.DB
+	Omit(columns ...string) *gorm.DB
+	Clauses(conds ...clause.Expression) *gorm.DB
 	Scopes(funcs ...func(*gorm.DB) *gorm.DB) *gorm.DB
 	ScanRows(rows *sql.Rows, result interface{}) error
 	Transaction(fc func(tx DbClient) error) (err error)
+	WithContext(ctx context.Context) DbClient
 	Close() error
 	DropTableIfExists(value interface{}) error
 	AutoMigrate(value interface{}) error
@@ -67,7 +72,6 @@ const (
 )
 
 func connectDatabase(schemaName string, config *config.Config) (*gorm.DB, error) {
-	var dsn string
 	logger := logger.New(
 		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
 		logger.Config{
@@ -87,15 +91,18 @@ func connectDatabase(schemaName string, config *config.Config) (*gorm.DB, error)
 	}
 
 	if config.Database.Dialect == POSTGRES {
-		dsn = fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=disable",
-			config.Database.Host, config.Database.Port, config.Database.Username,
-			config.Database.Dbname, config.Database.Password)
-
-		return gorm.Open(postgres.Open(dsn), gormConfig)
+		return gorm.Open(postgres.Open(postgresDsn(config)), gormConfig)
 	}
 	return nil, errors.New("connection to the DB cannot be established")
 }
 
+// Returns the connection string of the configured Postgres database.
+func postgresDsn(config *config.Config) string {
+	return fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=disable",
+		config.Database.Host, config.Database.Port, config.Database.Username,
+		config.Database.Dbname, config.Database.Password)
+}
+
 // Model specify the model you would like to run db operations.
 func (rep *dbClient) Model(value interface{}) *gorm.DB {
 	return rep.db.Model(value)
@@ -156,6 +163,16 @@ func (rep *dbClient) Preload(column string, conditions ...interface{}) *gorm.DB
 	return rep.db.Preload(column, conditions...)
 }
 
+// Omit specify fields that you want to ignore when creating, updating and querying.
+func (rep *dbClient) Omit(columns ...string) *gorm.DB {
+	return rep.db.Omit(columns...)
+}
+
+// Clauses adds clauses to the statement, e.g. the ON CONFLICT clause of an insert.
+func (rep *dbClient) Clauses(conds ...clause.Expression) *gorm.DB {
+	return rep.db.Clauses(conds...)
+}
+
 // Scopes pass current database connection to arguments `func(*DB) *DB`,
 // which could be used to add conditions dynamically
 func (rep *dbClient) Scopes(funcs ...func(*gorm.DB) *gorm.DB) *gorm.DB {
@@ -183,6 +200,11 @@ func (rep *dbClient) AutoMigrate(value interface{}) error {
 	return rep.db.AutoMigrate(value)
 }
 
+// WithContext returns a client whose queries are cancelled together with the context.
+func (rep *dbClient) WithContext(ctx context.Context) DbClient {
+	return &dbClient{db: rep.db.WithContext(ctx)}
+}
+
 // Transaction start a transaction as a block.
 // If it is failed, will rollback and return error.
 // If it is sccuessed, will commit.
@@ -207,5 +229,5 @@ func (rep *dbClient) Transaction(fc func(tx DbClient) error) error {
 	}
 
 	panicked = false
-	return nil
+	return err
 }
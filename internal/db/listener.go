@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/plyovchev/notifications-service/internal/config"
+)
+
+// Listener receives the payloads which are published on a Postgres channel with pg_notify.
+type Listener struct {
+	config *config.Config
+}
+
+func NewListener(cfg *config.Config) *Listener {
+	return &Listener{config: cfg}
+}
+
+// Listen opens a dedicated connection to the database and LISTENs on the channel. The onListening callback is called
+// once the connection listens and onNotification is called with the payload of every received notification.
+// Listen blocks until the context is done or the connection is lost, and returns the error which ended it.
+func (listener *Listener) Listen(
+	ctx context.Context,
+	channel string,
+	onListening func(),
+	onNotification func(payload string),
+) error {
+	conn, err := pgx.Connect(ctx, postgresDsn(listener.config))
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return err
+	}
+	onListening()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		onNotification(notification.Payload)
+	}
+}
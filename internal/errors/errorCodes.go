@@ -5,4 +5,15 @@ const UnexpectedErrorMessage = "unexpected Error occurred, please try again late
 const (
 	PushNotificationInvalidParams = "push_notification_invalid_params"
 	FailedToInsertInDb            = "failed_to_insert_in_db"
+	FailedToQueryDb               = "failed_to_query_db"
+	FailedToUpdateDb              = "failed_to_update_db"
+	InboxInvalidParams            = "inbox_invalid_params"
+	InboxItemNotFound             = "inbox_item_not_found"
+	InvalidAttachment             = "invalid_attachment"
+	FailedToStoreAttachment       = "failed_to_store_attachment"
+	NotificationInvalidParams     = "notification_invalid_params"
+	NotificationNotFound          = "notification_not_found"
+	DeadLetterInvalidParams       = "dead_letter_invalid_params"
+	DeadLetterNotFound            = "dead_letter_not_found"
+	Unauthorized                  = "unauthorized"
 )
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	goerrors "errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/plyovchev/notifications-service/internal/errors"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/external"
+	"github.com/plyovchev/notifications-service/internal/services"
+)
+
+// Logs the API error together with its cause and aborts the request with it.
+func abortWithAPIError(ginContext *gin.Context, lgr *logger.AppLogger, apiErr *external.APIError, cause error) {
+	lgr.Error().
+		Err(cause).
+		Int("HttpStatusCode", apiErr.HTTPStatusCode).
+		Str("ErrorCode", apiErr.ErrorCode).
+		Msg(apiErr.Message)
+
+	ginContext.AbortWithStatusJSON(apiErr.HTTPStatusCode, apiErr)
+}
+
+func dbQueryAPIError(requestId string) *external.APIError {
+	return &external.APIError{
+		HTTPStatusCode: http.StatusInternalServerError,
+		ErrorCode:      errors.FailedToQueryDb,
+		Message:        "Failed to query the database.",
+		DebugID:        requestId,
+	}
+}
+
+func dbUpdateAPIError(requestId string) *external.APIError {
+	return &external.APIError{
+		HTTPStatusCode: http.StatusInternalServerError,
+		ErrorCode:      errors.FailedToUpdateDb,
+		Message:        "Failed to update a record in the database.",
+		DebugID:        requestId,
+	}
+}
+
+// Maps an error of the attachments service to an API error; invalid attachments are reported as bad requests.
+func attachmentAPIError(err error, requestId string) *external.APIError {
+	var attachmentErr *services.AttachmentError
+	if goerrors.As(err, &attachmentErr) {
+		return &external.APIError{
+			HTTPStatusCode: http.StatusBadRequest,
+			ErrorCode:      errors.InvalidAttachment,
+			Message:        attachmentErr.Message,
+			DebugID:        requestId,
+		}
+	}
+
+	return &external.APIError{
+		HTTPStatusCode: http.StatusInternalServerError,
+		ErrorCode:      errors.FailedToStoreAttachment,
+		Message:        "Failed to store the attachment.",
+		DebugID:        requestId,
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/services"
+)
+
+type AttachmentsHandler struct {
+	attachmentsService services.AttachmentsService
+	logger             *logger.AppLogger
+}
+
+func NewAttachmentsHandler(attachmentsService services.AttachmentsService, logger *logger.AppLogger) *AttachmentsHandler {
+	return &AttachmentsHandler{
+		attachmentsService: attachmentsService,
+		logger:             logger,
+	}
+}
+
+// Handles an upload of the content of an attachment. Expects a HTTP POST request.
+// The body of the request is the raw content and the Content-Type header its media type.
+// The returned blobId could be referenced by the attachments of notifications.
+func (handler *AttachmentsHandler) Upload(ginContext *gin.Context) {
+	lgr, requestId := handler.logger.WithReqID(ginContext)
+
+	uploadedBlob, err := handler.attachmentsService.Upload(ginContext.Request.Body, ginContext.ContentType())
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, attachmentAPIError(err, requestId), err)
+		return
+	}
+
+	ginContext.JSON(http.StatusCreated, uploadedBlob)
+}
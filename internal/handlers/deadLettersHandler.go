@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/plyovchev/notifications-service/internal/errors"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/models/external"
+	"github.com/plyovchev/notifications-service/internal/repositories"
+	"github.com/plyovchev/notifications-service/internal/services"
+)
+
+const (
+	defaultDeadLetterPageSize = 20
+	maxDeadLetterPageSize     = 100
+)
+
+type DeadLettersHandler struct {
+	deadLetterQueue     services.DeadLetterQueue
+	notificationService services.NotificationsService
+	logger              *logger.AppLogger
+}
+
+func NewDeadLettersHandler(
+	deadLetterQueue services.DeadLetterQueue,
+	notificationService services.NotificationsService,
+	logger *logger.AppLogger,
+) *DeadLettersHandler {
+	return &DeadLettersHandler{
+		deadLetterQueue:     deadLetterQueue,
+		notificationService: notificationService,
+		logger:              logger,
+	}
+}
+
+// Handles a request for the dead letters. Expects a HTTP GET request.
+// The optional query params 'channel', 'key', 'destination', 'from' and 'to' (RFC 3339 times) filter the dead letters,
+// while 'page' (starting from 1) and 'pageSize' control the pagination. The dead letters are listed oldest first.
+func (handler *DeadLettersHandler) ListDeadLetters(ginContext *gin.Context) {
+	lgr, requestId := handler.logger.WithReqID(ginContext)
+
+	filter, filterErr := bindDeadLetterFilter(ginContext)
+	page, pageErr := parsePositiveIntQuery(ginContext, "page", 1)
+	pageSize, pageSizeErr := parsePositiveIntQuery(ginContext, "pageSize", defaultDeadLetterPageSize)
+	if filterErr != nil || pageErr != nil || pageSizeErr != nil || pageSize > maxDeadLetterPageSize {
+		abortWithAPIError(ginContext, lgr, deadLetterParamsAPIError("Invalid dead letter filter or pagination params", requestId), filterErr)
+		return
+	}
+
+	deadLetters, total, err := handler.deadLetterQueue.List(filter, (page-1)*pageSize, pageSize)
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, dbQueryAPIError(requestId), err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, external.DeadLetterPage{
+		Items:    *deadLetters,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	})
+}
+
+// Handles a request for a dead letter together with its notification. Expects a HTTP GET request.
+func (handler *DeadLettersHandler) GetDeadLetter(ginContext *gin.Context) {
+	lgr, requestId := handler.logger.WithReqID(ginContext)
+
+	id, ok := deadLetterId(ginContext, lgr, requestId)
+	if !ok {
+		return
+	}
+
+	deadLetter, err := handler.deadLetterQueue.Get(id)
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, dbQueryAPIError(requestId), err)
+		return
+	}
+	if deadLetter == nil {
+		abortWithAPIError(ginContext, lgr, deadLetterNotFoundAPIError(requestId), nil)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, deadLetter)
+}
+
+// Handles a request for replaying a dead letter. Expects a HTTP POST request.
+func (handler *DeadLettersHandler) ReplayDeadLetter(ginContext *gin.Context) {
+	lgr, requestId := handler.logger.WithReqID(ginContext)
+
+	id, ok := deadLetterId(ginContext, lgr, requestId)
+	if !ok {
+		return
+	}
+
+	handler.replay(ginContext, lgr, requestId, repositories.DeadLetterFilter{Ids: []int{id}}, true)
+}
+
+// Handles a request for replaying the dead letters selected by the filter query params of ListDeadLetters;
+// all dead letters are replayed only when no filter is given and 'all=true' is. Expects a HTTP POST request.
+func (handler *DeadLettersHandler) ReplayDeadLetters(ginContext *gin.Context) {
+	lgr, requestId := handler.logger.WithReqID(ginContext)
+
+	filter, ok := bindBulkDeadLetterFilter(ginContext, lgr, requestId)
+	if !ok {
+		return
+	}
+
+	handler.replay(ginContext, lgr, requestId, filter, false)
+}
+
+// Handles a request for purging a dead letter. Expects a HTTP DELETE request.
+func (handler *DeadLettersHandler) PurgeDeadLetter(ginContext *gin.Context) {
+	lgr, requestId := handler.logger.WithReqID(ginContext)
+
+	id, ok := deadLetterId(ginContext, lgr, requestId)
+	if !ok {
+		return
+	}
+
+	purged, err := handler.deadLetterQueue.Purge(repositories.DeadLetterFilter{Ids: []int{id}})
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, dbUpdateAPIError(requestId), err)
+		return
+	}
+	if purged == 0 {
+		abortWithAPIError(ginContext, lgr, deadLetterNotFoundAPIError(requestId), nil)
+		return
+	}
+
+	ginContext.Status(http.StatusNoContent)
+}
+
+// Handles a request for purging the dead letters selected by the filter query params of ListDeadLetters;
+// all dead letters are purged only when no filter is given and 'all=true' is. Expects a HTTP DELETE request.
+func (handler *DeadLettersHandler) PurgeDeadLetters(ginContext *gin.Context) {
+	lgr, requestId := handler.logger.WithReqID(ginContext)
+
+	filter, ok := bindBulkDeadLetterFilter(ginContext, lgr, requestId)
+	if !ok {
+		return
+	}
+
+	purged, err := handler.deadLetterQueue.Purge(filter)
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, dbUpdateAPIError(requestId), err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, external.PurgeResult{Purged: purged})
+}
+
+// Replays the selected dead letters and wakes the notification service to send their notifications.
+// A missing single dead letter is reported as not found.
+func (handler *DeadLettersHandler) replay(
+	ginContext *gin.Context,
+	lgr *logger.AppLogger,
+	requestId string,
+	filter repositories.DeadLetterFilter,
+	single bool,
+) {
+	notificationIds, err := handler.deadLetterQueue.Replay(filter)
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, dbUpdateAPIError(requestId), err)
+		return
+	}
+	if single && len(notificationIds) == 0 {
+		abortWithAPIError(ginContext, lgr, deadLetterNotFoundAPIError(requestId), nil)
+		return
+	}
+
+	if len(notificationIds) > 0 {
+		handler.notificationService.OnNotificationsReceived(notificationIds)
+	}
+
+	ginContext.JSON(http.StatusOK, external.ReplayResult{NotificationIds: notificationIds})
+}
+
+// Parses the filter of the dead letters from the query params.
+func bindDeadLetterFilter(ginContext *gin.Context) (repositories.DeadLetterFilter, error) {
+	filter := repositories.DeadLetterFilter{
+		DeliveryChannel: data.DeliveryChannel(ginContext.Query("channel")),
+		Key:             ginContext.Query("key"),
+		Destination:     ginContext.Query("destination"),
+	}
+
+	for name, value := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if param, present := ginContext.GetQuery(name); present {
+			parsed, err := time.Parse(time.RFC3339, param)
+			if err != nil {
+				return filter, err
+			}
+			*value = parsed
+		}
+	}
+	return filter, nil
+}
+
+// Parses the filter of a bulk replay or purge. A request without a filter has to confirm that it selects all dead
+// letters by 'all=true', so a bare request does not empty the whole queue. Aborts the request with 400 Bad Request
+// and returns false when the filter is invalid or missing.
+func bindBulkDeadLetterFilter(
+	ginContext *gin.Context,
+	lgr *logger.AppLogger,
+	requestId string,
+) (repositories.DeadLetterFilter, bool) {
+	filter, err := bindDeadLetterFilter(ginContext)
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, deadLetterParamsAPIError("Invalid dead letter filter params", requestId), err)
+		return filter, false
+	}
+
+	all, err := strconv.ParseBool(ginContext.DefaultQuery("all", "false"))
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, deadLetterParamsAPIError("Invalid 'all' param", requestId), err)
+		return filter, false
+	}
+	if filter.IsEmpty() && !all {
+		abortWithAPIError(ginContext, lgr, deadLetterParamsAPIError(
+			"Select the dead letters by a filter or confirm all of them with 'all=true'", requestId), nil)
+		return filter, false
+	}
+	return filter, true
+}
+
+// Parses the 'id' path param. Aborts the request with 400 Bad Request and returns false when it is invalid.
+func deadLetterId(ginContext *gin.Context, lgr *logger.AppLogger, requestId string) (int, bool) {
+	id, err := strconv.Atoi(ginContext.Param("id"))
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, deadLetterParamsAPIError("Invalid dead letter id", requestId), err)
+		return 0, false
+	}
+	return id, true
+}
+
+func deadLetterParamsAPIError(message string, requestId string) *external.APIError {
+	return &external.APIError{
+		HTTPStatusCode: http.StatusBadRequest,
+		ErrorCode:      errors.DeadLetterInvalidParams,
+		Message:        message,
+		DebugID:        requestId,
+	}
+}
+
+func deadLetterNotFoundAPIError(requestId string) *external.APIError {
+	return &external.APIError{
+		HTTPStatusCode: http.StatusNotFound,
+		ErrorCode:      errors.DeadLetterNotFound,
+		Message:        "Dead letter not found",
+		DebugID:        requestId,
+	}
+}
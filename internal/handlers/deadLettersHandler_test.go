@@ -0,0 +1,200 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/handlers"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/models/external"
+	"github.com/plyovchev/notifications-service/internal/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A dead-letter queue which keeps the dead letters in memory.
+type fakeDeadLetterQueue struct {
+	deadLetters []data.DeadLetter
+}
+
+func (queue *fakeDeadLetterQueue) Add(context.Context, *data.Notification) error {
+	return nil
+}
+
+func (queue *fakeDeadLetterQueue) List(filter repositories.DeadLetterFilter, offset int, limit int) (*[]data.DeadLetter, int64, error) {
+	selected := queue.selected(filter)
+	page := []data.DeadLetter{}
+	for i := offset; i < len(selected) && i < offset+limit; i++ {
+		page = append(page, selected[i])
+	}
+	return &page, int64(len(selected)), nil
+}
+
+func (queue *fakeDeadLetterQueue) Get(id int) (*data.DeadLetter, error) {
+	for _, deadLetter := range queue.deadLetters {
+		if deadLetter.Id == id {
+			return &deadLetter, nil
+		}
+	}
+	return nil, nil
+}
+
+func (queue *fakeDeadLetterQueue) Replay(filter repositories.DeadLetterFilter) ([]int, error) {
+	var notificationIds []int
+	for _, deadLetter := range queue.remove(filter) {
+		notificationIds = append(notificationIds, deadLetter.NotificationId)
+	}
+	return notificationIds, nil
+}
+
+func (queue *fakeDeadLetterQueue) Purge(filter repositories.DeadLetterFilter) (int64, error) {
+	return int64(len(queue.remove(filter))), nil
+}
+
+func (queue *fakeDeadLetterQueue) selected(filter repositories.DeadLetterFilter) []data.DeadLetter {
+	var selected []data.DeadLetter
+	for _, deadLetter := range queue.deadLetters {
+		if (len(filter.Ids) == 0 || slices.Contains(filter.Ids, deadLetter.Id)) &&
+			(filter.DeliveryChannel == "" || filter.DeliveryChannel == deadLetter.DeliveryChannel) &&
+			(filter.From.IsZero() || !deadLetter.CreatedAt.Before(filter.From)) {
+			selected = append(selected, deadLetter)
+		}
+	}
+	return selected
+}
+
+func (queue *fakeDeadLetterQueue) remove(filter repositories.DeadLetterFilter) []data.DeadLetter {
+	selected := queue.selected(filter)
+	queue.deadLetters = slices.DeleteFunc(queue.deadLetters, func(deadLetter data.DeadLetter) bool {
+		return slices.ContainsFunc(selected, func(removed data.DeadLetter) bool { return removed.Id == deadLetter.Id })
+	})
+	return selected
+}
+
+func newDeadLettersRouter() (*gin.Engine, *fakeDeadLetterQueue, *fakeNotificationsService) {
+	gin.SetMode(gin.TestMode)
+	lgr := logger.Setup(config.ServiceEnv{Name: "test"})
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	queue := &fakeDeadLetterQueue{deadLetters: []data.DeadLetter{
+		{Id: 1, NotificationId: 11, DeliveryChannel: data.Slack, CreatedAt: createdAt},
+		{Id: 2, NotificationId: 12, DeliveryChannel: data.Email, CreatedAt: createdAt.Add(time.Hour)},
+		{Id: 3, NotificationId: 13, DeliveryChannel: data.Slack, CreatedAt: createdAt.Add(2 * time.Hour)},
+	}}
+	notificationService := &fakeNotificationsService{}
+	handler := handlers.NewDeadLettersHandler(queue, notificationService, lgr)
+
+	router := gin.New()
+	router.GET("/dead-letters", handler.ListDeadLetters)
+	router.GET("/dead-letters/:id", handler.GetDeadLetter)
+	router.POST("/dead-letters/replay", handler.ReplayDeadLetters)
+	router.POST("/dead-letters/:id/replay", handler.ReplayDeadLetter)
+	router.DELETE("/dead-letters", handler.PurgeDeadLetters)
+	router.DELETE("/dead-letters/:id", handler.PurgeDeadLetter)
+	return router, queue, notificationService
+}
+
+func TestDeadLettersHandler_ListDeadLetters_Filters(t *testing.T) {
+	router, _, _ := newDeadLettersRouter()
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/dead-letters?channel=Slack&from=2024-05-01T13:00:00Z", nil)
+	router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var page external.DeadLetterPage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &page))
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, 3, page.Items[0].Id)
+	assert.Equal(t, int64(1), page.Total)
+}
+
+func TestDeadLettersHandler_InvalidParams(t *testing.T) {
+	router, _, _ := newDeadLettersRouter()
+
+	for _, target := range []string{"/dead-letters?from=yesterday", "/dead-letters?pageSize=1000", "/dead-letters/abc"} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, target)
+	}
+}
+
+func TestDeadLettersHandler_ReplayDeadLetters_WakesNotificationService(t *testing.T) {
+	router, queue, notificationService := newDeadLettersRouter()
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/dead-letters/replay?channel=Slack", nil)
+	router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var result external.ReplayResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(t, []int{11, 13}, result.NotificationIds)
+	assert.Equal(t, []int{11, 13}, notificationService.receivedIds)
+	assert.Len(t, queue.deadLetters, 1)
+}
+
+func TestDeadLettersHandler_BulkOperationsRequireFilterOrAll(t *testing.T) {
+	for _, method := range []string{http.MethodPost, http.MethodDelete} {
+		t.Run(method, func(t *testing.T) {
+			router, queue, _ := newDeadLettersRouter()
+			target := "/dead-letters"
+			if method == http.MethodPost {
+				target += "/replay"
+			}
+
+			for _, query := range []string{"", "?all=false", "?all=maybe"} {
+				recorder := httptest.NewRecorder()
+				req, _ := http.NewRequest(method, target+query, nil)
+				router.ServeHTTP(recorder, req)
+
+				assert.Equal(t, http.StatusBadRequest, recorder.Code, query)
+				assert.Len(t, queue.deadLetters, 3, query)
+			}
+
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest(method, target+"?all=true", nil)
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Empty(t, queue.deadLetters)
+		})
+	}
+}
+
+func TestDeadLettersHandler_SingleDeadLetterNotFound(t *testing.T) {
+	router, _, notificationService := newDeadLettersRouter()
+
+	for _, method := range []string{http.MethodPost, http.MethodDelete} {
+		target := "/dead-letters/42"
+		if method == http.MethodPost {
+			target += "/replay"
+		}
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, target, nil)
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusNotFound, recorder.Code, method)
+	}
+	assert.Empty(t, notificationService.receivedIds)
+}
+
+func TestDeadLettersHandler_PurgeDeadLetter(t *testing.T) {
+	router, queue, _ := newDeadLettersRouter()
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodDelete, "/dead-letters/2", nil)
+	router.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Len(t, queue.deadLetters, 2)
+}
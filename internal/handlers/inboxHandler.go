@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/errors"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/external"
+	"github.com/plyovchev/notifications-service/internal/repositories"
+)
+
+const (
+	defaultInboxPageSize = 20
+	maxInboxPageSize     = 100
+)
+
+type InboxHandler struct {
+	config          *config.Config
+	inboxRepository repositories.InboxRepository
+	logger          *logger.AppLogger
+}
+
+func NewInboxHandler(
+	cfg *config.Config,
+	inboxRepository repositories.InboxRepository,
+	logger *logger.AppLogger,
+) *InboxHandler {
+	return &InboxHandler{
+		config:          cfg,
+		inboxRepository: inboxRepository,
+		logger:          logger,
+	}
+}
+
+// Handles a request for the inbox of a user. Expects a HTTP GET request.
+// The optional query params 'page' (starting from 1) and 'pageSize' control the pagination.
+// The response contains the non-archived items of the inbox, newest first, and the unread count.
+func (handler *InboxHandler) GetInbox(ginContext *gin.Context) {
+	lgr, requestId := handler.logger.WithReqID(ginContext)
+	userId := ginContext.Param("userId")
+
+	page, pageErr := parsePositiveIntQuery(ginContext, "page", 1)
+	pageSize, pageSizeErr := parsePositiveIntQuery(ginContext, "pageSize", defaultInboxPageSize)
+	if pageErr != nil || pageSizeErr != nil || pageSize > maxInboxPageSize {
+		abortWithAPIError(ginContext, lgr, &external.APIError{
+			HTTPStatusCode: http.StatusBadRequest,
+			ErrorCode:      errors.InboxInvalidParams,
+			Message:        "Invalid inbox pagination params",
+			DebugID:        requestId,
+		}, nil)
+		return
+	}
+
+	items, total, err := handler.inboxRepository.FindAllByUserId(userId, (page-1)*pageSize, pageSize)
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, dbQueryAPIError(requestId), err)
+		return
+	}
+
+	unreadCount, err := handler.inboxRepository.CountUnread(userId)
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, dbQueryAPIError(requestId), err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, external.InboxPage{
+		Items:       *items,
+		Page:        page,
+		PageSize:    pageSize,
+		Total:       total,
+		UnreadCount: unreadCount,
+	})
+}
+
+// Handles a request for marking an inbox item as read. Expects a HTTP POST request.
+func (handler *InboxHandler) MarkRead(ginContext *gin.Context) {
+	handler.updateItem(ginContext, handler.inboxRepository.MarkRead)
+}
+
+// Handles a request for archiving an inbox item. Expects a HTTP POST request.
+func (handler *InboxHandler) Archive(ginContext *gin.Context) {
+	handler.updateItem(ginContext, handler.inboxRepository.Archive)
+}
+
+// Handles a request for marking all inbox items of a user as read. Expects a HTTP POST request.
+func (handler *InboxHandler) MarkAllRead(ginContext *gin.Context) {
+	lgr, requestId := handler.logger.WithReqID(ginContext)
+
+	updated, err := handler.inboxRepository.MarkAllRead(ginContext.Param("userId"))
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, dbUpdateAPIError(requestId), err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, external.MarkAllReadResult{Updated: updated})
+}
+
+// Applies the update to the inbox item specified by the 'userId' and 'itemId' path params.
+func (handler *InboxHandler) updateItem(
+	ginContext *gin.Context,
+	update func(userId string, itemId int) (bool, error),
+) {
+	lgr, requestId := handler.logger.WithReqID(ginContext)
+
+	itemId, err := strconv.Atoi(ginContext.Param("itemId"))
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, &external.APIError{
+			HTTPStatusCode: http.StatusBadRequest,
+			ErrorCode:      errors.InboxInvalidParams,
+			Message:        "Invalid inbox item id",
+			DebugID:        requestId,
+		}, err)
+		return
+	}
+
+	found, err := update(ginContext.Param("userId"), itemId)
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, dbUpdateAPIError(requestId), err)
+		return
+	}
+
+	if !found {
+		abortWithAPIError(ginContext, lgr, &external.APIError{
+			HTTPStatusCode: http.StatusNotFound,
+			ErrorCode:      errors.InboxItemNotFound,
+			Message:        "Inbox item not found",
+			DebugID:        requestId,
+		}, nil)
+		return
+	}
+
+	ginContext.Status(http.StatusNoContent)
+}
+
+// Parses the query param as a positive integer. Returns the default value if the param is missing.
+func parsePositiveIntQuery(ginContext *gin.Context, name string, defaultValue int) (int, error) {
+	value, present := ginContext.GetQuery(name)
+	if !present {
+		return defaultValue, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if parsed < 1 {
+		return 0, strconv.ErrRange
+	}
+	return parsed, nil
+}
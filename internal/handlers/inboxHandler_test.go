@@ -0,0 +1,217 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/handlers"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/models/external"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeInboxRepository struct {
+	items []data.InboxItem
+}
+
+func (repository *fakeInboxRepository) Deliver(_ context.Context, notification *data.Notification) (*data.InboxItem, error) {
+	item := data.NewInboxItem(notification)
+	item.Id = len(repository.items) + 1
+	repository.items = append(repository.items, *item)
+	return item, nil
+}
+
+func (repository *fakeInboxRepository) FindAllByUserId(userId string, offset int, limit int) (*[]data.InboxItem, int64, error) {
+	var userItems []data.InboxItem
+	for _, item := range repository.items {
+		if item.UserId == userId && item.ArchivedAt == nil {
+			userItems = append(userItems, item)
+		}
+	}
+
+	page := []data.InboxItem{}
+	for i := offset; i < len(userItems) && i < offset+limit; i++ {
+		page = append(page, userItems[i])
+	}
+	return &page, int64(len(userItems)), nil
+}
+
+func (repository *fakeInboxRepository) CountUnread(userId string) (int64, error) {
+	var count int64
+	for _, item := range repository.items {
+		if item.UserId == userId && item.ArchivedAt == nil && item.ReadAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (repository *fakeInboxRepository) MarkRead(userId string, itemId int) (bool, error) {
+	return repository.update(userId, itemId, func(item *data.InboxItem, now time.Time) {
+		if item.ReadAt == nil {
+			item.ReadAt = &now
+		}
+	}), nil
+}
+
+func (repository *fakeInboxRepository) MarkAllRead(userId string) (int64, error) {
+	var updated int64
+	now := time.Now()
+	for i := range repository.items {
+		item := &repository.items[i]
+		if item.UserId == userId && item.ArchivedAt == nil && item.ReadAt == nil {
+			item.ReadAt = &now
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+func (repository *fakeInboxRepository) Archive(userId string, itemId int) (bool, error) {
+	return repository.update(userId, itemId, func(item *data.InboxItem, now time.Time) {
+		if item.ArchivedAt == nil {
+			item.ArchivedAt = &now
+		}
+	}), nil
+}
+
+// Applies the update to the item of the user; returns false if the user has no such item.
+func (repository *fakeInboxRepository) update(userId string, itemId int, apply func(*data.InboxItem, time.Time)) bool {
+	for i := range repository.items {
+		if repository.items[i].Id == itemId && repository.items[i].UserId == userId {
+			apply(&repository.items[i], time.Now())
+			return true
+		}
+	}
+	return false
+}
+
+func newInboxRouter(repository *fakeInboxRepository) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	lgr := logger.Setup(config.ServiceEnv{Name: "test"})
+	handler := handlers.NewInboxHandler(&config.Config{}, repository, lgr)
+
+	router := gin.New()
+	router.GET("/inbox/:userId", handler.GetInbox)
+	router.POST("/inbox/:userId/items/:itemId/read", handler.MarkRead)
+	router.POST("/inbox/:userId/read-all", handler.MarkAllRead)
+	router.POST("/inbox/:userId/items/:itemId/archive", handler.Archive)
+	return router
+}
+
+func TestInboxHandler_GetInbox_Paginates(t *testing.T) {
+	repository := &fakeInboxRepository{}
+	for i := 0; i < 3; i++ {
+		_, _ = repository.Deliver(context.Background(), &data.Notification{UserId: "user-1", Message: "message"})
+	}
+	_, _ = repository.Deliver(context.Background(), &data.Notification{UserId: "user-2", Message: "message"})
+	router := newInboxRouter(repository)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/inbox/user-1?page=2&pageSize=2", nil)
+	router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var page external.InboxPage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &page))
+	assert.Len(t, page.Items, 1)
+	assert.Equal(t, 2, page.Page)
+	assert.Equal(t, 2, page.PageSize)
+	assert.Equal(t, int64(3), page.Total)
+	assert.Equal(t, int64(3), page.UnreadCount)
+}
+
+func TestInboxHandler_GetInbox_InvalidPageSize(t *testing.T) {
+	router := newInboxRouter(&fakeInboxRepository{})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/inbox/user-1?pageSize=1000", nil)
+	router.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestInboxHandler_MarkRead(t *testing.T) {
+	repository := &fakeInboxRepository{}
+	_, _ = repository.Deliver(context.Background(), &data.Notification{UserId: "user-1", Message: "message"})
+	router := newInboxRouter(repository)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/inbox/user-1/items/1/read", nil)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/inbox/user-2/items/1/read", nil)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	assert.NotNil(t, repository.items[0].ReadAt)
+}
+
+func TestInboxHandler_MarkAllRead(t *testing.T) {
+	repository := &fakeInboxRepository{}
+	for _, userId := range []string{"user-1", "user-1", "user-1", "user-2"} {
+		_, _ = repository.Deliver(context.Background(), &data.Notification{UserId: userId, Message: "message"})
+	}
+	router := newInboxRouter(repository)
+	serve(router, http.MethodPost, "/inbox/user-1/items/1/read")
+
+	recorder := serve(router, http.MethodPost, "/inbox/user-1/read-all")
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var result external.MarkAllReadResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	// The item which has been read already is not updated again.
+	assert.Equal(t, int64(2), result.Updated)
+	assert.Equal(t, int64(0), getInbox(t, router, "user-1").UnreadCount)
+	assert.Equal(t, int64(1), getInbox(t, router, "user-2").UnreadCount)
+
+	recorder = serve(router, http.MethodPost, "/inbox/user-1/read-all")
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(t, int64(0), result.Updated)
+}
+
+func TestInboxHandler_Archive(t *testing.T) {
+	repository := &fakeInboxRepository{}
+	for range 2 {
+		_, _ = repository.Deliver(context.Background(), &data.Notification{UserId: "user-1", Message: "message"})
+	}
+	router := newInboxRouter(repository)
+
+	assert.Equal(t, http.StatusNoContent, serve(router, http.MethodPost, "/inbox/user-1/items/1/archive").Code)
+
+	// The archived item is hidden from the inbox and it is not counted as unread.
+	inbox := getInbox(t, router, "user-1")
+	require.Len(t, inbox.Items, 1)
+	assert.Equal(t, 2, inbox.Items[0].Id)
+	assert.Equal(t, int64(1), inbox.Total)
+	assert.Equal(t, int64(1), inbox.UnreadCount)
+
+	assert.Equal(t, http.StatusNotFound, serve(router, http.MethodPost, "/inbox/user-2/items/2/archive").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(router, http.MethodPost, "/inbox/user-1/items/first/archive").Code)
+	assert.Nil(t, repository.items[1].ArchivedAt)
+}
+
+func serve(router *gin.Engine, method string, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func getInbox(t *testing.T, router *gin.Engine, userId string) external.InboxPage {
+	recorder := serve(router, http.MethodGet, "/inbox/"+userId)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var page external.InboxPage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &page))
+	return page
+}
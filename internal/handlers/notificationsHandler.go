@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
+	"slices"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/plyovchev/notifications-service/internal/config"
@@ -11,26 +14,35 @@ import (
 	"github.com/plyovchev/notifications-service/internal/models/external"
 	"github.com/plyovchev/notifications-service/internal/repositories"
 	"github.com/plyovchev/notifications-service/internal/services"
-	"github.com/plyovchev/notifications-service/internal/util"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
 )
 
 type NotificationsHandler struct {
 	config                 *config.Config
 	notificationService    services.NotificationsService
+	attachmentsService     services.AttachmentsService
+	notifierRegistry       *notifiers.Registry
 	notificationRepository repositories.NotificationRepository
+	attemptRepository      repositories.DeliveryAttemptRepository
 	logger                 *logger.AppLogger
 }
 
 func NewNotificationsHandler(
 	cfg *config.Config,
 	notificationService services.NotificationsService,
+	attachmentsService services.AttachmentsService,
+	notifierRegistry *notifiers.Registry,
 	notificationRepository repositories.NotificationRepository,
+	attemptRepository repositories.DeliveryAttemptRepository,
 	logger *logger.AppLogger,
 ) *NotificationsHandler {
 	return &NotificationsHandler{
 		config:                 cfg,
 		notificationService:    notificationService,
+		attachmentsService:     attachmentsService,
+		notifierRegistry:       notifierRegistry,
 		notificationRepository: notificationRepository,
+		attemptRepository:      attemptRepository,
 		logger:                 logger,
 	}
 }
@@ -40,29 +52,31 @@ func NewNotificationsHandler(
 func (handler *NotificationsHandler) PushNotification(ginContext *gin.Context) {
 	lgr, requestId := handler.logger.WithReqID(ginContext)
 
-	var notificationInput external.NotificationInput
-	if err := ginContext.ShouldBindJSON(&notificationInput); err != nil {
-		apiErr := &external.APIError{
-			HTTPStatusCode: http.StatusBadRequest,
-			ErrorCode:      errors.PushNotificationInvalidParams,
-			Message:        "Invalid push notification request body",
-			DebugID:        requestId,
-		}
-
-		lgr.Error().
-			Err(err).
-			Int("HttpStatusCode", apiErr.HTTPStatusCode).
-			Str("ErrorCode", apiErr.ErrorCode).
-			Msg(apiErr.Message)
+	notificationInput, ok := handler.bindNotificationInput(ginContext, lgr, requestId)
+	if !ok {
+		return
+	}
 
-		ginContext.AbortWithStatusJSON(apiErr.HTTPStatusCode, apiErr)
+	attachments, err := handler.attachmentsService.CreateAttachments(notificationInput.Attachments)
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, attachmentAPIError(err, requestId), err)
 		return
 	}
 
-	// Persist the newly created notifications from the input.
-	notifications := createNotificationsFromInput(notificationInput)
-	for _, notification := range notifications {
-		if _, err := handler.notificationRepository.Create(notification); err != nil {
+	// Persist the newly created notifications from the input. The duplicates are answered with the ids
+	// of their originals and only the new notifications are sent.
+	notifications := createNotificationsFromInput(*notificationInput, attachments, requestId)
+	notificationIds := make([]int, len(notifications))
+	var createdIds []int
+	// The content stored for the attachments is discarded unless a new notification references it.
+	defer func() {
+		if len(createdIds) == 0 {
+			handler.attachmentsService.DiscardAttachments(attachments)
+		}
+	}()
+	for i, notification := range notifications {
+		created, err := handler.createNotification(notification)
+		if err != nil {
 			dbApiErr := &external.APIError{
 				HTTPStatusCode: http.StatusInternalServerError,
 				ErrorCode:      errors.FailedToInsertInDb,
@@ -79,17 +93,224 @@ func (handler *NotificationsHandler) PushNotification(ginContext *gin.Context) {
 			ginContext.AbortWithStatusJSON(dbApiErr.HTTPStatusCode, dbApiErr)
 			return
 		}
+
+		notificationIds[i] = created.Id
+		if notification.Status == data.Deduplicated {
+			lgr.Info().
+				Int("notificationId", notification.Id).
+				Int("originalId", created.Id).
+				Msgf("The notification with key '%s' has been deduplicated.", notification.Key)
+			continue
+		}
+		createdIds = append(createdIds, created.Id)
 	}
 
 	// Notify the notification service that new notifications have been received.
 	// The notification ids are also sent so the new notifications could be prioritized.
-	notificationIds := util.Map(notifications, func(notification *data.Notification) int { return notification.Id })
-	handler.notificationService.OnNotificationsReceived(notificationIds)
+	if len(createdIds) > 0 {
+		handler.notificationService.OnNotificationsReceived(createdIds)
+	}
 
 	ginContext.JSON(http.StatusOK, notificationIds)
 }
 
-func createNotificationsFromInput(notificationInput external.NotificationInput) []*data.Notification {
+// Persists the notification, unless the deduplication is enabled and the notification repeats an original one
+// pushed within the deduplication window. Returns the persisted notification or the original of a duplicate.
+func (handler *NotificationsHandler) createNotification(notification *data.Notification) (*data.Notification, error) {
+	window := handler.config.Deduplication.Window
+	if window <= 0 {
+		return handler.notificationRepository.Create(notification)
+	}
+	return handler.notificationRepository.CreateUnlessDuplicate(notification, window)
+}
+
+// Handles a request for a preview of the notifications of a NotificationInput. Expects a HTTP POST request.
+// The input is validated and routed like a pushed one, and the payloads which would be sent over its delivery
+// channels are rendered, but the notifications are neither stored nor sent.
+func (handler *NotificationsHandler) PreviewNotification(ginContext *gin.Context) {
+	lgr, requestId := handler.logger.WithReqID(ginContext)
+
+	notificationInput, ok := handler.bindNotificationInput(ginContext, lgr, requestId)
+	if !ok {
+		return
+	}
+
+	attachments, blobStore, err := handler.attachmentsService.PreviewAttachments(notificationInput.Attachments)
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, attachmentAPIError(err, requestId), err)
+		return
+	}
+
+	ctx := context.WithValue(ginContext.Request.Context(), config.ContextKey(config.RequestIdentifier), requestId)
+	notifications := createNotificationsFromInput(*notificationInput, attachments, requestId)
+	previews := make([]external.ChannelPreview, len(notifications))
+	for i, notification := range notifications {
+		preview, err := handler.notifierRegistry.Preview(ctx, notification, blobStore)
+		previews[i] = external.ChannelPreview{
+			DeliveryChannel: notification.DeliveryChannel,
+			Destination:     preview.Destination,
+			Provider:        preview.Provider,
+			Recipients:      preview.Recipients,
+			ContentType:     preview.ContentType,
+			Payload:         preview.Payload,
+		}
+		if err != nil {
+			// The failures which would fail the send, e.g. a missing Slack channel, are reported per channel.
+			previews[i].Error = err.Error()
+		}
+	}
+
+	ginContext.JSON(http.StatusOK, external.NotificationPreview{Channels: previews})
+}
+
+// Handles a request for a notification together with the metadata of its attachments. Expects a HTTP GET request.
+func (handler *NotificationsHandler) GetNotification(ginContext *gin.Context) {
+	lgr, requestId := handler.logger.WithReqID(ginContext)
+
+	notification, ok := handler.findNotification(ginContext, lgr, requestId)
+	if !ok {
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, notification)
+}
+
+// Handles a request for the delivery attempts of a notification, in the order in which they were made.
+// Expects a HTTP GET request.
+func (handler *NotificationsHandler) GetNotificationAttempts(ginContext *gin.Context) {
+	lgr, requestId := handler.logger.WithReqID(ginContext)
+
+	notification, ok := handler.findNotification(ginContext, lgr, requestId)
+	if !ok {
+		return
+	}
+
+	attempts, err := handler.attemptRepository.FindAllByNotificationId(notification.Id)
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, dbQueryAPIError(requestId), err)
+		return
+	}
+
+	ginContext.JSON(http.StatusOK, attempts)
+}
+
+// Finds the notification of the 'id' path param. Aborts the request and returns false when the id is invalid
+// or no such notification exists.
+func (handler *NotificationsHandler) findNotification(
+	ginContext *gin.Context,
+	lgr *logger.AppLogger,
+	requestId string,
+) (*data.Notification, bool) {
+	id, err := strconv.Atoi(ginContext.Param("id"))
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, &external.APIError{
+			HTTPStatusCode: http.StatusBadRequest,
+			ErrorCode:      errors.NotificationInvalidParams,
+			Message:        "Invalid notification id",
+			DebugID:        requestId,
+		}, err)
+		return nil, false
+	}
+
+	notification, err := handler.notificationRepository.FindById(id)
+	if err != nil {
+		abortWithAPIError(ginContext, lgr, dbQueryAPIError(requestId), err)
+		return nil, false
+	}
+	if notification == nil {
+		abortWithAPIError(ginContext, lgr, &external.APIError{
+			HTTPStatusCode: http.StatusNotFound,
+			ErrorCode:      errors.NotificationNotFound,
+			Message:        "Notification not found",
+			DebugID:        requestId,
+		}, nil)
+		return nil, false
+	}
+	return notification, true
+}
+
+// Binds and validates the NotificationInput of the request body, including the routing to the delivery channels
+// and their destinations. Aborts the request with 400 Bad Request and returns false when the input is invalid.
+func (handler *NotificationsHandler) bindNotificationInput(
+	ginContext *gin.Context,
+	lgr *logger.AppLogger,
+	requestId string,
+) (*external.NotificationInput, bool) {
+	var notificationInput external.NotificationInput
+	if err := ginContext.ShouldBindJSON(&notificationInput); err != nil {
+		apiErr := &external.APIError{
+			HTTPStatusCode: http.StatusBadRequest,
+			ErrorCode:      errors.PushNotificationInvalidParams,
+			Message:        "Invalid push notification request body",
+			DebugID:        requestId,
+		}
+
+		lgr.Error().
+			Err(err).
+			Int("HttpStatusCode", apiErr.HTTPStatusCode).
+			Str("ErrorCode", apiErr.ErrorCode).
+			Msg(apiErr.Message)
+
+		ginContext.AbortWithStatusJSON(apiErr.HTTPStatusCode, apiErr)
+		return nil, false
+	}
+
+	for _, deliveryChannel := range notificationInput.DeliveryChannels {
+		if !handler.notifierRegistry.IsEnabled(deliveryChannel) {
+			abortWithAPIError(ginContext, lgr, &external.APIError{
+				HTTPStatusCode: http.StatusBadRequest,
+				ErrorCode:      errors.PushNotificationInvalidParams,
+				Message:        "Unsupported or disabled delivery channel " + string(deliveryChannel),
+				DebugID:        requestId,
+			}, nil)
+			return nil, false
+		}
+	}
+
+	for deliveryChannel, destination := range notificationInput.Destinations {
+		if !slices.Contains(notificationInput.DeliveryChannels, deliveryChannel) ||
+			!handler.notifierRegistry.HasDestination(deliveryChannel, destination) {
+			abortWithAPIError(ginContext, lgr, &external.APIError{
+				HTTPStatusCode: http.StatusBadRequest,
+				ErrorCode:      errors.PushNotificationInvalidParams,
+				Message:        "Unknown destination " + destination + " for the delivery channel " + string(deliveryChannel),
+				DebugID:        requestId,
+			}, nil)
+			return nil, false
+		}
+	}
+
+	if notificationInput.Type == "" {
+		notificationInput.Type = data.Info
+	}
+	if !notificationInput.Type.IsValid() {
+		abortWithAPIError(ginContext, lgr, &external.APIError{
+			HTTPStatusCode: http.StatusBadRequest,
+			ErrorCode:      errors.PushNotificationInvalidParams,
+			Message:        "Invalid notification type",
+			DebugID:        requestId,
+		}, nil)
+		return nil, false
+	}
+
+	if slices.Contains(notificationInput.DeliveryChannels, data.InApp) && notificationInput.UserId == "" {
+		abortWithAPIError(ginContext, lgr, &external.APIError{
+			HTTPStatusCode: http.StatusBadRequest,
+			ErrorCode:      errors.PushNotificationInvalidParams,
+			Message:        "The InApp delivery channel requires a userId",
+			DebugID:        requestId,
+		}, nil)
+		return nil, false
+	}
+
+	return &notificationInput, true
+}
+
+func createNotificationsFromInput(
+	notificationInput external.NotificationInput,
+	attachments []data.Attachment,
+	requestId string,
+) []*data.Notification {
 	if len(notificationInput.DeliveryChannels) == 0 {
 		return nil
 	}
@@ -98,10 +319,20 @@ func createNotificationsFromInput(notificationInput external.NotificationInput)
 	for i, deliveryChannel := range notificationInput.DeliveryChannels {
 		notifications[i] = &data.Notification{
 			Key:             notificationInput.Key,
+			Subject:         notificationInput.Subject,
 			Message:         notificationInput.Message,
+			Type:            notificationInput.Type,
 			DeliveryChannel: deliveryChannel,
-			Status:          data.Pending,
+			UserId:          notificationInput.UserId,
+			SlackChannel:    notificationInput.SlackChannel,
+			Destination:     notificationInput.Destinations[deliveryChannel],
+			RequestId:       requestId,
+			Resolved:        notificationInput.Resolved,
+			// Each notification gets its own copy, as the attachments are persisted per notification.
+			Attachments: slices.Clone(attachments),
+			Status:      data.Pending,
 		}
+		notifications[i].DeduplicationKey = notifications[i].ComputeDeduplicationKey()
 	}
 
 	return notifications
@@ -1,18 +1,466 @@
 package handlers_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/handlers"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/models/external"
+	"github.com/plyovchev/notifications-service/internal/repositories"
+	"github.com/plyovchev/notifications-service/internal/services"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestNotificationsHandler_PushNotification_Success(t *testing.T) {
-	// lgr := logger.Setup(config.ServiceEnv{Name: "test"})
-	// config := config.Config{}
+type fakeNotificationRepository struct {
+	notifications []data.Notification
+	// The error returned by the creation of the notifications, if set.
+	createErr error
+}
+
+func (repository *fakeNotificationRepository) Create(notification *data.Notification) (*data.Notification, error) {
+	if repository.createErr != nil {
+		return nil, repository.createErr
+	}
+	notification.Id = len(repository.notifications) + 1
+	notification.CreatedAt = time.Now()
+	repository.notifications = append(repository.notifications, *notification)
+	return notification, nil
+}
+
+func (repository *fakeNotificationRepository) CreateUnlessDuplicate(
+	notification *data.Notification,
+	window time.Duration,
+) (*data.Notification, error) {
+	since := time.Now().Add(-window)
+	for _, original := range repository.notifications {
+		if original.DeduplicationKey == notification.DeduplicationKey && original.DuplicateOf == nil &&
+			!original.CreatedAt.Before(since) {
+			notification.Status = data.Deduplicated
+			notification.DuplicateOf = &original.Id
+			notification.Attachments = nil
+			_, _ = repository.Create(notification)
+			return &original, nil
+		}
+	}
+	return repository.Create(notification)
+}
+
+func (repository *fakeNotificationRepository) FindAll() (*[]data.Notification, error) {
+	return &repository.notifications, nil
+}
+
+func (repository *fakeNotificationRepository) FindById(id int) (*data.Notification, error) {
+	for _, notification := range repository.notifications {
+		if notification.Id == id {
+			return &notification, nil
+		}
+	}
+	return nil, nil
+}
+
+func (repository *fakeNotificationRepository) FindAllByIds(ids []int) (*[]data.Notification, error) {
+	return &repository.notifications, nil
+}
+
+func (repository *fakeNotificationRepository) FindAllByStatus(data.NotificationStatus) (*[]data.Notification, error) {
+	return &repository.notifications, nil
+}
+
+func (repository *fakeNotificationRepository) Save(notification *data.Notification) (*data.Notification, error) {
+	return notification, nil
+}
+
+func (repository *fakeNotificationRepository) ClaimDue(repositories.Claim) (*[]data.Notification, error) {
+	return &[]data.Notification{}, nil
+}
+
+func (repository *fakeNotificationRepository) SaveClaimed(*data.Notification) error {
+	return nil
+}
+
+func (repository *fakeNotificationRepository) RenewLeases(string, []int, time.Duration) error {
+	return nil
+}
+
+func (repository *fakeNotificationRepository) ReleaseLeases(string) (int64, error) {
+	return 0, nil
+}
+
+func (repository *fakeNotificationRepository) ReleaseExpiredLeases() (int64, error) {
+	return 0, nil
+}
+
+type fakeDeliveryAttemptRepository struct {
+	attempts []data.DeliveryAttempt
+}
+
+func (repository *fakeDeliveryAttemptRepository) Add(attempt *data.DeliveryAttempt) error {
+	repository.attempts = append(repository.attempts, *attempt)
+	return nil
+}
+
+func (repository *fakeDeliveryAttemptRepository) FindAllByNotificationId(notificationId int) (*[]data.DeliveryAttempt, error) {
+	attempts := []data.DeliveryAttempt{}
+	for _, attempt := range repository.attempts {
+		if attempt.NotificationId == notificationId {
+			attempts = append(attempts, attempt)
+		}
+	}
+	return &attempts, nil
+}
+
+type fakeNotificationsService struct {
+	receivedIds []int
+}
+
+func (service *fakeNotificationsService) SendNotification(context.Context, *data.Notification) notifiers.SendResult {
+	return notifiers.SendResult{Outcome: notifiers.Delivered}
+}
+
+func (service *fakeNotificationsService) OnNotificationsReceived(notificationIds []int) {
+	service.receivedIds = append(service.receivedIds, notificationIds...)
+}
+
+func (service *fakeNotificationsService) StartNotificationService() {}
+
+func (service *fakeNotificationsService) StopNotificationService() {}
+
+// The collaborators of the notifications handler which the tests inspect; the missing ones are replaced by empty fakes.
+type notificationsRouterOptions struct {
+	attemptRepository   *fakeDeliveryAttemptRepository
+	notificationService *fakeNotificationsService
+	deduplicationWindow time.Duration
+	// The directory of the blob store; a temporary one when it is empty.
+	blobDir string
+}
+
+func newNotificationsRouter(t *testing.T, repository *fakeNotificationRepository) *gin.Engine {
+	return newNotificationsRouterWith(t, repository, notificationsRouterOptions{})
+}
+
+func newNotificationsRouterWith(
+	t *testing.T,
+	repository *fakeNotificationRepository,
+	options notificationsRouterOptions,
+) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	lgr := logger.Setup(config.ServiceEnv{Name: "test"})
+	if options.attemptRepository == nil {
+		options.attemptRepository = &fakeDeliveryAttemptRepository{}
+	}
+	if options.notificationService == nil {
+		options.notificationService = &fakeNotificationsService{}
+	}
+
+	cfg := &config.Config{}
+	cfg.Deduplication.Window = options.deduplicationWindow
+	cfg.Email.From = "payments@example.com"
+	cfg.Email.Recipients = []string{"ops@example.com"}
+	cfg.Email.SmtpHost = "127.0.0.1"
+	cfg.Email.SmtpPort = "2525"
+	cfg.Slack.WebhookUrl = "https://hooks.slack.com/services/T000/B000/XXXX"
+	cfg.Slack.Destinations = map[string]config.SlackDestination{
+		"payments_ops": {SlackConnection: config.SlackConnection{WebhookUrl: "https://hooks.slack.com/services/T111/B111/YYYY"}},
+	}
+	registry, err := notifiers.NewRegistry(cfg, notifiers.Dependencies{InboxRepository: &fakeInboxRepository{}}, lgr)
+	require.NoError(t, err)
+
+	if options.blobDir == "" {
+		options.blobDir = t.TempDir()
+	}
+	blobStore, err := blobstore.NewLocalBlobStore(options.blobDir)
+	require.NoError(t, err)
+	attachmentsService := services.NewAttachmentsService(blobStore, cfg, lgr)
+
+	handler := handlers.NewNotificationsHandler(
+		cfg, options.notificationService, attachmentsService, registry, repository, options.attemptRepository, lgr,
+	)
+	router := gin.New()
+	router.POST("/notifications/push-notification", handler.PushNotification)
+	router.POST("/notifications/preview", handler.PreviewNotification)
+	router.GET("/notifications/:id/attempts", handler.GetNotificationAttempts)
+	return router
+}
+
+func TestNotificationsHandler_PushNotification_Destinations(t *testing.T) {
+	repository := &fakeNotificationRepository{}
+	router := newNotificationsRouter(t, repository)
+
+	body := `{"key":"payment-failed","message":"Payment has failed","deliveryChannels":["Slack","InApp"],
+		"userId":"user-1","destinations":{"Slack":"payments_ops"}}`
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/notifications/push-notification", strings.NewReader(body))
+	router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var ids []int
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &ids))
+	assert.Equal(t, []int{1, 2}, ids)
+	require.Len(t, repository.notifications, 2)
+	assert.Equal(t, "payments_ops", repository.notifications[0].Destination)
+	assert.Equal(t, "", repository.notifications[1].Destination)
+}
+
+func TestNotificationsHandler_PushNotification_Deduplication(t *testing.T) {
+	pushed := `{"key":"payment-failed","message":"Payment has failed","deliveryChannels":["Slack","InApp"],"userId":"user-1"}`
+	tests := []struct {
+		name   string
+		window time.Duration
+		body   string
+		ids    []int
+	}{
+		{"Duplicate", time.Minute, pushed, []int{1, 2}},
+		{"DeduplicationDisabled", 0, pushed, []int{3, 4}},
+		{"OutsideWindow", time.Nanosecond, pushed, []int{3, 4}},
+		{"DifferentMessage", time.Minute,
+			`{"key":"payment-failed","message":"Payment has failed twice","deliveryChannels":["Slack","InApp"],"userId":"user-1"}`,
+			[]int{3, 4}},
+		{"DifferentRecipient", time.Minute,
+			`{"key":"payment-failed","message":"Payment has failed","deliveryChannels":["Slack","InApp"],"userId":"user-2"}`,
+			[]int{1, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &fakeNotificationRepository{}
+			service := &fakeNotificationsService{}
+			router := newNotificationsRouterWith(t, repository, notificationsRouterOptions{
+				notificationService: service,
+				deduplicationWindow: tt.window,
+			})
+
+			var ids []int
+			for _, body := range []string{pushed, tt.body} {
+				recorder := httptest.NewRecorder()
+				req, _ := http.NewRequest(http.MethodPost, "/notifications/push-notification", strings.NewReader(body))
+				router.ServeHTTP(recorder, req)
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &ids))
+			}
+
+			// The duplicates are stored but only the new notifications are sent.
+			assert.Equal(t, tt.ids, ids)
+			require.Len(t, repository.notifications, 4)
+			var sentIds []int
+			for _, notification := range repository.notifications {
+				if notification.Status == data.Deduplicated {
+					assert.Contains(t, tt.ids, *notification.DuplicateOf)
+					continue
+				}
+				assert.Nil(t, notification.DuplicateOf)
+				sentIds = append(sentIds, notification.Id)
+			}
+			assert.Equal(t, sentIds, service.receivedIds)
+		})
+	}
+}
+
+func TestNotificationsHandler_PushNotification_DeduplicationOfAttachments(t *testing.T) {
+	report := func(filename string, content string) string {
+		return `{"key":"daily-report","message":"The daily report","deliveryChannels":["Email"],
+			"attachments":[{"filename":"` + filename + `","contentType":"text/csv","content":"` + content + `"}]}`
+	}
+	pushed := report("report.csv", "YSxiCjEsMgo=")
+	tests := []struct {
+		name string
+		body string
+		ids  []int
+	}{
+		{"SameAttachment", pushed, []int{1}},
+		{"DifferentContent", report("report.csv", "YSxiCjMsNAo="), []int{2}},
+		{"DifferentFilename", report("report-2.csv", "YSxiCjEsMgo="), []int{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &fakeNotificationRepository{}
+			router := newNotificationsRouterWith(t, repository, notificationsRouterOptions{deduplicationWindow: time.Minute})
+
+			var ids []int
+			for _, body := range []string{pushed, tt.body} {
+				recorder := httptest.NewRecorder()
+				req, _ := http.NewRequest(http.MethodPost, "/notifications/push-notification", strings.NewReader(body))
+				router.ServeHTTP(recorder, req)
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &ids))
+			}
+
+			// The reports with other attachments are not duplicates, although their text is the same.
+			assert.Equal(t, tt.ids, ids)
+		})
+	}
+}
+
+func TestNotificationsHandler_PushNotification_DiscardsUnreferencedAttachments(t *testing.T) {
+	body := `{"key":"daily-report","message":"The daily report","deliveryChannels":["Email"],
+		"attachments":[{"filename":"report.csv","contentType":"text/csv","content":"YSxiCjEsMgo="}]}`
+	// The second push is either a duplicate or fails, so only the content stored for the first one is kept.
+	tests := []struct {
+		name      string
+		window    time.Duration
+		createErr error
+	}{
+		{"Duplicate", time.Minute, nil},
+		{"FailedInsert", 0, errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blobDir := t.TempDir()
+			repository := &fakeNotificationRepository{}
+			router := newNotificationsRouterWith(t, repository, notificationsRouterOptions{
+				deduplicationWindow: tt.window,
+				blobDir:             blobDir,
+			})
+
+			for _, createErr := range []error{nil, tt.createErr} {
+				repository.createErr = createErr
+				recorder := httptest.NewRecorder()
+				req, _ := http.NewRequest(http.MethodPost, "/notifications/push-notification", strings.NewReader(body))
+				router.ServeHTTP(recorder, req)
+				if createErr != nil {
+					require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				} else {
+					require.Equal(t, http.StatusOK, recorder.Code)
+				}
+			}
+
+			blobs, err := os.ReadDir(blobDir)
+			require.NoError(t, err)
+			assert.Len(t, blobs, 1)
+		})
+	}
+}
+
+func TestNotificationsHandler_PushNotification_InvalidInput(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"DisabledChannel", `{"message":"m","deliveryChannels":["Queue"]}`},
+		{"UnknownDestination", `{"message":"m","deliveryChannels":["Slack"],"destinations":{"Slack":"marketing"}}`},
+		{"DestinationOfUnrequestedChannel", `{"message":"m","deliveryChannels":["Slack"],"destinations":{"Email":"default"}}`},
+		{"InAppWithoutUser", `{"message":"m","deliveryChannels":["InApp"]}`},
+		{"InvalidType", `{"message":"m","type":"Fatal","deliveryChannels":["Slack"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &fakeNotificationRepository{}
+			router := newNotificationsRouter(t, repository)
+
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/notifications/push-notification", strings.NewReader(tt.body))
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+			assert.Empty(t, repository.notifications)
+		})
+	}
+}
+
+func TestNotificationsHandler_PreviewNotification(t *testing.T) {
+	repository := &fakeNotificationRepository{}
+	router := newNotificationsRouter(t, repository)
+
+	body := `{"key":"payment-failed","subject":"Payment failed","message":"Payment has failed",
+		"deliveryChannels":["Email","Slack","InApp"],"userId":"user-1","destinations":{"Slack":"payments_ops"},
+		"attachments":[{"filename":"receipt.txt","contentType":"text/plain","content":"cmVjZWlwdA=="}]}`
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/notifications/preview", strings.NewReader(body))
+	router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var preview external.NotificationPreview
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &preview))
+	require.Len(t, preview.Channels, 3)
+
+	email := preview.Channels[0]
+	assert.Equal(t, data.Email, email.DeliveryChannel)
+	assert.Equal(t, "default", email.Destination)
+	assert.Equal(t, "smtp", email.Provider)
+	assert.Equal(t, []string{"ops@example.com"}, email.Recipients)
+	assert.Equal(t, "message/rfc822", email.ContentType)
+	assert.Contains(t, email.Payload, "Subject: Payment failed")
+	assert.Contains(t, email.Payload, "cmVjZWlwdA==")
+
+	slack := preview.Channels[1]
+	assert.Equal(t, "payments_ops", slack.Destination)
+	assert.Equal(t, "application/json", slack.ContentType)
+	assert.Equal(t, "Payment has failed", slack.Payload.(map[string]any)["text"])
+
+	inApp := preview.Channels[2]
+	assert.Equal(t, []string{"user-1"}, inApp.Recipients)
+	assert.Empty(t, inApp.Error)
+
+	assert.Empty(t, repository.notifications)
+}
+
+func TestNotificationsHandler_PreviewNotification_InvalidInput(t *testing.T) {
+	repository := &fakeNotificationRepository{}
+	router := newNotificationsRouter(t, repository)
+
+	recorder := httptest.NewRecorder()
+	body := `{"message":"m","deliveryChannels":["Slack"],"destinations":{"Slack":"marketing"}}`
+	req, _ := http.NewRequest(http.MethodPost, "/notifications/preview", strings.NewReader(body))
+	router.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestNotificationsHandler_GetNotificationAttempts(t *testing.T) {
+	repository := &fakeNotificationRepository{notifications: []data.Notification{{Id: 1}, {Id: 2}}}
+	attemptRepository := &fakeDeliveryAttemptRepository{attempts: []data.DeliveryAttempt{
+		{Id: 1, NotificationId: 1, AttemptNumber: 1, Provider: "smtp", Outcome: "transient", Error: "timeout"},
+		{Id: 2, NotificationId: 2, AttemptNumber: 1, Provider: "smtp", Outcome: "delivered"},
+		{Id: 3, NotificationId: 1, AttemptNumber: 2, Provider: "sendgrid", Outcome: "delivered", ProviderResponseCode: 202},
+	}}
+	router := newNotificationsRouterWith(t, repository, notificationsRouterOptions{attemptRepository: attemptRepository})
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/notifications/1/attempts", nil)
+	router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var attempts []data.DeliveryAttempt
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &attempts))
+	require.Len(t, attempts, 2)
+	assert.Equal(t, 1, attempts[0].AttemptNumber)
+	assert.Equal(t, "timeout", attempts[0].Error)
+	assert.Equal(t, 2, attempts[1].AttemptNumber)
+	assert.Equal(t, "sendgrid", attempts[1].Provider)
+	assert.Equal(t, 202, attempts[1].ProviderResponseCode)
+}
+
+func TestNotificationsHandler_GetNotificationAttempts_InvalidInput(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		statusCode int
+	}{
+		{"InvalidId", "first", http.StatusBadRequest},
+		{"UnknownNotification", "3", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &fakeNotificationRepository{notifications: []data.Notification{{Id: 1}}}
+			router := newNotificationsRouter(t, repository)
 
-	// recorder := httptest.NewRecorder()
-	// gin.SetMode(gin.TestMode)
-	// c, r := gin.CreateTestContext(recorder)
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/notifications/"+tt.id+"/attempts", nil)
+			router.ServeHTTP(recorder, req)
 
-	// repository := repositories.NewNotificationRepository()
-	// notificationService := services.NewNotificationService()
-	// handler := handlers.NewNotificationsHandler(config, )
+			assert.Equal(t, tt.statusCode, recorder.Code)
+		})
+	}
 }
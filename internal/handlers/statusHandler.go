@@ -5,6 +5,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
 )
 
 type ServiceStatus string
@@ -14,20 +16,40 @@ const (
 	DOWN ServiceStatus = "down"
 )
 
+// The status of the service together with the delivery channels it serves and the states of their circuits.
+type Status struct {
+	Status          ServiceStatus                                    `json:"status"`
+	EnabledChannels []data.DeliveryChannel                           `json:"enabledChannels"`
+	Circuits        map[data.DeliveryChannel]notifiers.CircuitStatus `json:"circuits"`
+}
+
 type StatusHandler struct {
-	logger *logger.AppLogger
+	logger           *logger.AppLogger
+	notifierRegistry *notifiers.Registry
 }
 
-func NewStatusHandler(logger *logger.AppLogger) *StatusHandler {
+func NewStatusHandler(notifierRegistry *notifiers.Registry, logger *logger.AppLogger) *StatusHandler {
 	return &StatusHandler{
-		logger: logger,
+		logger:           logger,
+		notifierRegistry: notifierRegistry,
 	}
 }
 
 // CheckStatus - Checks the health of all the dependencies of the service to ensure complete serviceability.
+// An open circuit of a delivery channel does not put the service down, as its notifications are deferred.
 func (s *StatusHandler) CheckStatus(c *gin.Context) {
 	var code = http.StatusOK
 
 	// send response
-	c.JSON(code, UP)
+	c.JSON(code, Status{
+		Status:          UP,
+		EnabledChannels: s.notifierRegistry.EnabledChannels(),
+		Circuits:        s.notifierRegistry.CircuitStatuses(),
+	})
+}
+
+// ListCircuits - Returns the states of the circuit breakers of the enabled delivery channels in this replica.
+// Expects a HTTP GET request.
+func (s *StatusHandler) ListCircuits(c *gin.Context) {
+	c.JSON(http.StatusOK, s.notifierRegistry.CircuitStatuses())
 }
@@ -72,6 +72,11 @@ func (l *AppLogger) Error() *zerolog.Event {
 	return l.zLogger.Error()
 }
 
+// Warn logs a message with warn level.
+func (l *AppLogger) Warn() *zerolog.Event {
+	return l.zLogger.Warn()
+}
+
 // Info logs a message with info level.
 func (l *AppLogger) Info() *zerolog.Event {
 	return l.zLogger.Info()
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/plyovchev/notifications-service/internal/errors"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/external"
+)
+
+const bearerPrefix = "Bearer "
+
+// AdminAuthMiddleware - Middleware which lets through only the requests authorized by one of the admin API keys,
+// given as 'Authorization: Bearer <key>'. All requests are rejected when no key is configured.
+func AdminAuthMiddleware(apiKeys []string, lgr *logger.AppLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorization := c.GetHeader("Authorization")
+		if strings.HasPrefix(authorization, bearerPrefix) && isAdminApiKey(apiKeys, authorization[len(bearerPrefix):]) {
+			c.Next()
+			return
+		}
+
+		l, requestID := lgr.WithReqID(c)
+		l.Warn().
+			Str("method", c.Request.Method).
+			Str("path", c.FullPath()).
+			Msg("unauthorized admin request")
+		apiErr := &external.APIError{
+			HTTPStatusCode: http.StatusUnauthorized,
+			ErrorCode:      errors.Unauthorized,
+			Message:        "Missing or invalid admin API key",
+			DebugID:        requestID,
+		}
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatusJSON(apiErr.HTTPStatusCode, apiErr)
+	}
+}
+
+// Compares the key with every admin API key in constant time, so the keys could not be guessed by the timing.
+func isAdminApiKey(apiKeys []string, key string) bool {
+	matched := 0
+	for _, apiKey := range apiKeys {
+		matched |= subtle.ConstantTimeCompare([]byte(apiKey), []byte(key))
+	}
+	return key != "" && matched == 1
+}
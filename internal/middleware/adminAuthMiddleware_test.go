@@ -0,0 +1,47 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		apiKeys       []string
+		authorization string
+		statusCode    int
+	}{
+		{"ValidKey", []string{"old-key", "new-key"}, "Bearer new-key", http.StatusOK},
+		{"MissingHeader", []string{"new-key"}, "", http.StatusUnauthorized},
+		{"InvalidKey", []string{"new-key"}, "Bearer other-key", http.StatusUnauthorized},
+		{"NotBearer", []string{"new-key"}, "Basic new-key", http.StatusUnauthorized},
+		{"NoKeysConfigured", nil, "Bearer ", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(middleware.AdminAuthMiddleware(tt.apiKeys, logger.Setup(config.ServiceEnv{Name: "test"})))
+			router.GET("/admin", func(c *gin.Context) {
+				c.String(http.StatusOK, "Admin")
+			})
+
+			req, _ := http.NewRequest(http.MethodGet, "/admin", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.statusCode, resp.Code)
+		})
+	}
+}
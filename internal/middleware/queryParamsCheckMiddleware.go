@@ -9,7 +9,32 @@ import (
 )
 
 var AllowedQueryParams = map[string]map[string]bool{
-	http.MethodPost + "/public-api/v1/notifications/push-notification": nil,
+	http.MethodPost + "/public-api/v1/notifications/push-notification":     nil,
+	http.MethodPost + "/public-api/v1/notifications/preview":               nil,
+	http.MethodGet + "/public-api/v1/notifications/:id":                    nil,
+	http.MethodGet + "/public-api/v1/notifications/:id/attempts":           nil,
+	http.MethodPost + "/public-api/v1/attachments":                         nil,
+	http.MethodGet + "/public-api/v1/inbox/:userId":                        {"page": true, "pageSize": true},
+	http.MethodPost + "/public-api/v1/inbox/:userId/read-all":              nil,
+	http.MethodPost + "/public-api/v1/inbox/:userId/items/:itemId/read":    nil,
+	http.MethodPost + "/public-api/v1/inbox/:userId/items/:itemId/archive": nil,
+	http.MethodGet + "/admin-api/v1/dead-letters":                          deadLetterFilterParams("page", "pageSize"),
+	http.MethodGet + "/admin-api/v1/dead-letters/:id":                      nil,
+	http.MethodPost + "/admin-api/v1/dead-letters/replay":                  deadLetterFilterParams("all"),
+	http.MethodPost + "/admin-api/v1/dead-letters/:id/replay":              nil,
+	http.MethodDelete + "/admin-api/v1/dead-letters":                       deadLetterFilterParams("all"),
+	http.MethodDelete + "/admin-api/v1/dead-letters/:id":                   nil,
+	http.MethodGet + "/admin-api/v1/circuits":                              nil,
+}
+
+// Returns the query params which filter the dead letters together with the extra params of the route,
+// e.g. the pagination params.
+func deadLetterFilterParams(extraParams ...string) map[string]bool {
+	params := map[string]bool{"channel": true, "key": true, "destination": true, "from": true, "to": true}
+	for _, param := range extraParams {
+		params[param] = true
+	}
+	return params
 }
 
 // QueryParamsCheckMiddleware - Middleware to check for unsupported query parameters.
@@ -0,0 +1,35 @@
+package data
+
+import (
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/db"
+)
+
+// The metadata of a file attached to a notification. The content is kept in the blob store.
+type Attachment struct {
+	Id             int       `gorm:"primary_key" json:"id"`
+	NotificationId int       `json:"notification_id"`
+	BlobId         string    `json:"blob_id"`
+	Filename       string    `json:"filename"`
+	ContentType    string    `json:"content_type"`
+	Size           int64     `json:"size"`
+	CreatedAt      time.Time `json:"created_at"`
+	// The hex SHA-256 digest of the content given inline with the pushed notification, for which a new blob is stored;
+	// empty for the attachments which reference an uploaded blob. It is not persisted.
+	ContentDigest string `gorm:"-" json:"-"`
+}
+
+// ContentIdentity identifies the content of the attachment: its digest when it has been given inline, as every push
+// stores it in a new blob, or the immutable blob which it references.
+func (attachment *Attachment) ContentIdentity() string {
+	if attachment.ContentDigest != "" {
+		return "sha256:" + attachment.ContentDigest
+	}
+	return "blob:" + attachment.BlobId
+}
+
+// TableName returns the table name of the attachment struct and it is used by gorm.
+func (Attachment) TableName() string {
+	return db.SCHEMA + "." + db.ATTACHMENT_TABLE
+}
@@ -0,0 +1,52 @@
+package data
+
+import (
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/db"
+)
+
+// A notification which has exhausted its attempts, kept aside for inspection until it is replayed or purged.
+type DeadLetter struct {
+	Id              int             `gorm:"primary_key" json:"id"`
+	NotificationId  int             `json:"notification_id"`
+	Key             string          `json:"key"`
+	DeliveryChannel DeliveryChannel `json:"delivery_channel"`
+	Destination     string          `json:"destination,omitempty"`
+	// The provider which was tried last.
+	Provider string `json:"provider,omitempty"`
+	// The count of the attempts, the error of the last one and the response code of the provider to it.
+	AttemptCount         int    `json:"attempt_count"`
+	LastError            string `json:"last_error"`
+	ProviderResponseCode int    `json:"provider_response_code,omitempty"`
+	// The payload which was rendered for the delivery channel, e.g. the email MIME message or the Slack JSON.
+	// Empty when the payload could not be rendered.
+	PayloadContentType string `json:"payload_content_type,omitempty"`
+	Payload            string `json:"payload,omitempty"`
+	// The notification together with its attachments; loaded only when a single dead letter is inspected.
+	Notification *Notification `gorm:"foreignKey:NotificationId" json:"notification,omitempty"`
+	// The history of the delivery attempts of the notification, including the attempts made before its earlier
+	// replays; loaded only when a single dead letter is inspected.
+	Attempts []DeliveryAttempt `gorm:"foreignKey:NotificationId;references:NotificationId" json:"attempts,omitempty"`
+	// The time at which the notification was dead-lettered.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName returns the table name of the dead letter struct and it is used by gorm.
+func (DeadLetter) TableName() string {
+	return db.SCHEMA + "." + db.DEAD_LETTER_TABLE
+}
+
+// NewDeadLetter captures the final state of the notification.
+func NewDeadLetter(notification *Notification) *DeadLetter {
+	return &DeadLetter{
+		NotificationId:       notification.Id,
+		Key:                  notification.Key,
+		DeliveryChannel:      notification.DeliveryChannel,
+		Destination:          notification.Destination,
+		Provider:             notification.Provider,
+		AttemptCount:         notification.AttemptCount,
+		LastError:            notification.LastError,
+		ProviderResponseCode: notification.ProviderResponseCode,
+	}
+}
@@ -0,0 +1,32 @@
+package data
+
+import (
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/db"
+)
+
+// A single send of a notification to the provider of its delivery channel.
+type DeliveryAttempt struct {
+	Id             int `gorm:"primary_key" json:"id"`
+	NotificationId int `json:"notification_id"`
+	// The number of the attempt among all attempts of the notification, starting from 1. Unlike the attempt count
+	// of the notification, it keeps growing when a dead-lettered notification is replayed.
+	AttemptNumber int `json:"attempt_number"`
+	// The provider which was tried last, e.g. the SMTP relay which delivered the email. Empty for the channels
+	// without providers.
+	Provider  string    `json:"provider,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	// The duration of the send in milliseconds.
+	DurationMs int64 `json:"duration_ms"`
+	// The outcome of the send, e.g. 'delivered', 'transient', 'permanent' or 'rate_limited'.
+	Outcome string `json:"outcome"`
+	// The error of the failed send and the response code of the provider to the send.
+	Error                string `json:"error,omitempty"`
+	ProviderResponseCode int    `json:"provider_response_code,omitempty"`
+}
+
+// TableName returns the table name of the delivery attempt struct and it is used by gorm.
+func (DeliveryAttempt) TableName() string {
+	return db.SCHEMA + "." + db.DELIVERY_ATTEMPT_TABLE
+}
@@ -0,0 +1,36 @@
+package data
+
+import (
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/db"
+)
+
+// An entry in the inbox of a user, created when a notification is delivered over the InApp channel.
+type InboxItem struct {
+	Id             int    `gorm:"primary_key" json:"id"`
+	NotificationId int    `json:"notification_id"`
+	UserId         string `json:"user_id"`
+	Key            string `json:"key"`
+	Message        string `json:"message"`
+	// The time at which the user has read the item; nil while the item is unread.
+	ReadAt *time.Time `json:"read_at"`
+	// The time at which the user has archived the item; archived items are hidden from the inbox.
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName returns the table name of the inbox item struct and it is used by gorm.
+func (InboxItem) TableName() string {
+	return db.SCHEMA + "." + db.INBOX_ITEM_TABLE
+}
+
+// NewInboxItem creates an inbox item for the given notification.
+func NewInboxItem(notification *Notification) *InboxItem {
+	return &InboxItem{
+		NotificationId: notification.Id,
+		UserId:         notification.UserId,
+		Key:            notification.Key,
+		Message:        notification.Message,
+	}
+}
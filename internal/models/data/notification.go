@@ -1,6 +1,9 @@
 package data
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
 	"time"
 
 	"github.com/plyovchev/notifications-service/internal/db"
@@ -8,6 +11,11 @@ import (
 
 type NotificationType string
 
+// IsValid reports whether the type is one of the supported notification types.
+func (notificationType NotificationType) IsValid() bool {
+	return notificationType == Info || notificationType == Warning || notificationType == Error
+}
+
 const (
 	Info    NotificationType = "Info"
 	Warning NotificationType = "Warning"
@@ -19,25 +27,72 @@ type DeliveryChannel string
 const (
 	Email DeliveryChannel = "Email"
 	Slack DeliveryChannel = "Slack"
+	InApp DeliveryChannel = "InApp"
+	Queue DeliveryChannel = "Queue"
+	// Writes the notifications to the standard output or a file; meant for the local development.
+	Sink DeliveryChannel = "Sink"
 )
 
 type NotificationStatus string
 
 const (
-	Pending   NotificationStatus = "pending"
-	Completed NotificationStatus = "completed"
-	Failed    NotificationStatus = "failed"
+	Pending NotificationStatus = "pending"
+	// The notification has been claimed by a replica which is sending it.
+	Processing NotificationStatus = "processing"
+	Completed  NotificationStatus = "completed"
+	Failed     NotificationStatus = "failed"
+	// The notification has exhausted its attempts and it is kept in the dead-letter queue.
+	DeadLettered NotificationStatus = "dead_lettered"
+	// The notification repeats an original which was pushed within the deduplication window; it is not sent.
+	Deduplicated NotificationStatus = "deduplicated"
 )
 
 type Notification struct {
-	Id      int    `gorm:"primary_key" json:"id"`
-	Key     string `json:"key"`
+	Id  int    `gorm:"primary_key" json:"id"`
+	Key string `json:"key"`
+	// The subject of the notification (used as the subject of the Email channel).
+	Subject string `json:"subject,omitempty"`
 	Message string `json:"message"`
+	// The severity of the notification.
+	Type NotificationType `json:"type"`
 	// The status of the notification.
 	Status NotificationStatus `json:"status"`
 	// The channels over which the notification should be delivered.
 	DeliveryChannel DeliveryChannel `json:"delivery_channel"`
-	CreatedAt       time.Time       `json:"created_at"`
+	// The id of the user whose inbox should receive the notification (used by the InApp channel).
+	UserId string `json:"user_id,omitempty"`
+	// The Slack channel to which the notification should be posted (used by the Slack Web API notifier).
+	SlackChannel string `json:"slack_channel,omitempty"`
+	// The name of the destination profile of the delivery channel; empty for the default destination.
+	Destination string `json:"destination,omitempty"`
+	// The provider of the delivery channel which delivered the notification.
+	Provider string `json:"provider,omitempty"`
+	// The id which the provider assigned to the sent message, e.g. the Slack message ts or the email Message-ID.
+	ProviderMessageId string `json:"provider_message_id,omitempty"`
+	// The response code of the provider to the last send, e.g. the HTTP status or the SMTP reply code.
+	ProviderResponseCode int `json:"provider_response_code,omitempty"`
+	// The count of the sends of the notification which have been attempted.
+	AttemptCount int `json:"attempt_count"`
+	// The time after which the pending notification is sent; it is postponed after a transient failure.
+	NextAttemptAt time.Time `gorm:"default:current_timestamp" json:"next_attempt_at"`
+	// The error of the last failed send.
+	LastError string `json:"last_error,omitempty"`
+	// The replica which has claimed the notification for sending, and the time until which the claim holds
+	// unless it is renewed. Set while the notification is processing.
+	LeaseOwner     string     `json:"lease_owner,omitempty"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+	// The id of the request which submitted the notification; passed on to the 3rd party services.
+	RequestId string `json:"request_id,omitempty"`
+	// Marks the notification as a resolution of the earlier notifications with the same key.
+	Resolved bool `json:"resolved"`
+	// The hash of the key, the delivery channel, the recipient and the content of the notification, by which
+	// the duplicates of the notification are found.
+	DeduplicationKey string `json:"-"`
+	// The original notification which the deduplicated notification repeats.
+	DuplicateOf *int `json:"duplicate_of,omitempty"`
+	// The files attached to the notification (used by the Email channel).
+	Attachments []Attachment `gorm:"foreignKey:NotificationId" json:"attachments,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
 }
 
 // TableName returns the table name of account struct and it is used by gorm.
@@ -50,6 +105,51 @@ func NewNotification(key string, message string, status NotificationStatus, deli
 	return &Notification{Key: key, Message: message, Status: status, DeliveryChannel: deliveryChannel}
 }
 
+// Recipient returns the recipient of the notification within its delivery channel: the destination profile, together
+// with the Slack channel of the Slack notifications and the user of the InApp ones.
+func (notification *Notification) Recipient() string {
+	switch notification.DeliveryChannel {
+	case Slack:
+		return notification.Destination + "#" + notification.SlackChannel
+	case InApp:
+		return notification.UserId
+	default:
+		return notification.Destination
+	}
+}
+
+// ComputeDeduplicationKey returns the hash of the key, the delivery channel and the recipient of the notification
+// together with the hash of its message, i.e. its subject, text, type, resolution and attachments.
+func (notification *Notification) ComputeDeduplicationKey() string {
+	message := sha256.New()
+	parts := []string{
+		notification.Subject,
+		notification.Message,
+		string(notification.Type),
+		strconv.FormatBool(notification.Resolved),
+	}
+	for _, attachment := range notification.Attachments {
+		parts = append(parts,
+			attachment.Filename,
+			attachment.ContentType,
+			strconv.FormatInt(attachment.Size, 10),
+			attachment.ContentIdentity(),
+		)
+	}
+	for _, part := range parts {
+		message.Write([]byte(part))
+		message.Write([]byte{0})
+	}
+
+	key := sha256.New()
+	for _, part := range []string{notification.Key, string(notification.DeliveryChannel), notification.Recipient()} {
+		key.Write([]byte(part))
+		key.Write([]byte{0})
+	}
+	key.Write(message.Sum(nil))
+	return hex.EncodeToString(key.Sum(nil))
+}
+
 func (notification *Notification) ToString() string {
 	return notification.Key + " " + notification.Message + " " + string(notification.DeliveryChannel)
 }
@@ -0,0 +1,28 @@
+package data
+
+import (
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/db"
+)
+
+// The first Slack message posted for a notification key in a channel.
+// Follow-up notifications with the same key are posted as replies in its thread.
+type SlackThread struct {
+	Id int `gorm:"primary_key" json:"id"`
+	// The name of the Slack destination profile in which the thread was started.
+	Destination string `json:"destination"`
+	Key         string `json:"key"`
+	// The channel as requested by the notification (name or id).
+	Channel string `json:"channel"`
+	// The id of the channel as returned by Slack; required for updating the message.
+	ChannelId string `json:"channel_id"`
+	// The timestamp of the message which identifies it in Slack.
+	Ts        string    `json:"ts"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName returns the table name of the slack thread struct and it is used by gorm.
+func (SlackThread) TableName() string {
+	return db.SCHEMA + "." + db.SLACK_THREAD_TABLE
+}
@@ -12,7 +12,89 @@ type APIError struct {
 
 // The input properties of a notification request.
 type NotificationInput struct {
-	Key              string                 `json:"Key"`
-	Message          string                 `json:"message" binding:"required"`
+	Key string `json:"Key"`
+	// The subject of the notification. Defaults to the key.
+	Subject string `json:"subject"`
+	Message string `json:"message" binding:"required"`
+	// The severity of the notification - Info, Warning or Error. Defaults to Info.
+	Type             data.NotificationType  `json:"type"`
 	DeliveryChannels []data.DeliveryChannel `json:"deliveryChannels"`
+	// The id of the user whose inbox should receive the notification. Required for the InApp channel.
+	UserId string `json:"userId"`
+	// The Slack channel to which the notification should be posted. Defaults to the configured channel.
+	SlackChannel string `json:"slackChannel"`
+	// Marks the notification as a resolution of the earlier notifications with the same key.
+	Resolved bool `json:"resolved"`
+	// The named destination profile per delivery channel, e.g. {"Slack": "payments_ops"}.
+	// The channels which are not listed are delivered to their default destination.
+	Destinations map[data.DeliveryChannel]string `json:"destinations"`
+	// Files attached to the notification (used by the Email channel).
+	Attachments []AttachmentInput `json:"attachments"`
+}
+
+// The payloads which would be sent for a notification input, per delivery channel.
+type NotificationPreview struct {
+	Channels []ChannelPreview `json:"channels"`
+}
+
+// The payload which would be sent over a delivery channel, or the error which would fail the send.
+type ChannelPreview struct {
+	DeliveryChannel data.DeliveryChannel `json:"deliveryChannel"`
+	// The destination and the provider through which the notification would be sent first.
+	Destination string `json:"destination,omitempty"`
+	Provider    string `json:"provider,omitempty"`
+	// The recipients, e.g. the email addresses, the Slack channel, the user or the queue subject.
+	Recipients  []string `json:"recipients,omitempty"`
+	ContentType string   `json:"contentType,omitempty"`
+	// The email MIME message as a string, or the JSON payload embedded as it is.
+	Payload any    `json:"payload,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// A file attached to a notification. The content is either given inline as base64
+// or it is referenced by the id of a blob uploaded in advance.
+type AttachmentInput struct {
+	Filename    string `json:"filename" binding:"required"`
+	ContentType string `json:"contentType" binding:"required"`
+	Content     string `json:"content"`
+	BlobId      string `json:"blobId"`
+}
+
+// The result of uploading the content of an attachment.
+type UploadedBlob struct {
+	BlobId      string `json:"blobId"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// A page of the inbox of a user.
+type InboxPage struct {
+	Items       []data.InboxItem `json:"items"`
+	Page        int              `json:"page"`
+	PageSize    int              `json:"pageSize"`
+	Total       int64            `json:"total"`
+	UnreadCount int64            `json:"unreadCount"`
+}
+
+// The result of marking all inbox items of a user as read.
+type MarkAllReadResult struct {
+	Updated int64 `json:"updated"`
+}
+
+// A page of the dead-letter queue.
+type DeadLetterPage struct {
+	Items    []data.DeadLetter `json:"items"`
+	Page     int               `json:"page"`
+	PageSize int               `json:"pageSize"`
+	Total    int64             `json:"total"`
+}
+
+// The result of replaying dead letters - the ids of the notifications which are sent again.
+type ReplayResult struct {
+	NotificationIds []int `json:"notificationIds"`
+}
+
+// The result of purging dead letters.
+type PurgeResult struct {
+	Purged int64 `json:"purged"`
 }
@@ -0,0 +1,177 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/db"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const deliveryAttemptsAssociation = "Attempts"
+
+// DeadLetterFilter selects dead letters; the empty fields do not restrict the selection.
+type DeadLetterFilter struct {
+	Ids             []int
+	DeliveryChannel data.DeliveryChannel
+	Key             string
+	Destination     string
+	// The range of the times at which the notifications were dead-lettered.
+	From time.Time
+	To   time.Time
+}
+
+// IsEmpty reports whether the filter selects all dead letters.
+func (filter DeadLetterFilter) IsEmpty() bool {
+	return len(filter.Ids) == 0 && filter.DeliveryChannel == "" && filter.Key == "" && filter.Destination == "" &&
+		filter.From.IsZero() && filter.To.IsZero()
+}
+
+type DeadLetterRepository interface {
+	Add(notification *data.Notification, deadLetter *data.DeadLetter) error
+	Count() (int64, error)
+	FindAll(filter DeadLetterFilter, offset int, limit int) (*[]data.DeadLetter, int64, error)
+	FindById(id int) (*data.DeadLetter, error)
+	Replay(filter DeadLetterFilter, now time.Time) ([]int, error)
+	Purge(filter DeadLetterFilter) (int64, error)
+}
+
+type deadLetterRepository struct {
+	dbClient db.DbClient
+}
+
+func NewDeadLetterRepository(dbClient db.DbClient) DeadLetterRepository {
+	return &deadLetterRepository{
+		dbClient: dbClient,
+	}
+}
+
+// Add saves the claimed dead-lettered notification and stores its dead letter in a single transaction.
+// Returns ErrLeaseLost if the notification is no longer claimed by the owner of its lease.
+func (repository *deadLetterRepository) Add(notification *data.Notification, deadLetter *data.DeadLetter) error {
+	return repository.dbClient.Transaction(func(tx db.DbClient) error {
+		if err := saveClaimed(tx, notification); err != nil {
+			return err
+		}
+		return tx.Create(deadLetter).Error
+	})
+}
+
+// Count returns the size of the dead-letter queue.
+func (repository *deadLetterRepository) Count() (int64, error) {
+	var count int64
+	if err := repository.dbClient.Model(&data.DeadLetter{}).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// FindAll returns a page of the selected dead letters, oldest first, together with the total count of them.
+func (repository *deadLetterRepository) FindAll(filter DeadLetterFilter, offset int, limit int) (*[]data.DeadLetter, int64, error) {
+	var total int64
+	if err := filteredDeadLetters(repository.dbClient, filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var deadLetters []data.DeadLetter
+	err := filteredDeadLetters(repository.dbClient, filter).
+		Order("created_at, id").
+		Offset(offset).
+		Limit(limit).
+		Find(&deadLetters).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return &deadLetters, total, nil
+}
+
+// FindById returns the dead letter with its notification and the attachments of it, together with the delivery
+// attempts of the notification in the order in which they were made. Returns nil if no such dead letter exists.
+func (repository *deadLetterRepository) FindById(id int) (*data.DeadLetter, error) {
+	var deadLetter data.DeadLetter
+	err := repository.dbClient.
+		Preload("Notification."+attachmentsAssociation).
+		Preload(deliveryAttemptsAssociation, func(query *gorm.DB) *gorm.DB { return query.Order("attempt_number") }).
+		First(&deadLetter, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &deadLetter, nil
+}
+
+// Replay removes the selected dead letters and returns their notifications to pending with a new budget
+// of attempts, due at the given time. The last error is cleared, while the earlier failures are kept in the delivery
+// attempts of the notifications. Returns the ids of the replayed notifications.
+func (repository *deadLetterRepository) Replay(filter DeadLetterFilter, now time.Time) ([]int, error) {
+	return repository.remove(filter, map[string]interface{}{
+		"status":          data.Pending,
+		"attempt_count":   0,
+		"next_attempt_at": now,
+		"last_error":      "",
+	})
+}
+
+// Purge removes the selected dead letters and fails their notifications. Returns the count of the purged ones.
+func (repository *deadLetterRepository) Purge(filter DeadLetterFilter) (int64, error) {
+	notificationIds, err := repository.remove(filter, map[string]interface{}{"status": data.Failed})
+	return int64(len(notificationIds)), err
+}
+
+// Removes the selected dead letters and applies the updates to their notifications in a single transaction.
+// The selected dead letters are locked, so a dead letter is not replayed or purged twice concurrently.
+func (repository *deadLetterRepository) remove(filter DeadLetterFilter, updates map[string]interface{}) ([]int, error) {
+	var notificationIds []int
+	err := repository.dbClient.Transaction(func(tx db.DbClient) error {
+		var deadLetters []data.DeadLetter
+		err := filteredDeadLetters(tx, filter).Clauses(clause.Locking{Strength: "UPDATE"}).Find(&deadLetters).Error
+		if err != nil || len(deadLetters) == 0 {
+			return err
+		}
+
+		ids := make([]int, len(deadLetters))
+		notificationIds = make([]int, len(deadLetters))
+		for i, deadLetter := range deadLetters {
+			ids[i] = deadLetter.Id
+			notificationIds[i] = deadLetter.NotificationId
+		}
+
+		err = tx.Model(&data.Notification{}).Where("id IN ?", notificationIds).Updates(updates).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&data.DeadLetter{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notificationIds, nil
+}
+
+// Returns a query over the dead letters selected by the filter.
+func filteredDeadLetters(dbClient db.DbClient, filter DeadLetterFilter) *gorm.DB {
+	query := dbClient.Model(&data.DeadLetter{})
+	if len(filter.Ids) > 0 {
+		query = query.Where("id IN ?", filter.Ids)
+	}
+	if filter.DeliveryChannel != "" {
+		query = query.Where("delivery_channel = ?", filter.DeliveryChannel)
+	}
+	if filter.Key != "" {
+		query = query.Where("key = ?", filter.Key)
+	}
+	if filter.Destination != "" {
+		query = query.Where("destination = ?", filter.Destination)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	return query
+}
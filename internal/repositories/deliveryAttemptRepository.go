@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"github.com/plyovchev/notifications-service/internal/db"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+)
+
+type DeliveryAttemptRepository interface {
+	Add(attempt *data.DeliveryAttempt) error
+	FindAllByNotificationId(notificationId int) (*[]data.DeliveryAttempt, error)
+}
+
+type deliveryAttemptRepository struct {
+	dbClient db.DbClient
+}
+
+func NewDeliveryAttemptRepository(dbClient db.DbClient) DeliveryAttemptRepository {
+	return &deliveryAttemptRepository{
+		dbClient: dbClient,
+	}
+}
+
+// Add stores the attempt as the next attempt of its notification and assigns its attempt number.
+// The attempts of a notification are not added concurrently, as a notification is sent only by the owner of its lease.
+func (repository *deliveryAttemptRepository) Add(attempt *data.DeliveryAttempt) error {
+	return repository.dbClient.Transaction(func(tx db.DbClient) error {
+		var lastAttemptNumber int
+		err := tx.Model(&data.DeliveryAttempt{}).
+			Where("notification_id = ?", attempt.NotificationId).
+			Select("COALESCE(MAX(attempt_number), 0)").
+			Scan(&lastAttemptNumber).Error
+		if err != nil {
+			return err
+		}
+
+		attempt.AttemptNumber = lastAttemptNumber + 1
+		return tx.Create(attempt).Error
+	})
+}
+
+// FindAllByNotificationId returns the attempts of the notification in the order in which they were made.
+func (repository *deliveryAttemptRepository) FindAllByNotificationId(notificationId int) (*[]data.DeliveryAttempt, error) {
+	var attempts []data.DeliveryAttempt
+	err := repository.dbClient.
+		Where("notification_id = ?", notificationId).
+		Order("attempt_number").
+		Find(&attempts).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attempts, nil
+}
@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/db"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InboxRepository interface {
+	Deliver(ctx context.Context, notification *data.Notification) (*data.InboxItem, error)
+	FindAllByUserId(userId string, offset int, limit int) (*[]data.InboxItem, int64, error)
+	CountUnread(userId string) (int64, error)
+	MarkRead(userId string, itemId int) (bool, error)
+	MarkAllRead(userId string) (int64, error)
+	Archive(userId string, itemId int) (bool, error)
+}
+
+type inboxRepository struct {
+	dbClient db.DbClient
+}
+
+func NewInboxRepository(dbClient db.DbClient) InboxRepository {
+	return &inboxRepository{
+		dbClient: dbClient,
+	}
+}
+
+// Deliver stores the notification in the inbox of its user. The notification itself is not updated, as its result
+// is saved by the notification service under the lease of its claim, like the results of the other channels.
+// A notification which is sent again, because its result could not be saved, gets the item stored by the earlier
+// send, so the user has a single inbox item per notification.
+func (repository *inboxRepository) Deliver(ctx context.Context, notification *data.Notification) (*data.InboxItem, error) {
+	item := data.NewInboxItem(notification)
+	result := repository.dbClient.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "notification_id"}}, DoNothing: true}).
+		Create(item)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return item, nil
+	}
+
+	var existing data.InboxItem
+	if err := repository.dbClient.WithContext(ctx).Where("notification_id = ?", notification.Id).First(&existing).Error; err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// FindAllByUserId returns a page of the non-archived inbox items of the user, newest first,
+// together with the total count of the non-archived items.
+func (repository *inboxRepository) FindAllByUserId(userId string, offset int, limit int) (*[]data.InboxItem, int64, error) {
+	var total int64
+	if err := repository.activeItems(userId).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var items []data.InboxItem
+	err := repository.activeItems(userId).
+		Order("created_at DESC, id DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&items).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return &items, total, nil
+}
+
+// CountUnread returns the count of the non-archived inbox items of the user which are not read yet.
+func (repository *inboxRepository) CountUnread(userId string) (int64, error) {
+	var count int64
+	if err := repository.activeItems(userId).Where("read_at IS NULL").Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// MarkRead marks the inbox item as read. Returns false if the user has no such item.
+func (repository *inboxRepository) MarkRead(userId string, itemId int) (bool, error) {
+	result := repository.dbClient.Model(&data.InboxItem{}).
+		Where("id = ? AND user_id = ?", itemId, userId).
+		Update("read_at", gorm.Expr("COALESCE(read_at, ?)", time.Now().UTC()))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// MarkAllRead marks all unread non-archived inbox items of the user as read.
+// Returns the count of the updated items.
+func (repository *inboxRepository) MarkAllRead(userId string) (int64, error) {
+	result := repository.activeItems(userId).
+		Where("read_at IS NULL").
+		Update("read_at", time.Now().UTC())
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// Archive hides the inbox item from the inbox of the user. Returns false if the user has no such item.
+func (repository *inboxRepository) Archive(userId string, itemId int) (bool, error) {
+	result := repository.dbClient.Model(&data.InboxItem{}).
+		Where("id = ? AND user_id = ?", itemId, userId).
+		Update("archived_at", gorm.Expr("COALESCE(archived_at, ?)", time.Now().UTC()))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Returns a query over the non-archived inbox items of the user.
+func (repository *inboxRepository) activeItems(userId string) *gorm.DB {
+	return repository.dbClient.Model(&data.InboxItem{}).Where("user_id = ? AND archived_at IS NULL", userId)
+}
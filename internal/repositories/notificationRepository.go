@@ -1,16 +1,50 @@
 package repositories
 
 import (
+	"errors"
+	"time"
+
 	"github.com/plyovchev/notifications-service/internal/db"
 	"github.com/plyovchev/notifications-service/internal/models/data"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+const attachmentsAssociation = "Attachments"
+
+// ErrLeaseLost is returned when the result of a claimed notification is saved by a replica whose claim
+// has expired and has been released, so the notification might be claimed by another replica.
+var ErrLeaseLost = errors.New("the lease of the notification has been lost")
+
+// ErrLeaseExpired is stored as the last error of a notification whose lease has expired before its send completed.
+var ErrLeaseExpired = errors.New("the lease of the notification has expired before its send completed")
+
+// Claim selects the due pending notifications of a delivery channel which a replica takes for sending.
+type Claim struct {
+	DeliveryChannel data.DeliveryChannel
+	// Restricts the claim to the notifications with the ids; all due notifications are claimed when it is empty.
+	Ids []int
+	// The maximum count of the claimed notifications.
+	Limit int
+	Now   time.Time
+	// The id of the claiming replica and the time for which the claim holds.
+	Owner         string
+	LeaseDuration time.Duration
+}
+
 type NotificationRepository interface {
 	Create(notification *data.Notification) (*data.Notification, error)
+	CreateUnlessDuplicate(notification *data.Notification, window time.Duration) (*data.Notification, error)
 	FindAll() (*[]data.Notification, error)
+	FindById(id int) (*data.Notification, error)
 	FindAllByIds(ids []int) (*[]data.Notification, error)
 	FindAllByStatus(status data.NotificationStatus) (*[]data.Notification, error)
 	Save(notification *data.Notification) (*data.Notification, error)
+	ClaimDue(claim Claim) (*[]data.Notification, error)
+	SaveClaimed(notification *data.Notification) error
+	RenewLeases(owner string, ids []int, leaseDuration time.Duration) error
+	ReleaseLeases(owner string) (int64, error)
+	ReleaseExpiredLeases() (int64, error)
 }
 
 type noticationRepository struct {
@@ -23,7 +57,7 @@ func NewNotificationRepository(dbClient db.DbClient) NotificationRepository {
 	}
 }
 
-// Create persists this notification data.
+// Create persists this notification data together with its attachments.
 func (repository *noticationRepository) Create(notification *data.Notification) (*data.Notification, error) {
 	if err := repository.dbClient.Create(notification).Error; err != nil {
 		return nil, err
@@ -31,6 +65,47 @@ func (repository *noticationRepository) Create(notification *data.Notification)
 	return notification, nil
 }
 
+// CreateUnlessDuplicate persists the notification unless it repeats an original notification with the same
+// deduplication key which has been created within the window. The window is measured by the clock of the database,
+// so the replicas agree on it regardless of the skew of their clocks. A duplicate is persisted as 'deduplicated'
+// pointing to its original, without its attachments, and the original is returned; otherwise the created notification
+// is returned.
+func (repository *noticationRepository) CreateUnlessDuplicate(
+	notification *data.Notification,
+	window time.Duration,
+) (*data.Notification, error) {
+	original := notification
+	err := repository.dbClient.Transaction(func(tx db.DbClient) error {
+		// The creation of the notifications with the same key is serialized, so the concurrent duplicates pushed
+		// to different replicas find their original.
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", notification.DeduplicationKey).Error; err != nil {
+			return err
+		}
+
+		var originals []data.Notification
+		err := tx.Where("deduplication_key = ? AND duplicate_of IS NULL AND created_at >= now() - make_interval(secs => ?)",
+			notification.DeduplicationKey, window.Seconds()).
+			Order("id").
+			Limit(1).
+			Find(&originals).Error
+		if err != nil {
+			return err
+		}
+		if len(originals) > 0 {
+			original = &originals[0]
+			notification.Status = data.Deduplicated
+			notification.DuplicateOf = &original.Id
+			// The duplicate is never sent, so its attachments are not stored.
+			notification.Attachments = nil
+		}
+		return tx.Create(notification).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return original, nil
+}
+
 // FindAll returns all notification of the notification table.
 func (repository *noticationRepository) FindAll() (*[]data.Notification, error) {
 	var notifications []data.Notification
@@ -40,28 +115,157 @@ func (repository *noticationRepository) FindAll() (*[]data.Notification, error)
 	return &notifications, nil
 }
 
-// Returns all notifications in specified status.
+// FindById returns the notification with its attachments. Returns nil if no such notification exists.
+func (repository *noticationRepository) FindById(id int) (*data.Notification, error) {
+	var notification data.Notification
+	err := repository.dbClient.Preload(attachmentsAssociation).First(&notification, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// Returns all notifications with the specified ids together with their attachments.
 func (repository *noticationRepository) FindAllByIds(ids []int) (*[]data.Notification, error) {
 	var notifications []data.Notification
-	if err := repository.dbClient.Find(&notifications, ids).Error; err != nil {
+	if err := repository.dbClient.Preload(attachmentsAssociation).Find(&notifications, ids).Error; err != nil {
 		return nil, err
 	}
 	return &notifications, nil
 }
 
-// Returns all notifications in specified status.
+// Returns all notifications in specified status together with their attachments.
 func (repository *noticationRepository) FindAllByStatus(status data.NotificationStatus) (*[]data.Notification, error) {
 	var notifications []data.Notification
-	if err := repository.dbClient.Where("status = (?)", status).Find(&notifications).Error; err != nil {
+	err := repository.dbClient.Preload(attachmentsAssociation).Where("status = (?)", status).Find(&notifications).Error
+	if err != nil {
 		return nil, err
 	}
 	return &notifications, nil
 }
 
-// Save persists this notification data.
+// Save persists this notification data. The attachments are immutable and they are not saved.
 func (repository *noticationRepository) Save(notification *data.Notification) (*data.Notification, error) {
-	if err := repository.dbClient.Save(notification).Error; err != nil {
+	if err := repository.dbClient.Omit(clause.Associations).Save(notification).Error; err != nil {
 		return nil, err
 	}
 	return notification, nil
 }
+
+// ClaimDue atomically moves the due pending notifications of the claim to processing under the lease of the owner
+// and returns them together with their attachments, the earliest due first. The rows which are locked
+// by the concurrent claims of other replicas are skipped, so a notification is claimed by a single replica.
+// The leases are measured by the clock of the database, so the replicas agree on their expiry regardless of the skew
+// of their clocks.
+func (repository *noticationRepository) ClaimDue(claim Claim) (*[]data.Notification, error) {
+	table := data.Notification{}.TableName()
+	idsCondition := ""
+	if len(claim.Ids) > 0 {
+		idsCondition = " AND id IN @ids"
+	}
+
+	var ids []int
+	err := repository.dbClient.Raw(
+		"UPDATE "+table+" SET status = @processing, lease_owner = @owner,"+
+			" lease_expires_at = now() + make_interval(secs => @leaseSeconds)"+
+			" WHERE id IN (SELECT id FROM "+table+
+			" WHERE status = @pending AND delivery_channel = @deliveryChannel AND next_attempt_at <= @now"+idsCondition+
+			" ORDER BY next_attempt_at LIMIT @limit FOR UPDATE SKIP LOCKED)"+
+			" RETURNING id",
+		map[string]interface{}{
+			"processing":      data.Processing,
+			"pending":         data.Pending,
+			"owner":           claim.Owner,
+			"leaseSeconds":    claim.LeaseDuration.Seconds(),
+			"deliveryChannel": claim.DeliveryChannel,
+			"now":             claim.Now,
+			"ids":             claim.Ids,
+			"limit":           claim.Limit,
+		},
+	).Scan(&ids).Error
+	if err != nil {
+		return nil, err
+	}
+
+	notifications := []data.Notification{}
+	if len(ids) == 0 {
+		return &notifications, nil
+	}
+	err = repository.dbClient.Preload(attachmentsAssociation).Order("next_attempt_at").Find(&notifications, ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return &notifications, nil
+}
+
+// SaveClaimed saves the result of the attempt of a claimed notification and releases its lease.
+// Returns ErrLeaseLost if the notification is no longer claimed by the owner of its lease.
+func (repository *noticationRepository) SaveClaimed(notification *data.Notification) error {
+	return saveClaimed(repository.dbClient, notification)
+}
+
+// RenewLeases extends the leases of the notifications which are still claimed by the owner to the duration from now.
+func (repository *noticationRepository) RenewLeases(owner string, ids []int, leaseDuration time.Duration) error {
+	return repository.dbClient.Model(&data.Notification{}).
+		Where("id IN ? AND status = ? AND lease_owner = ?", ids, data.Processing, owner).
+		Update("lease_expires_at", gorm.Expr("now() + make_interval(secs => ?)", leaseDuration.Seconds())).Error
+}
+
+// ReleaseLeases returns the notifications claimed by the owner to pending, e.g. when the owner stops.
+// Returns the count of the released notifications.
+func (repository *noticationRepository) ReleaseLeases(owner string) (int64, error) {
+	return releaseLeases(repository.dbClient.Model(&data.Notification{}).
+		Where("status = ? AND lease_owner = ?", data.Processing, owner), releasedColumns())
+}
+
+// ReleaseExpiredLeases returns the notifications whose leases have expired, e.g. after a crash of their owner,
+// to pending. The expiry counts as an attempt, so a notification which crashes or hangs its replica on every send
+// exhausts its attempts instead of being claimed forever. Returns the count of the released notifications.
+func (repository *noticationRepository) ReleaseExpiredLeases() (int64, error) {
+	columns := releasedColumns()
+	columns["attempt_count"] = gorm.Expr("attempt_count + 1")
+	columns["last_error"] = ErrLeaseExpired.Error()
+	return releaseLeases(repository.dbClient.Model(&data.Notification{}).
+		Where("status = ? AND lease_expires_at < now()", data.Processing), columns)
+}
+
+// Returns the columns of the notifications which are returned to pending.
+func releasedColumns() map[string]interface{} {
+	return map[string]interface{}{
+		"status":           data.Pending,
+		"lease_owner":      nil,
+		"lease_expires_at": nil,
+	}
+}
+
+func releaseLeases(query *gorm.DB, columns map[string]interface{}) (int64, error) {
+	result := query.Updates(columns)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// Saves all columns of the claimed notification except its attachments and clears its lease, unless the lease
+// has been lost in the meantime.
+func saveClaimed(dbClient db.DbClient, notification *data.Notification) error {
+	owner := notification.LeaseOwner
+	notification.LeaseOwner = ""
+	notification.LeaseExpiresAt = nil
+
+	result := dbClient.Model(notification).
+		Where("status = ? AND lease_owner = ?", data.Processing, owner).
+		Select("*").
+		Omit(clause.Associations).
+		Updates(notification)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/plyovchev/notifications-service/internal/db"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"gorm.io/gorm"
+)
+
+type SlackThreadRepository interface {
+	Create(ctx context.Context, thread *data.SlackThread) (*data.SlackThread, error)
+	FindByDestinationKeyAndChannel(ctx context.Context, destination string, key string, channel string) (*data.SlackThread, error)
+}
+
+type slackThreadRepository struct {
+	dbClient db.DbClient
+}
+
+func NewSlackThreadRepository(dbClient db.DbClient) SlackThreadRepository {
+	return &slackThreadRepository{
+		dbClient: dbClient,
+	}
+}
+
+// Create persists this slack thread data.
+func (repository *slackThreadRepository) Create(ctx context.Context, thread *data.SlackThread) (*data.SlackThread, error) {
+	if err := repository.dbClient.WithContext(ctx).Create(thread).Error; err != nil {
+		return nil, err
+	}
+	return thread, nil
+}
+
+// FindByDestinationKeyAndChannel returns the thread started for the notification key in the channel of the destination.
+// Returns nil if no such thread exists.
+func (repository *slackThreadRepository) FindByDestinationKeyAndChannel(
+	ctx context.Context,
+	destination string,
+	key string,
+	channel string,
+) (*data.SlackThread, error) {
+	var thread data.SlackThread
+	err := repository.dbClient.WithContext(ctx).Where("destination = ? AND key = ? AND channel = ?", destination, key, channel).First(&thread).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
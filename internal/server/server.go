@@ -1,15 +1,20 @@
 package server
 
 import (
+	"context"
 	"io"
+	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gin-contrib/gzip"
+	"github.com/plyovchev/notifications-service/internal/blobstore"
 	"github.com/plyovchev/notifications-service/internal/config"
 	"github.com/plyovchev/notifications-service/internal/db"
 	"github.com/plyovchev/notifications-service/internal/logger"
 	"github.com/plyovchev/notifications-service/internal/repositories"
 	"github.com/plyovchev/notifications-service/internal/services"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
 
 	"github.com/gin-gonic/gin"
 	"github.com/plyovchev/notifications-service/internal/handlers"
@@ -19,17 +24,90 @@ import (
 
 var startOnce sync.Once
 
-func StartService(serviceEnv config.ServiceEnv, cfg *config.Config, lgr *logger.AppLogger) {
+// The router of the service together with the components which are stopped when the service is shut down.
+type application struct {
+	router              *gin.Engine
+	notificationService services.NotificationsService
+	notifierRegistry    *notifiers.Registry
+	dbClient            db.DbClient
+}
+
+// StartService serves the APIs until the context is done, e.g. on a termination signal. The service then stops
+// accepting requests, while the requests in progress and the claimed notifications are finished within
+// the shutdown grace period. The notifiers and the database connections are closed last.
+func StartService(ctx context.Context, serviceEnv config.ServiceEnv, cfg *config.Config, lgr *logger.AppLogger) {
 	startOnce.Do(func() {
-		r := WebRouter(serviceEnv, cfg, lgr)
-		err := r.Run(":" + serviceEnv.Port)
-		if err != nil {
+		app := newApplication(serviceEnv, cfg, lgr)
+		// Start the notification service, which sends the stored notifications and dead-letters the exhausted ones
+		app.notificationService.StartNotificationService()
+		httpServer := &http.Server{
+			Addr:    ":" + serviceEnv.Port,
+			Handler: app.router,
+			// A slow or stalled client does not hold its connection, which would also delay the shutdown.
+			ReadHeaderTimeout: cfg.ServerReadHeaderTimeout(),
+			ReadTimeout:       cfg.ServerReadTimeout(),
+			IdleTimeout:       cfg.ServerIdleTimeout(),
+		}
+
+		served := make(chan error, 1)
+		go func() {
+			served <- httpServer.ListenAndServe()
+		}()
+
+		select {
+		case err := <-served:
 			panic(err)
+		case <-ctx.Done():
 		}
+
+		lgr.Info().Dur("gracePeriod", cfg.ShutdownGracePeriod()).Msg("Shutting down the service")
+		app.shutdown(httpServer, cfg.ShutdownGracePeriod(), lgr)
 	})
 }
 
-func WebRouter(serviceEnv config.ServiceEnv, cfg *config.Config, lgr *logger.AppLogger) *gin.Engine {
+// Stops accepting requests and drains the requests and the sends in progress side by side, then closes
+// the notifiers and the database connections.
+func (app *application) shutdown(httpServer *http.Server, gracePeriod time.Duration, lgr *logger.AppLogger) {
+	var draining sync.WaitGroup
+	draining.Add(2)
+	go func() {
+		defer draining.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			lgr.Warn().Err(err).Msg("The requests in progress have not finished within the shutdown grace period.")
+			_ = httpServer.Close()
+		}
+	}()
+	go func() {
+		defer draining.Done()
+		app.notificationService.StopNotificationService()
+	}()
+	draining.Wait()
+	app.close(lgr)
+}
+
+// Closes the notifiers and the database connections.
+func (app *application) close(lgr *logger.AppLogger) {
+	if err := app.notifierRegistry.Close(); err != nil {
+		lgr.Error().Err(err).Msg("Failed to close the notifiers")
+	}
+	if app.dbClient != nil {
+		if err := app.dbClient.Close(); err != nil {
+			lgr.Error().Err(err).Msg("Failed to close the database connections")
+		}
+	}
+}
+
+// WebRouter returns the router of the service without starting its notification service, together with the function
+// which closes the notifiers and the database connections of the router.
+func WebRouter(serviceEnv config.ServiceEnv, cfg *config.Config, lgr *logger.AppLogger) (*gin.Engine, func()) {
+	app := newApplication(serviceEnv, cfg, lgr)
+	return app.router, func() { app.close(lgr) }
+}
+
+// Builds the router of the service and its components; the notification service is not started yet.
+func newApplication(serviceEnv config.ServiceEnv, cfg *config.Config, lgr *logger.AppLogger) *application {
 	ginMode := gin.ReleaseMode
 	if util.IsDevMode(serviceEnv.Name) {
 		ginMode = gin.DebugMode
@@ -47,12 +125,53 @@ func WebRouter(serviceEnv config.ServiceEnv, cfg *config.Config, lgr *logger.App
 	router.Use(middleware.RequestLogMiddleware(lgr))
 	router.Use(gin.Recovery())
 
-	status := handlers.NewStatusHandler(lgr)
-	router.GET("/status", status.CheckStatus) // /status
-
 	// Instantiate a DB client
 	dbClient := db.NewDBClient(db.SCHEMA, lgr, cfg)
 
+	// Instantiate the store for the content of the attachments
+	blobStore, err := blobstore.NewBlobStore(cfg.Attachments.Store, cfg.Attachments.LocalPath)
+	if err != nil {
+		lgr.Fatal().Err(err).Msg("Failed to create the attachments blob store")
+	}
+	attachmentsService := services.NewAttachmentsService(blobStore, cfg, lgr)
+
+	notificationRepository := repositories.NewNotificationRepository(dbClient)
+	inboxRepository := repositories.NewInboxRepository(dbClient)
+
+	// Build the notifiers of the configured delivery channels
+	notifierDependencies := notifiers.Dependencies{
+		InboxRepository:       inboxRepository,
+		SlackThreadRepository: repositories.NewSlackThreadRepository(dbClient),
+		BlobStore:             blobStore,
+	}
+	var notifierRegistry *notifiers.Registry
+	if cfg.Sink.CaptureAllChannels && util.IsDevMode(serviceEnv.Name) {
+		notifierRegistry, err = notifiers.NewCapturingRegistry(cfg, lgr)
+	} else {
+		if cfg.Sink.CaptureAllChannels {
+			lgr.Warn().Msg("Capturing all delivery channels by the sink is ignored outside of the development environments.")
+		}
+		notifierRegistry, err = notifiers.NewRegistry(cfg, notifierDependencies, lgr)
+	}
+	if err != nil {
+		lgr.Fatal().Err(err).Msg("Failed to create the notifiers")
+	}
+
+	// The notification service sends the stored notifications and dead-letters the exhausted ones
+	deadLetterQueue := services.NewDeadLetterQueue(
+		repositories.NewDeadLetterRepository(dbClient), notifierRegistry, blobStore, cfg, lgr)
+	// Every replica listens for the notifications created by the other replicas
+	var listener services.Listener
+	if cfg.Database.Dialect == db.POSTGRES {
+		listener = db.NewListener(cfg)
+	}
+	attemptRepository := repositories.NewDeliveryAttemptRepository(dbClient)
+	notificationService := services.NewNotificationService(
+		notificationRepository, attemptRepository, deadLetterQueue, listener, notifierRegistry, cfg, lgr)
+
+	status := handlers.NewStatusHandler(notifierRegistry, lgr)
+	router.GET("/status", status.CheckStatus) // /status
+
 	// Routes - notifications
 	externalAPIGrp := router.Group("/public-api/v1")
 	externalAPIGrp.Use(middleware.AuthMiddleware())
@@ -60,11 +179,53 @@ func WebRouter(serviceEnv config.ServiceEnv, cfg *config.Config, lgr *logger.App
 	{
 		notificationsGroup := externalAPIGrp.Group("notifications")
 		{
-			notifications := createNotificationHander(dbClient, cfg, lgr)
+			notifications := handlers.NewNotificationsHandler(
+				cfg, notificationService, attachmentsService, notifierRegistry, notificationRepository, attemptRepository, lgr)
 			notificationsGroup.POST("/push-notification", notifications.PushNotification)
+			notificationsGroup.POST("/preview", notifications.PreviewNotification)
+			notificationsGroup.GET("/:id", notifications.GetNotification)
+			notificationsGroup.GET("/:id/attempts", notifications.GetNotificationAttempts)
+		}
+
+		attachmentsGroup := externalAPIGrp.Group("attachments")
+		{
+			attachments := handlers.NewAttachmentsHandler(attachmentsService, lgr)
+			attachmentsGroup.POST("", attachments.Upload)
+		}
+
+		inboxGroup := externalAPIGrp.Group("inbox")
+		{
+			inbox := handlers.NewInboxHandler(cfg, inboxRepository, lgr)
+			inboxGroup.GET("/:userId", inbox.GetInbox)
+			inboxGroup.POST("/:userId/read-all", inbox.MarkAllRead)
+			inboxGroup.POST("/:userId/items/:itemId/read", inbox.MarkRead)
+			inboxGroup.POST("/:userId/items/:itemId/archive", inbox.Archive)
 		}
 	}
 
+	// Routes - administration
+	adminApiKeys := cfg.AdminApiKeys()
+	if len(adminApiKeys) == 0 {
+		lgr.Warn().Msg("No admin API keys are configured; the admin APIs reject all requests.")
+	}
+	adminAPIGrp := router.Group("/admin-api/v1")
+	adminAPIGrp.Use(middleware.AdminAuthMiddleware(adminApiKeys, lgr))
+	adminAPIGrp.Use(middleware.QueryParamsCheckMiddleware(lgr))
+	{
+		deadLettersGroup := adminAPIGrp.Group("dead-letters")
+		{
+			deadLetters := handlers.NewDeadLettersHandler(deadLetterQueue, notificationService, lgr)
+			deadLettersGroup.GET("", deadLetters.ListDeadLetters)
+			deadLettersGroup.GET("/:id", deadLetters.GetDeadLetter)
+			deadLettersGroup.POST("/replay", deadLetters.ReplayDeadLetters)
+			deadLettersGroup.POST("/:id/replay", deadLetters.ReplayDeadLetter)
+			deadLettersGroup.DELETE("", deadLetters.PurgeDeadLetters)
+			deadLettersGroup.DELETE("/:id", deadLetters.PurgeDeadLetter)
+		}
+
+		adminAPIGrp.GET("/circuits", status.ListCircuits)
+	}
+
 	lgr.Info().Msg("Registered routes")
 	for _, item := range router.Routes() {
 		lgr.Info().
@@ -72,14 +233,10 @@ func WebRouter(serviceEnv config.ServiceEnv, cfg *config.Config, lgr *logger.App
 			Str("path", item.Path).
 			Send()
 	}
-	return router
-}
-
-func createNotificationHander(dbClient db.DbClient, cfg *config.Config, lgr *logger.AppLogger) *handlers.NotificationsHandler {
-	repository := repositories.NewNotificationRepository(dbClient)
-
-	notificationService := services.NewNotificationService(repository, cfg, lgr)
-	notificationService.StartNotificationService()
-
-	return handlers.NewNotificationsHandler(cfg, notificationService, repository, lgr)
+	return &application{
+		router:              router,
+		notificationService: notificationService,
+		notifierRegistry:    notifierRegistry,
+		dbClient:            dbClient,
+	}
 }
@@ -14,8 +14,10 @@ import (
 func TestListOfRoutes(t *testing.T) {
 	serviceEnv := config.ServiceEnv{Name: "test"}
 	config := &config.Config{}
+	config.Attachments.LocalPath = t.TempDir()
 	lgr := logger.Setup(serviceEnv)
-	router := server.WebRouter(serviceEnv, config, lgr)
+	router, closeRouter := server.WebRouter(serviceEnv, config, lgr)
+	t.Cleanup(closeRouter)
 	list := router.Routes()
 	mode := gin.Mode()
 
@@ -25,6 +27,26 @@ func TestListOfRoutes(t *testing.T) {
 		Method: http.MethodGet,
 		Path:   "/status",
 	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   "/public-api/v1/inbox/:userId",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   "/public-api/v1/notifications/:id/attempts",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodPost,
+		Path:   "/admin-api/v1/dead-letters/:id/replay",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   "/admin-api/v1/circuits",
+	})
 }
 
 func assertRoutePresent(t *testing.T, gotRoutes gin.RoutesInfo, wantRoute gin.RouteInfo) {
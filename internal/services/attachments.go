@@ -0,0 +1,222 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"slices"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/models/external"
+)
+
+const (
+	defaultMaxAttachmentSize      = 10 << 20
+	maxAttachmentsPerNotification = 10
+	attachmentFilenameMaxLength   = 255
+	attachmentContentTypeError    = "invalid attachment content type"
+)
+
+var defaultAllowedAttachmentTypes = []string{
+	"application/pdf",
+	"application/zip",
+	"text/csv",
+	"text/plain",
+	"image/png",
+	"image/jpeg",
+}
+
+// An attachment which violates the limits or references a missing blob.
+type AttachmentError struct {
+	Message string
+}
+
+func (err *AttachmentError) Error() string {
+	return err.Message
+}
+
+type AttachmentsService interface {
+	Upload(content io.Reader, contentType string) (*external.UploadedBlob, error)
+	CreateAttachments(inputs []external.AttachmentInput) ([]data.Attachment, error)
+	DiscardAttachments(attachments []data.Attachment)
+	PreviewAttachments(inputs []external.AttachmentInput) ([]data.Attachment, blobstore.BlobStore, error)
+}
+
+type attachmentsService struct {
+	blobStore           blobstore.BlobStore
+	maxSize             int64
+	allowedContentTypes []string
+	logger              *logger.AppLogger
+}
+
+func NewAttachmentsService(blobStore blobstore.BlobStore, config *config.Config, logger *logger.AppLogger) AttachmentsService {
+	maxSize := config.Attachments.MaxSizeBytes
+	if maxSize <= 0 {
+		maxSize = defaultMaxAttachmentSize
+	}
+
+	allowedContentTypes := config.Attachments.AllowedContentTypes
+	if len(allowedContentTypes) == 0 {
+		allowedContentTypes = defaultAllowedAttachmentTypes
+	}
+
+	return &attachmentsService{
+		blobStore:           blobStore,
+		maxSize:             maxSize,
+		allowedContentTypes: allowedContentTypes,
+		logger:              logger,
+	}
+}
+
+// Upload stores the content of an attachment, so it could be referenced by notifications.
+func (service *attachmentsService) Upload(content io.Reader, contentType string) (*external.UploadedBlob, error) {
+	mediaType, err := service.checkContentType(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	// One byte over the limit is read to detect content which is too large.
+	blobId, size, err := service.blobStore.Put(io.LimitReader(content, service.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if size > service.maxSize {
+		if err := service.blobStore.Delete(blobId); err != nil {
+			service.logger.Error().Err(err).Str("blobId", blobId).Msg("Failed to delete an oversized blob.")
+		}
+		return nil, service.sizeError()
+	}
+
+	return &external.UploadedBlob{BlobId: blobId, ContentType: mediaType, Size: size}, nil
+}
+
+// CreateAttachments validates the attachments of a notification input and stores their inline content.
+// Returns the metadata of the attachments, which is persisted with the notifications.
+func (service *attachmentsService) CreateAttachments(inputs []external.AttachmentInput) ([]data.Attachment, error) {
+	if len(inputs) > maxAttachmentsPerNotification {
+		return nil, &AttachmentError{Message: fmt.Sprintf("at most %d attachments are allowed", maxAttachmentsPerNotification)}
+	}
+
+	attachments := make([]data.Attachment, 0, len(inputs))
+	for _, input := range inputs {
+		attachment, err := service.createAttachment(input)
+		if err != nil {
+			service.DiscardAttachments(attachments)
+			return nil, err
+		}
+		attachments = append(attachments, *attachment)
+	}
+	return attachments, nil
+}
+
+// DiscardAttachments deletes the blobs which CreateAttachments has stored for the inline content of the attachments,
+// once no notification references them, e.g. as the notifications are duplicates or could not be persisted.
+// The uploaded blobs which the attachments reference are kept, as they could be referenced again.
+func (service *attachmentsService) DiscardAttachments(attachments []data.Attachment) {
+	for _, attachment := range attachments {
+		if attachment.ContentDigest == "" {
+			continue
+		}
+		if err := service.blobStore.Delete(attachment.BlobId); err != nil {
+			service.logger.Error().Err(err).Str("blobId", attachment.BlobId).Msg("Failed to delete the blob of a discarded attachment.")
+		}
+	}
+}
+
+// PreviewAttachments validates the attachments like CreateAttachments, but their inline content is kept in memory
+// instead of being stored. Returns the blob store from which the content of the attachments could be read.
+func (service *attachmentsService) PreviewAttachments(
+	inputs []external.AttachmentInput,
+) ([]data.Attachment, blobstore.BlobStore, error) {
+	overlay := blobstore.NewOverlayBlobStore(service.blobStore)
+	previewService := &attachmentsService{
+		blobStore:           overlay,
+		maxSize:             service.maxSize,
+		allowedContentTypes: service.allowedContentTypes,
+		logger:              service.logger,
+	}
+
+	attachments, err := previewService.CreateAttachments(inputs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachments, overlay, nil
+}
+
+func (service *attachmentsService) createAttachment(input external.AttachmentInput) (*data.Attachment, error) {
+	if input.Filename == "" || len(input.Filename) > attachmentFilenameMaxLength {
+		return nil, &AttachmentError{Message: "invalid attachment filename"}
+	}
+
+	mediaType, err := service.checkContentType(input.ContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	if (input.Content == "") == (input.BlobId == "") {
+		return nil, &AttachmentError{Message: "an attachment requires either content or blobId"}
+	}
+
+	attachment := &data.Attachment{Filename: input.Filename, ContentType: mediaType, BlobId: input.BlobId}
+
+	if input.BlobId != "" {
+		size, err := service.blobStore.Size(input.BlobId)
+		if errors.Is(err, blobstore.ErrBlobNotFound) {
+			return nil, &AttachmentError{Message: "unknown attachment blobId " + input.BlobId}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if size > service.maxSize {
+			return nil, service.sizeError()
+		}
+
+		attachment.Size = size
+		return attachment, nil
+	}
+
+	if int64(base64.StdEncoding.DecodedLen(len(input.Content))) > service.maxSize+2 {
+		return nil, service.sizeError()
+	}
+
+	content, err := base64.StdEncoding.DecodeString(input.Content)
+	if err != nil {
+		return nil, &AttachmentError{Message: "attachment content is not valid base64"}
+	}
+	if int64(len(content)) > service.maxSize {
+		return nil, service.sizeError()
+	}
+
+	if attachment.BlobId, attachment.Size, err = service.blobStore.Put(bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(content)
+	attachment.ContentDigest = hex.EncodeToString(digest[:])
+	return attachment, nil
+}
+
+// Returns the media type if it is one of the allowed content types.
+func (service *attachmentsService) checkContentType(contentType string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", &AttachmentError{Message: attachmentContentTypeError}
+	}
+
+	if !slices.Contains(service.allowedContentTypes, mediaType) {
+		return "", &AttachmentError{Message: "attachment content type " + mediaType + " is not allowed"}
+	}
+	return mediaType, nil
+}
+
+func (service *attachmentsService) sizeError() error {
+	return &AttachmentError{Message: fmt.Sprintf("attachment exceeds the maximum size of %d bytes", service.maxSize)}
+}
@@ -0,0 +1,101 @@
+package services_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/external"
+	"github.com/plyovchev/notifications-service/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAttachmentsService(t *testing.T) services.AttachmentsService {
+	service, _ := newAttachmentsServiceWithStore(t)
+	return service
+}
+
+func newAttachmentsServiceWithStore(t *testing.T) (services.AttachmentsService, blobstore.BlobStore) {
+	store, err := blobstore.NewLocalBlobStore(t.TempDir())
+	require.NoError(t, err)
+
+	cfg := &config.Config{}
+	cfg.Attachments.MaxSizeBytes = 16
+	cfg.Attachments.AllowedContentTypes = []string{"text/csv"}
+	return services.NewAttachmentsService(store, cfg, logger.Setup(config.ServiceEnv{Name: "test"})), store
+}
+
+func TestAttachmentsService_CreateAttachments(t *testing.T) {
+	service := newAttachmentsService(t)
+	uploaded, err := service.Upload(strings.NewReader("a,b\n1,2\n"), "text/csv; charset=utf-8")
+	require.NoError(t, err)
+	assert.Equal(t, "text/csv", uploaded.ContentType)
+
+	attachments, err := service.CreateAttachments([]external.AttachmentInput{
+		{Filename: "inline.csv", ContentType: "text/csv", Content: base64.StdEncoding.EncodeToString([]byte("x,y\n"))},
+		{Filename: "uploaded.csv", ContentType: "text/csv", BlobId: uploaded.BlobId},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, attachments, 2)
+	assert.Equal(t, int64(4), attachments[0].Size)
+	assert.NotEmpty(t, attachments[0].BlobId)
+	assert.Equal(t, uploaded.BlobId, attachments[1].BlobId)
+	assert.Equal(t, int64(8), attachments[1].Size)
+}
+
+func TestAttachmentsService_RejectsInvalidAttachments(t *testing.T) {
+	service := newAttachmentsService(t)
+	tooLarge := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 17)))
+
+	tests := []struct {
+		name  string
+		input external.AttachmentInput
+	}{
+		{"TooLarge", external.AttachmentInput{Filename: "a.csv", ContentType: "text/csv", Content: tooLarge}},
+		{"TypeNotAllowed", external.AttachmentInput{Filename: "a.exe", ContentType: "application/octet-stream", Content: "eA=="}},
+		{"InvalidBase64", external.AttachmentInput{Filename: "a.csv", ContentType: "text/csv", Content: "not base64!"}},
+		{"UnknownBlob", external.AttachmentInput{Filename: "a.csv", ContentType: "text/csv", BlobId: "9b2f3a49-3f4e-4a8e-9d59-7f6f4a0f1a2b"}},
+		{"ContentAndBlob", external.AttachmentInput{Filename: "a.csv", ContentType: "text/csv", Content: "eA==", BlobId: "id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateAttachments([]external.AttachmentInput{tt.input})
+
+			var attachmentErr *services.AttachmentError
+			assert.ErrorAs(t, err, &attachmentErr)
+		})
+	}
+}
+
+func TestAttachmentsService_DiscardAttachments(t *testing.T) {
+	service, store := newAttachmentsServiceWithStore(t)
+	uploaded, err := service.Upload(strings.NewReader("a,b\n1,2\n"), "text/csv")
+	require.NoError(t, err)
+	attachments, err := service.CreateAttachments([]external.AttachmentInput{
+		{Filename: "inline.csv", ContentType: "text/csv", Content: base64.StdEncoding.EncodeToString([]byte("x,y\n"))},
+		{Filename: "uploaded.csv", ContentType: "text/csv", BlobId: uploaded.BlobId},
+	})
+	require.NoError(t, err)
+
+	service.DiscardAttachments(attachments)
+
+	// Only the blob stored for the inline content is deleted; the uploaded one could be referenced again.
+	_, err = store.Size(attachments[0].BlobId)
+	assert.ErrorIs(t, err, blobstore.ErrBlobNotFound)
+	_, err = store.Size(uploaded.BlobId)
+	assert.NoError(t, err)
+}
+
+func TestAttachmentsService_UploadTooLarge(t *testing.T) {
+	service := newAttachmentsService(t)
+
+	_, err := service.Upload(strings.NewReader(strings.Repeat("x", 17)), "text/csv")
+
+	var attachmentErr *services.AttachmentError
+	assert.ErrorAs(t, err, &attachmentErr)
+}
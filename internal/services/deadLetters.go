@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/repositories"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
+)
+
+// The size of the dead-letter queue from which an alert is logged, when none is configured.
+const defaultDeadLetterAlertThreshold = 10
+
+type DeadLetterQueue interface {
+	Add(ctx context.Context, notification *data.Notification) error
+	List(filter repositories.DeadLetterFilter, offset int, limit int) (*[]data.DeadLetter, int64, error)
+	Get(id int) (*data.DeadLetter, error)
+	Replay(filter repositories.DeadLetterFilter) ([]int, error)
+	Purge(filter repositories.DeadLetterFilter) (int64, error)
+}
+
+type deadLetterQueue struct {
+	repository       repositories.DeadLetterRepository
+	notifierRegistry *notifiers.Registry
+	blobStore        blobstore.BlobStore
+	alertThreshold   int64
+	logger           *logger.AppLogger
+}
+
+func NewDeadLetterQueue(
+	repository repositories.DeadLetterRepository,
+	notifierRegistry *notifiers.Registry,
+	blobStore blobstore.BlobStore,
+	config *config.Config,
+	logger *logger.AppLogger,
+) DeadLetterQueue {
+	alertThreshold := config.DeadLetters.AlertThreshold
+	if alertThreshold <= 0 {
+		alertThreshold = defaultDeadLetterAlertThreshold
+	}
+
+	return &deadLetterQueue{
+		repository:       repository,
+		notifierRegistry: notifierRegistry,
+		blobStore:        blobStore,
+		alertThreshold:   alertThreshold,
+		logger:           logger,
+	}
+}
+
+// Add moves the notification to the dead-letter queue together with the payload rendered for its delivery channel.
+// An alert is logged while the size of the queue is at or over the alert threshold.
+func (queue *deadLetterQueue) Add(ctx context.Context, notification *data.Notification) error {
+	notification.Status = data.DeadLettered
+	deadLetter := data.NewDeadLetter(notification)
+
+	// The email is stored without its attachments, whose content would be repeated in every dead letter;
+	// the attachments are kept with the notification, which gets them back when it is replayed.
+	rendered := *notification
+	if rendered.DeliveryChannel == data.Email {
+		rendered.Attachments = nil
+	}
+	preview, err := queue.notifierRegistry.Preview(ctx, &rendered, queue.blobStore)
+	if err == nil {
+		deadLetter.PayloadContentType = preview.ContentType
+		deadLetter.Payload, err = payloadString(preview.Payload)
+	}
+	if err != nil {
+		// The dead letter is kept without the payload, as the notification is dead-lettered anyway.
+		queue.logger.Warn().
+			Err(err).
+			Int("notificationId", notification.Id).
+			Msg("Could not render the payload of the dead-lettered notification.")
+	}
+
+	if err := queue.repository.Add(notification, deadLetter); err != nil {
+		return err
+	}
+
+	count, err := queue.repository.Count()
+	if err != nil {
+		queue.logger.Error().Err(err).Msg("Could not count the dead letters.")
+		return nil
+	}
+
+	queue.logger.Warn().
+		Int("notificationId", notification.Id).
+		Str("deliveryChannel", string(notification.DeliveryChannel)).
+		Int64("deadLetterCount", count).
+		Msg("Notification has been moved to the dead-letter queue.")
+	if count >= queue.alertThreshold {
+		queue.logger.Error().
+			Int64("deadLetterCount", count).
+			Int64("alertThreshold", queue.alertThreshold).
+			Msg("ALERT: The dead-letter queue has reached its alert threshold.")
+	}
+	return nil
+}
+
+// List returns a page of the selected dead letters together with the total count of them.
+func (queue *deadLetterQueue) List(filter repositories.DeadLetterFilter, offset int, limit int) (*[]data.DeadLetter, int64, error) {
+	return queue.repository.FindAll(filter, offset, limit)
+}
+
+// Get returns the dead letter with its notification. Returns nil if no such dead letter exists.
+func (queue *deadLetterQueue) Get(id int) (*data.DeadLetter, error) {
+	return queue.repository.FindById(id)
+}
+
+// Replay returns the notifications of the selected dead letters to pending, so they are sent again with a new budget
+// of attempts. Returns the ids of the replayed notifications.
+func (queue *deadLetterQueue) Replay(filter repositories.DeadLetterFilter) ([]int, error) {
+	notificationIds, err := queue.repository.Replay(filter, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	queue.logger.Info().Ints("notificationIds", notificationIds).Msg("Dead letters have been replayed.")
+	return notificationIds, nil
+}
+
+// Purge removes the selected dead letters and fails their notifications. Returns the count of the purged ones.
+func (queue *deadLetterQueue) Purge(filter repositories.DeadLetterFilter) (int64, error) {
+	purged, err := queue.repository.Purge(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	queue.logger.Info().Int64("purged", purged).Msg("Dead letters have been purged.")
+	return purged, nil
+}
+
+// Returns the rendered payload of a preview as a string; the JSON payloads are kept as they are.
+func payloadString(payload any) (string, error) {
+	switch payload := payload.(type) {
+	case string:
+		return payload, nil
+	case json.RawMessage:
+		return string(payload), nil
+	default:
+		body, err := json.Marshal(payload)
+		return string(body), err
+	}
+}
@@ -0,0 +1,115 @@
+package services_test
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/repositories"
+	"github.com/plyovchev/notifications-service/internal/services"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A dead-letter repository which keeps the dead letters in memory and reports the dead-lettered notifications
+// over the saved channel, when it is set.
+type fakeDeadLetterRepository struct {
+	deadLetters []data.DeadLetter
+	saved       chan data.Notification
+}
+
+func (repository *fakeDeadLetterRepository) Add(notification *data.Notification, deadLetter *data.DeadLetter) error {
+	deadLetter.Id = len(repository.deadLetters) + 1
+	repository.deadLetters = append(repository.deadLetters, *deadLetter)
+	if repository.saved != nil {
+		repository.saved <- *notification
+	}
+	return nil
+}
+
+func (repository *fakeDeadLetterRepository) Count() (int64, error) {
+	return int64(len(repository.deadLetters)), nil
+}
+
+func (repository *fakeDeadLetterRepository) FindAll(repositories.DeadLetterFilter, int, int) (*[]data.DeadLetter, int64, error) {
+	return &repository.deadLetters, int64(len(repository.deadLetters)), nil
+}
+
+func (repository *fakeDeadLetterRepository) FindById(int) (*data.DeadLetter, error) {
+	return nil, nil
+}
+
+func (repository *fakeDeadLetterRepository) Replay(repositories.DeadLetterFilter, time.Time) ([]int, error) {
+	return nil, nil
+}
+
+func (repository *fakeDeadLetterRepository) Purge(repositories.DeadLetterFilter) (int64, error) {
+	return 0, nil
+}
+
+func TestDeadLetterQueue_AddCapturesFinalStateAndPayload(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = "http://127.0.0.1:1/webhook"
+	lgr := logger.Setup(config.ServiceEnv{Name: "test"})
+	registry, err := notifiers.NewRegistry(cfg, notifiers.Dependencies{}, lgr)
+	require.NoError(t, err)
+
+	repository := &fakeDeadLetterRepository{}
+	queue := services.NewDeadLetterQueue(repository, registry, nil, cfg, lgr)
+	notification := &data.Notification{
+		Id: 7, Key: "payment-cancelled", Message: "Payment has failed", Status: data.Pending, DeliveryChannel: data.Slack,
+		AttemptCount: 5, LastError: "slack webhook responded with 503", ProviderResponseCode: 503,
+	}
+
+	require.NoError(t, queue.Add(context.Background(), notification))
+
+	assert.Equal(t, data.DeadLettered, notification.Status)
+	require.Len(t, repository.deadLetters, 1)
+	deadLetter := repository.deadLetters[0]
+	assert.Equal(t, 7, deadLetter.NotificationId)
+	assert.Equal(t, "payment-cancelled", deadLetter.Key)
+	assert.Equal(t, 5, deadLetter.AttemptCount)
+	assert.Equal(t, "slack webhook responded with 503", deadLetter.LastError)
+	assert.Equal(t, 503, deadLetter.ProviderResponseCode)
+	assert.Equal(t, "application/json", deadLetter.PayloadContentType)
+	assert.Contains(t, deadLetter.Payload, "Payment has failed")
+}
+
+func TestDeadLetterQueue_AddStoresEmailWithoutAttachments(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Email.From = "payments@example.com"
+	cfg.Email.Recipients = []string{"ops@example.com"}
+	cfg.Email.SmtpHost = "127.0.0.1"
+	cfg.Email.SmtpPort = "2525"
+	lgr := logger.Setup(config.ServiceEnv{Name: "test"})
+	registry, err := notifiers.NewRegistry(cfg, notifiers.Dependencies{}, lgr)
+	require.NoError(t, err)
+	blobStore, err := blobstore.NewLocalBlobStore(t.TempDir())
+	require.NoError(t, err)
+	blobId, size, err := blobStore.Put(strings.NewReader("settlement report"))
+	require.NoError(t, err)
+
+	repository := &fakeDeadLetterRepository{}
+	queue := services.NewDeadLetterQueue(repository, registry, blobStore, cfg, lgr)
+	notification := &data.Notification{
+		Id: 7, Subject: "Settlement failed", Message: "Settlement has failed", DeliveryChannel: data.Email,
+		Attachments: []data.Attachment{{BlobId: blobId, Filename: "report.txt", ContentType: "text/plain", Size: size}},
+	}
+
+	require.NoError(t, queue.Add(context.Background(), notification))
+
+	require.Len(t, repository.deadLetters, 1)
+	payload := repository.deadLetters[0].Payload
+	assert.Contains(t, payload, "Subject: Settlement failed")
+	assert.NotContains(t, payload, "report.txt")
+	assert.NotContains(t, payload, base64.StdEncoding.EncodeToString([]byte("settlement report")))
+	// The attachments are kept with the notification for its replay.
+	assert.Len(t, notification.Attachments, 1)
+}
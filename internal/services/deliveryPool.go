@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/plyovchev/notifications-service/internal/models/data"
+)
+
+// deliveryPool sends the notifications of a single delivery channel. The notifications wait in the queue
+// of the channel for one of its workers, so a slow or broken channel only holds up its own notifications.
+type deliveryPool struct {
+	deliveryChannel data.DeliveryChannel
+	queue           chan *data.Notification
+	// Sends the notification and records the result of the send.
+	deliver func(ctx context.Context, notification *data.Notification)
+	// Called by a worker which has found the queue empty after a send, e.g. to close the idle connections.
+	drained func()
+}
+
+func newDeliveryPool(
+	deliveryChannel data.DeliveryChannel,
+	queueSize int,
+	deliver func(ctx context.Context, notification *data.Notification),
+	drained func(),
+) *deliveryPool {
+	return &deliveryPool{
+		deliveryChannel: deliveryChannel,
+		queue:           make(chan *data.Notification, queueSize),
+		deliver:         deliver,
+		drained:         drained,
+	}
+}
+
+// start runs the workers of the pool until the context is done or the closed queue is drained.
+// The workers are added to the wait group.
+func (pool *deliveryPool) start(ctx context.Context, workers *sync.WaitGroup, concurrency int) {
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			pool.work(ctx)
+		}()
+	}
+}
+
+// capacity returns the count of the notifications which could be added to the queue without waiting.
+func (pool *deliveryPool) capacity() int {
+	return cap(pool.queue) - len(pool.queue)
+}
+
+// close stops the queue of the pool from accepting notifications, so the workers exit once they have sent
+// the queued ones. It must not be called while the notifications are being enqueued.
+func (pool *deliveryPool) close() {
+	close(pool.queue)
+}
+
+// enqueue adds the notification to the queue of the pool without waiting. Returns false when the queue is full.
+func (pool *deliveryPool) enqueue(notification *data.Notification) bool {
+	select {
+	case pool.queue <- notification:
+		return true
+	default:
+		return false
+	}
+}
+
+func (pool *deliveryPool) work(ctx context.Context) {
+	for {
+		// A done context takes precedence over the queued notifications, which are left pending.
+		if ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case notification, open := <-pool.queue:
+			if !open {
+				return
+			}
+			pool.deliver(ctx, notification)
+			if len(pool.queue) == 0 {
+				pool.drained()
+			}
+		}
+	}
+}
@@ -1,10 +1,19 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/db"
 	"github.com/plyovchev/notifications-service/internal/logger"
 	"github.com/plyovchev/notifications-service/internal/models/data"
 	"github.com/plyovchev/notifications-service/internal/repositories"
@@ -13,172 +22,437 @@ import (
 )
 
 const (
-	notificationServicePollingTime = 30 * time.Second
-	retryAttempts                  = 3
-	channelBufferSize              = 10
+	// The periods of the polling for the due notifications when none are configured.
+	defaultPollingInterval         = 30 * time.Second
+	defaultFallbackPollingInterval = 5 * time.Second
+	// The bounds of the delay before reconnecting the listener for the created notifications, which doubles after
+	// every failed attempt.
+	listenerMinReconnectDelay = time.Second
+	listenerMaxReconnectDelay = time.Minute
+	// The deadline of a send when no timeout is configured for its delivery channel.
+	defaultSendTimeout = 30 * time.Second
+	// The duration of the claims of the notifications when none is configured.
+	defaultLeaseDuration = time.Minute
 )
 
 type NotificationsService interface {
-	SendNotification(notification *data.Notification) error
+	SendNotification(ctx context.Context, notification *data.Notification) notifiers.SendResult
 	OnNotificationsReceived(notificationIds []int)
 	StartNotificationService()
+	StopNotificationService()
+}
+
+// Listener receives the payloads which are published on a database channel, e.g. the ids of the notifications
+// created by any replica of the service. Listen blocks until the context is done or the connection is lost.
+type Listener interface {
+	Listen(ctx context.Context, channel string, onListening func(), onNotification func(payload string)) error
 }
 
 type notificationService struct {
-	config                       *config.Config
-	logger                       *logger.AppLogger
-	notificationRepository       repositories.NotificationRepository
-	receivedNotificationsChannel chan []int
-	isNotificationChannelOpen    bool
-	lock                         sync.Mutex
+	config                 *config.Config
+	logger                 *logger.AppLogger
+	notificationRepository repositories.NotificationRepository
+	attemptRepository      repositories.DeliveryAttemptRepository
+	deadLetterQueue        DeadLetterQueue
+	notifierRegistry       *notifiers.Registry
+	rateLimiter            *rateLimiter
+	// Wakes the observer, which takes the received notification ids. The ids are collected under the lock,
+	// so the wake-ups never block and the ids received while the observer is busy are processed together.
+	wakeUp                    chan struct{}
+	receivedNotificationIds   []int
+	processAllDue             bool
+	isNotificationChannelOpen bool
+	// Wakes the service for the notifications created by the other replicas; nil when the service only polls.
+	listener  Listener
+	listening atomic.Bool
+	// Cancels the context of the service, which aborts the sends in flight.
+	cancel context.CancelFunc
+	// Cancels the context of the observer and the listener, so no more notifications are claimed.
+	stopClaiming context.CancelFunc
+	lock         sync.Mutex
+	// The worker pools of the enabled delivery channels, created when the service is started.
+	pools map[data.DeliveryChannel]*deliveryPool
+	// The observer and the listener, which are stopped first when the service is stopped.
+	claimers sync.WaitGroup
+	// The workers of the pools, which are drained within the shutdown grace period when the service is stopped.
+	workers sync.WaitGroup
+	// The heartbeat of the leases, which is kept until the workers are done.
+	heartbeat sync.WaitGroup
+	// The ids of the claimed notifications which are queued or being sent; their leases are renewed by the heartbeats.
+	inFlight     map[int]bool
+	inFlightLock sync.Mutex
+	// The id of the replica, which owns the leases of the notifications it claims.
+	owner                   string
+	leaseDuration           time.Duration
+	pollingInterval         time.Duration
+	fallbackPollingInterval time.Duration
 }
 
 func NewNotificationService(
 	repository repositories.NotificationRepository,
+	attemptRepository repositories.DeliveryAttemptRepository,
+	deadLetterQueue DeadLetterQueue,
+	listener Listener,
+	notifierRegistry *notifiers.Registry,
 	config *config.Config,
 	logger *logger.AppLogger,
 ) NotificationsService {
+	leaseDuration := config.Delivery.LeaseDuration
+	if leaseDuration <= 0 {
+		leaseDuration = defaultLeaseDuration
+	}
+	pollingInterval := config.Delivery.PollingInterval
+	if pollingInterval <= 0 {
+		pollingInterval = defaultPollingInterval
+	}
+	fallbackPollingInterval := config.Delivery.FallbackPollingInterval
+	if fallbackPollingInterval <= 0 {
+		fallbackPollingInterval = defaultFallbackPollingInterval
+	}
+
 	return &notificationService{
 		notificationRepository:    repository,
+		attemptRepository:         attemptRepository,
+		deadLetterQueue:           deadLetterQueue,
+		listener:                  listener,
+		notifierRegistry:          notifierRegistry,
+		rateLimiter:               newRateLimiter(config),
 		config:                    config,
 		logger:                    logger,
 		isNotificationChannelOpen: false,
+		inFlight:                  make(map[int]bool),
+		owner:                     newReplicaId(),
+		leaseDuration:             leaseDuration,
+		pollingInterval:           pollingInterval,
+		fallbackPollingInterval:   fallbackPollingInterval,
+	}
+}
+
+// Returns an id which tells the replica apart from the other replicas, including its earlier runs.
+func newReplicaId() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "replica"
 	}
+	return hostname + "-" + uuid.NewString()[:8]
 }
 
 // A hook which to wake the service's polling thread and notify it that new notifications arrived
 // and should be processed.
 func (service *notificationService) OnNotificationsReceived(notificationIds []int) {
+	service.wake(notificationIds)
+}
+
+// Wakes the observer to process the notifications with the given ids, or all due notifications when the ids are nil.
+// The wake-up does not wait for the observer.
+func (service *notificationService) wake(notificationIds []int) {
 	service.lock.Lock()
-	if service.isNotificationChannelOpen {
-		service.receivedNotificationsChannel <- notificationIds
+	defer service.lock.Unlock()
+
+	if !service.isNotificationChannelOpen {
+		return
+	}
+	if notificationIds == nil {
+		service.processAllDue = true
 	}
+	service.receivedNotificationIds = append(service.receivedNotificationIds, notificationIds...)
+	select {
+	case service.wakeUp <- struct{}{}:
+	default:
+		// The observer has a pending wake-up, which takes the ids above as well.
+	}
+}
 
-	service.lock.Unlock()
+// Returns the ids of the notifications received since the last wake-up, or nil when all due notifications
+// should be processed.
+func (service *notificationService) takeReceivedNotificationIds() []int {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+
+	notificationIds := service.receivedNotificationIds
+	if service.processAllDue {
+		notificationIds = nil
+	}
+	service.receivedNotificationIds = nil
+	service.processAllDue = false
+	return notificationIds
 }
 
 // Start the notification service observer functionality.
-// The observer functionality waits for notificationIds to arrive over a channel,
-// or executes after a specified period/timeout to process and send all pending notifications.
+// The observer functionality waits to be woken up with the ids of the received notifications,
+// or executes after the polling interval to queue all pending notifications for the workers
+// of their delivery channels. With a listener, the service is woken up by the notifications
+// created by any replica.
 func (service *notificationService) StartNotificationService() {
 	service.logger.Info().Msg("Notification service observer started")
 
+	var ctx, claimCtx context.Context
 	service.lock.Lock()
 	{
-		service.receivedNotificationsChannel = make(chan []int, channelBufferSize)
+		ctx, service.cancel = context.WithCancel(context.Background())
+		claimCtx, service.stopClaiming = context.WithCancel(ctx)
+		service.wakeUp = make(chan struct{}, 1)
 		service.isNotificationChannelOpen = true
+		service.startDeliveryPools(ctx)
 	}
 	service.lock.Unlock()
 
-	go func(receivedNotificationChannel chan []int) {
+	if service.listener != nil {
+		service.claimers.Add(1)
+		go func() {
+			defer service.claimers.Done()
+			service.listen(claimCtx)
+		}()
+	}
+
+	service.heartbeat.Add(1)
+	go func() {
+		defer service.heartbeat.Done()
+		service.keepLeases(ctx)
+	}()
+	service.claimers.Add(1)
+	go func(ctx context.Context, wakeUp chan struct{}) {
+		defer service.claimers.Done()
 		for {
 			select {
-			case receivedNotificationIds := <-receivedNotificationChannel:
-				service.processPendingNotifications(receivedNotificationIds)
-			case <-time.After(notificationServicePollingTime):
-				service.processPendingNotifications(nil)
+			case <-ctx.Done():
+				return
+			case <-wakeUp:
+				service.processPendingNotifications(ctx, service.takeReceivedNotificationIds())
+			case <-time.After(service.currentPollingInterval()):
+				service.processPendingNotifications(ctx, nil)
 			}
 		}
-	}(service.receivedNotificationsChannel)
+	}(claimCtx, service.wakeUp)
+}
+
+// Returns the period of the polling, which is shortened while the listener for the created notifications is down.
+func (service *notificationService) currentPollingInterval() time.Duration {
+	if service.listener != nil && !service.listening.Load() {
+		return service.fallbackPollingInterval
+	}
+	return service.pollingInterval
 }
 
-// Stops the notification service observer functionality.
+// Listens for the notifications created by any replica and wakes the observer to process them, until the context
+// is done. A lost connection is restored after a delay which doubles with every failed attempt; the service falls
+// back to the polling in the meantime.
+func (service *notificationService) listen(ctx context.Context) {
+	delay := listenerMinReconnectDelay
+	for {
+		err := service.listener.Listen(ctx, db.NOTIFICATION_CREATED_CHANNEL,
+			func() {
+				service.listening.Store(true)
+				delay = listenerMinReconnectDelay
+				service.logger.Info().Msg("Listening for the created notifications.")
+				// The notifications which were created while the service was not listening are picked up at once.
+				service.wake(nil)
+			},
+			func(payload string) {
+				notificationId, err := strconv.Atoi(payload)
+				if err != nil {
+					service.logger.Warn().Str("payload", payload).Msg("Ignoring an invalid created notification id.")
+					return
+				}
+				service.wake([]int{notificationId})
+			})
+		service.listening.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+
+		service.logger.Warn().
+			Err(err).
+			Dur("reconnectDelay", delay).
+			Msg("Not listening for the created notifications; falling back to polling.")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, listenerMaxReconnectDelay)
+	}
+}
+
+// Stops the notification service observer functionality and drains the workers: no more notifications are claimed,
+// while the queued and the in-flight ones are sent within the shutdown grace period. The sends which are still
+// in progress after the grace period are cancelled. The notifications whose sends are cancelled and the queued ones
+// are returned to pending, so they are sent by another replica or after a restart.
 func (service *notificationService) StopNotificationService() {
 	service.lock.Lock()
+	stopping := service.isNotificationChannelOpen
 	{
-		service.isNotificationChannelOpen = false
-		close(service.receivedNotificationsChannel)
+		if service.isNotificationChannelOpen {
+			service.isNotificationChannelOpen = false
+			service.stopClaiming()
+		}
 	}
 	service.lock.Unlock()
-}
 
-// Process any pending notifications.
-//
-// The notificationIds are ids of the notifications that should be processed if they are pending.
-// The notificationIds could be nil in which case all stored pending notifications are processed.
-func (service *notificationService) processPendingNotifications(notificationIds []int) {
-	service.logger.Debug().Msg("Processing pending notifications started")
-
-	var notifications *[]data.Notification
-	var err error
+	if !stopping {
+		return
+	}
 
-	if len(notificationIds) > 0 {
-		notifications, err = service.notificationRepository.FindAllByIds(notificationIds)
-	} else {
-		notifications, err = service.notificationRepository.FindAllByStatus(data.Pending)
+	// The queues are filled only by the observer, so they could be closed once it has stopped.
+	service.claimers.Wait()
+	for _, pool := range service.pools {
+		pool.close()
+	}
+	gracePeriod := service.config.ShutdownGracePeriod()
+	if !service.awaitWorkers(gracePeriod) {
+		service.logger.Warn().
+			Dur("gracePeriod", gracePeriod).
+			Int("inFlight", len(service.trackedIds())).
+			Msg("The shutdown grace period is over; the sends in progress are cancelled.")
 	}
+	service.cancel()
+	service.workers.Wait()
+	service.heartbeat.Wait()
 
+	released, err := service.notificationRepository.ReleaseLeases(service.owner)
 	if err != nil {
-		var idsArr = ""
-		if notificationIds != nil {
-			idsArr = util.ArrayToString(notificationIds, ", ")
-		}
-
-		service.logger.Error().
-			Err(err).
-			Str("notificationIds", idsArr).
-			Msg("Could not retrieve notifications data")
+		service.logger.Error().Err(err).Msg("Could not release the claimed notifications.")
 		return
 	}
+	service.logger.Info().Int64("released", released).Msg("Notification service observer stopped")
+}
 
-	if len(*notifications) == 0 {
-		service.logger.Debug().Msg("Processing pending notification finished due to 0 pending notification")
-		return
+// Waits for the workers to drain the queues of their pools for up to the timeout. Returns false on the timeout.
+func (service *notificationService) awaitWorkers(timeout time.Duration) bool {
+	drained := make(chan struct{})
+	go func() {
+		service.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Creates and starts the worker pool of every enabled delivery channel with the concurrency of the channel.
+func (service *notificationService) startDeliveryPools(ctx context.Context) {
+	service.pools = make(map[data.DeliveryChannel]*deliveryPool)
+	for _, deliveryChannel := range service.notifierRegistry.EnabledChannels() {
+		settings := service.config.ChannelDelivery(string(deliveryChannel))
+		pool := newDeliveryPool(
+			deliveryChannel,
+			settings.QueueSize,
+			func(ctx context.Context, notification *data.Notification) {
+				defer service.untrack(notification.Id)
+				service.deliver(ctx, notification)
+			},
+			func() { service.closeIdleConnections(deliveryChannel) },
+		)
+		pool.start(ctx, &service.workers, settings.Concurrency)
+		service.pools[deliveryChannel] = pool
 	}
+}
 
-	retryNotificationIds := make(map[int]bool)
-	for i := 0; i < retryAttempts; i++ {
-		for _, notification := range *notifications {
-			shouldRetry, present := retryNotificationIds[notification.Id]
+// Process any pending notifications whose next attempt is due by queueing them for the workers of their channels.
+//
+// The notificationIds are ids of the notifications that should be processed if they are pending and due.
+// The notificationIds could be nil in which case all stored due notifications are processed.
+// The notifications are claimed per delivery channel up to the free capacity of the queue of the channel,
+// so the claimed notifications are sent right away and the other ones are left to the other replicas.
+// Every notification is attempted once; a notification which failed transiently is scheduled for a retry
+// according to the retry policy of its delivery channel.
+func (service *notificationService) processPendingNotifications(ctx context.Context, notificationIds []int) {
+	service.logger.Debug().Msg("Processing pending notifications started")
 
-			// If there is not record in the retry map about this notification then send it;
-			// If there is a record and it indicates that the notification should be sent again, then retry.
-			if (present && !shouldRetry) || notification.Status != data.Pending {
-				continue
+	for deliveryChannel, pool := range service.pools {
+		if ctx.Err() != nil {
+			break
+		}
+		capacity := pool.capacity()
+		if capacity == 0 {
+			continue
+		}
+
+		now := time.Now()
+		notifications, err := service.notificationRepository.ClaimDue(repositories.Claim{
+			DeliveryChannel: deliveryChannel,
+			Ids:             notificationIds,
+			Limit:           capacity,
+			Now:             now,
+			Owner:           service.owner,
+			LeaseDuration:   service.leaseDuration,
+		})
+		if err != nil {
+			var idsArr = ""
+			if notificationIds != nil {
+				idsArr = util.ArrayToString(notificationIds, ", ")
 			}
 
-			err = service.SendNotification(&notification)
+			service.logger.Error().
+				Err(err).
+				Str("deliveryChannel", string(deliveryChannel)).
+				Str("notificationIds", idsArr).
+				Msg("Could not claim notifications")
+			continue
+		}
 
-			if err != nil {
+		for j := range *notifications {
+			notification := &(*notifications)[j]
+			service.track(notification.Id)
+			if !pool.enqueue(notification) {
+				// The queue is filled only by the observer, so it has room for the claimed notifications. Should it not,
+				// the lease of the notification expires and the notification is returned to pending.
+				service.untrack(notification.Id)
 				service.logger.Error().
-					Err(err).
 					Int("notificationId", notification.Id).
-					Msg("Sending notification failed.")
-
-				retryNotificationIds[notification.Id] = true
-			} else {
-				retryNotificationIds[notification.Id] = false
+					Str("deliveryChannel", string(deliveryChannel)).
+					Msg("The queue of the delivery channel is full; the claimed notification is left to its lease expiry.")
 			}
 		}
 	}
 
-	service.updateNotificationStatuses(*notifications, retryNotificationIds)
-
 	service.logger.Debug().Msg("Processing pending notification finished")
 }
 
-// Update in the repository the new status of the processed notifications.
-func (service *notificationService) updateNotificationStatuses(
-	notifications []data.Notification,
-	failedNotificationsMap map[int]bool,
-) {
-	for _, notification := range notifications {
-		updatedNotification := &data.Notification{
-			Id:              notification.Id,
-			Key:             notification.Key,
-			Message:         notification.Message,
-			DeliveryChannel: notification.DeliveryChannel,
-			CreatedAt:       notification.CreatedAt,
-		}
+// Sends the notification once and saves the result of the attempt.
+func (service *notificationService) deliver(ctx context.Context, notification *data.Notification) {
+	// The expired leases count as attempts, so a notification which crashes or hangs its replica on every send
+	// is dead-lettered once they have exhausted its attempts, without another send.
+	if notification.AttemptCount >= service.config.ChannelDelivery(string(notification.DeliveryChannel)).Retry.MaxAttempts {
+		service.logger.Warn().
+			Int("notificationId", notification.Id).
+			Int("attemptCount", notification.AttemptCount).
+			Msg("Notification has exhausted its attempts by expired leases.")
+		notification.Status = data.DeadLettered
+		service.saveResult(ctx, notification)
+		return
+	}
 
-		shouldRetry, present := failedNotificationsMap[notification.Id]
-		if present && !shouldRetry {
-			updatedNotification.Status = data.Completed
-		} else {
-			updatedNotification.Status = data.Failed
-		}
+	// The notification is sent by reference, so the changes of the notifiers (e.g. the provider) are saved.
+	result := service.SendNotification(ctx, notification)
+	// The sends which are cancelled are not counted as attempts and the notifications are left pending.
+	if ctx.Err() != nil && !result.IsDelivered() {
+		return
+	}
 
-		_, err := service.notificationRepository.Save(updatedNotification)
+	service.applySendResult(notification, result, time.Now())
+	service.saveResult(ctx, notification)
+}
+
+// Saves the result of the attempt of the claimed notification, or adds it to the dead-letter queue.
+func (service *notificationService) saveResult(ctx context.Context, notification *data.Notification) {
+	var err error
+	if notification.Status == data.DeadLettered {
+		err = service.deadLetterQueue.Add(ctx, notification)
+	} else {
+		err = service.notificationRepository.SaveClaimed(notification)
+	}
+	if errors.Is(err, repositories.ErrLeaseLost) {
+		service.logger.Warn().
+			Int("notificationId", notification.Id).
+			Msg("The claim of the notification has expired during the send; the result of the send is discarded.")
+		return
+	}
+	if err != nil {
 		service.logger.Error().
 			Err(err).
 			Int("notificationId", notification.Id).
@@ -186,13 +460,217 @@ func (service *notificationService) updateNotificationStatuses(
 	}
 }
 
-func (service *notificationService) SendNotification(notification *data.Notification) error {
-	notifier := notifiers.CreateNotifierForChannel(notification.DeliveryChannel, service.config, service.logger)
+// Tracks the claimed notification while it is queued or being sent, so its lease is renewed.
+func (service *notificationService) track(notificationId int) {
+	service.inFlightLock.Lock()
+	service.inFlight[notificationId] = true
+	service.inFlightLock.Unlock()
+}
+
+func (service *notificationService) untrack(notificationId int) {
+	service.inFlightLock.Lock()
+	delete(service.inFlight, notificationId)
+	service.inFlightLock.Unlock()
+}
+
+// Renews the leases of the tracked notifications and releases the expired leases of all replicas, e.g. of a crashed
+// one, every third of the lease duration until the context is done.
+func (service *notificationService) keepLeases(ctx context.Context) {
+	ticker := time.NewTicker(service.leaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if ids := service.trackedIds(); len(ids) > 0 {
+			if err := service.notificationRepository.RenewLeases(service.owner, ids, service.leaseDuration); err != nil {
+				service.logger.Error().Err(err).Msg("Could not renew the leases of the claimed notifications.")
+			}
+		}
+
+		released, err := service.notificationRepository.ReleaseExpiredLeases()
+		if err != nil {
+			service.logger.Error().Err(err).Msg("Could not release the expired leases.")
+		} else if released > 0 {
+			service.logger.Warn().Int64("released", released).Msg("Notifications with expired leases have been returned to pending.")
+		}
+	}
+}
+
+func (service *notificationService) trackedIds() []int {
+	service.inFlightLock.Lock()
+	defer service.inFlightLock.Unlock()
+
+	ids := make([]int, 0, len(service.inFlight))
+	for id := range service.inFlight {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Closes the connections which the notifier of the delivery channel keeps for reuse. It is called once the queue
+// of the channel is drained, so the connections are reused across the sends of a burst.
+func (service *notificationService) closeIdleConnections(deliveryChannel data.DeliveryChannel) {
+	notifier, err := service.notifierRegistry.Notifier(deliveryChannel)
+	if err != nil {
+		return
+	}
+	if closer, ok := notifier.(notifiers.IdleConnectionsCloser); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// Records the result of an attempt on the notification. A delivered notification is completed and a permanent failure
+// fails it, while a transient failure of the last allowed attempt dead-letters it. Otherwise the notification is returned
+// to pending and its next attempt is scheduled after the backoff delay. A send which was deferred by the open circuit
+// of the channel, or rate limited with a retry-after, is not counted as an attempt and the notification is postponed
+// by the retry-after.
+func (service *notificationService) applySendResult(notification *data.Notification, result notifiers.SendResult, now time.Time) {
+	notification.ProviderMessageId = result.MessageId
+	notification.ProviderResponseCode = result.ResponseCode
+	if result.Err != nil {
+		notification.LastError = result.Err.Error()
+	}
+
+	if result.Outcome == notifiers.Deferred || (result.Outcome == notifiers.RateLimited && result.RetryAfter > 0) {
+		// The provider has asked to slow down or it is down rather than failed the notification, so the attempt
+		// is not counted. The notification is sent again once the pause of the channel or the cool-down of its
+		// circuit is over.
+		notification.Status = data.Pending
+		notification.NextAttemptAt = now.Add(result.RetryAfter)
+		service.logger.Info().
+			Int("notificationId", notification.Id).
+			Str("outcome", string(result.Outcome)).
+			Time("nextAttemptAt", notification.NextAttemptAt).
+			Msg("Notification is postponed.")
+		return
+	}
+
+	notification.AttemptCount++
+	retryPolicy := service.config.ChannelDelivery(string(notification.DeliveryChannel)).Retry
+	switch {
+	case result.IsDelivered():
+		notification.Status = data.Completed
+	case !result.CanRetry():
+		notification.Status = data.Failed
+	case notification.AttemptCount >= retryPolicy.MaxAttempts:
+		service.logger.Warn().
+			Int("notificationId", notification.Id).
+			Int("attemptCount", notification.AttemptCount).
+			Msg("Notification has exhausted its attempts.")
+		notification.Status = data.DeadLettered
+	default:
+		delay := retryPolicy.Delay(notification.AttemptCount, rand.Float64())
+		notification.Status = data.Pending
+		notification.NextAttemptAt = now.Add(delay)
+		service.logger.Info().
+			Int("notificationId", notification.Id).
+			Int("attemptCount", notification.AttemptCount).
+			Str("outcome", string(result.Outcome)).
+			Time("nextAttemptAt", notification.NextAttemptAt).
+			Msg("Notification is scheduled for a retry.")
+	}
+}
+
+// SendNotification sends the notification within the timeout of its delivery channel, once the rate limits of the
+// channel and of the destination of the notification allow it. A Retry-After of the provider pauses the channel.
+// Every send which reaches the notifier is recorded as a delivery attempt of the notification, one per provider tried;
+// the sends which are cancelled, e.g. on shutdown, are not recorded, as deliver does not count them as attempts.
+// The id of the request which originated the notification is passed to the notifier in the context.
+func (service *notificationService) SendNotification(ctx context.Context, notification *data.Notification) notifiers.SendResult {
+	notifier, err := service.notifierRegistry.Notifier(notification.DeliveryChannel)
+	if err != nil {
+		service.logger.Error().Err(err).Msgf("No notifier for the notification with key '%s'!", notification.Key)
+		return notifiers.SendResult{Outcome: notifiers.PermanentFailure, Err: err}
+	}
+
+	// The wait for the rate limits is not bounded by the timeout of the send.
+	if err := service.rateLimiter.wait(ctx, notification); err != nil {
+		return notifiers.SendResult{Outcome: notifiers.TransientFailure, Err: err}
+	}
+
+	timeout := service.config.ChannelDelivery(string(notification.DeliveryChannel)).Timeout
+	if timeout <= 0 {
+		timeout = defaultSendTimeout
+	}
+	// The send is timed out with its own context, so that a timeout is still recorded as an attempt.
+	sendCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if notification.RequestId != "" {
+		sendCtx = context.WithValue(sendCtx, config.ContextKey(config.RequestIdentifier), notification.RequestId)
+	}
 
-	if err := notifier.SendNotification(notification); err != nil {
-		service.logger.Error().Err(err).Msgf("The notification with key '%s' could not be sent!", notification.Key)
-		return err
+	startedAt := time.Now()
+	result := notifier.SendNotification(sendCtx, notification)
+	cancelled := ctx.Err() != nil && !result.IsDelivered()
+	if result.Outcome != notifiers.Deferred && !cancelled {
+		service.recordAttempts(notification, result, startedAt, time.Since(startedAt))
 	}
+	if result.Outcome == notifiers.RateLimited && result.RetryAfter > 0 {
+		service.rateLimiter.pause(notification.DeliveryChannel, result.RetryAfter)
+		service.logger.Warn().
+			Str("deliveryChannel", string(notification.DeliveryChannel)).
+			Dur("retryAfter", result.RetryAfter).
+			Msg("The delivery channel is paused by the rate limiting of its provider.")
+	}
+	// The deferred sends did not call the provider; they are logged when the notification is postponed.
+	if !result.IsDelivered() && result.Outcome != notifiers.Deferred {
+		service.logger.Error().
+			Err(result.Err).
+			Int("notificationId", notification.Id).
+			Str("outcome", string(result.Outcome)).
+			Int("responseCode", result.ResponseCode).
+			Msgf("The notification with key '%s' could not be sent!", notification.Key)
+	}
+
+	return result
+}
 
-	return nil
+// Stores an attempt per provider tried in the history of the notification, or a single attempt for the notifiers
+// which send through a single provider. The send is not failed when the attempts could not be stored.
+func (service *notificationService) recordAttempts(
+	notification *data.Notification,
+	result notifiers.SendResult,
+	startedAt time.Time,
+	duration time.Duration,
+) {
+	tries := result.Tries
+	if len(tries) == 0 {
+		tries = []notifiers.ProviderTry{{
+			Provider:     result.Provider,
+			StartedAt:    startedAt,
+			Duration:     duration,
+			Outcome:      result.Outcome,
+			ResponseCode: result.ResponseCode,
+			Err:          result.Err,
+		}}
+	}
+
+	for _, try := range tries {
+		attempt := &data.DeliveryAttempt{
+			NotificationId:       notification.Id,
+			Provider:             try.Provider,
+			StartedAt:            try.StartedAt,
+			DurationMs:           try.Duration.Milliseconds(),
+			Outcome:              string(try.Outcome),
+			ProviderResponseCode: try.ResponseCode,
+		}
+		if try.Err != nil {
+			attempt.Error = try.Err.Error()
+		}
+
+		if err := service.attemptRepository.Add(attempt); err != nil {
+			service.logger.Error().
+				Err(err).
+				Int("notificationId", notification.Id).
+				Str("provider", attempt.Provider).
+				Str("outcome", attempt.Outcome).
+				Msg("Could not record the delivery attempt.")
+		}
+	}
 }
@@ -0,0 +1,926 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/repositories"
+	"github.com/plyovchev/notifications-service/internal/services"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A notification repository which keeps the notifications in memory and reports the saved notifications over a channel.
+type fakeNotificationRepository struct {
+	lock          sync.Mutex
+	notifications []data.Notification
+	saved         chan data.Notification
+	// The attempts recorded by the services over the repository and the inbox of their InApp notifications.
+	attempts *fakeDeliveryAttemptRepository
+	inbox    *fakeInboxRepository
+}
+
+func newFakeNotificationRepository(notifications ...data.Notification) *fakeNotificationRepository {
+	return &fakeNotificationRepository{
+		notifications: notifications,
+		saved:         make(chan data.Notification, len(notifications)),
+		attempts:      &fakeDeliveryAttemptRepository{},
+		inbox:         &fakeInboxRepository{},
+	}
+}
+
+func (repository *fakeNotificationRepository) Create(notification *data.Notification) (*data.Notification, error) {
+	return notification, nil
+}
+
+func (repository *fakeNotificationRepository) CreateUnlessDuplicate(
+	notification *data.Notification,
+	_ time.Duration,
+) (*data.Notification, error) {
+	return notification, nil
+}
+
+func (repository *fakeNotificationRepository) FindAll() (*[]data.Notification, error) {
+	return repository.FindAllByIds(nil)
+}
+
+func (repository *fakeNotificationRepository) FindById(id int) (*data.Notification, error) {
+	notifications, _ := repository.FindAllByIds([]int{id})
+	if len(*notifications) == 0 {
+		return nil, nil
+	}
+	return &(*notifications)[0], nil
+}
+
+func (repository *fakeNotificationRepository) FindAllByIds(ids []int) (*[]data.Notification, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+
+	var notifications []data.Notification
+	for _, notification := range repository.notifications {
+		if len(ids) == 0 || slices.Contains(ids, notification.Id) {
+			notifications = append(notifications, notification)
+		}
+	}
+	return &notifications, nil
+}
+
+func (repository *fakeNotificationRepository) FindAllByStatus(data.NotificationStatus) (*[]data.Notification, error) {
+	return repository.FindAllByIds(nil)
+}
+
+func (repository *fakeNotificationRepository) Save(notification *data.Notification) (*data.Notification, error) {
+	repository.saved <- *notification
+	return notification, nil
+}
+
+func (repository *fakeNotificationRepository) ClaimDue(claim repositories.Claim) (*[]data.Notification, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+
+	claimed := []data.Notification{}
+	for i := range repository.notifications {
+		notification := &repository.notifications[i]
+		if len(claimed) < claim.Limit &&
+			notification.Status == data.Pending &&
+			notification.DeliveryChannel == claim.DeliveryChannel &&
+			!notification.NextAttemptAt.After(claim.Now) &&
+			(len(claim.Ids) == 0 || slices.Contains(claim.Ids, notification.Id)) {
+			notification.Status = data.Processing
+			notification.LeaseOwner = claim.Owner
+			leaseExpiresAt := time.Now().Add(claim.LeaseDuration)
+			notification.LeaseExpiresAt = &leaseExpiresAt
+			claimed = append(claimed, *notification)
+		}
+	}
+	return &claimed, nil
+}
+
+func (repository *fakeNotificationRepository) SaveClaimed(notification *data.Notification) error {
+	repository.lock.Lock()
+	stored := repository.find(notification.Id)
+	if stored.Status != data.Processing || stored.LeaseOwner != notification.LeaseOwner {
+		repository.lock.Unlock()
+		return repositories.ErrLeaseLost
+	}
+	notification.LeaseOwner = ""
+	notification.LeaseExpiresAt = nil
+	*stored = *notification
+	repository.lock.Unlock()
+
+	repository.saved <- *notification
+	return nil
+}
+
+func (repository *fakeNotificationRepository) RenewLeases(owner string, ids []int, leaseDuration time.Duration) error {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+
+	leaseExpiresAt := time.Now().Add(leaseDuration)
+	for _, id := range ids {
+		if stored := repository.find(id); stored.Status == data.Processing && stored.LeaseOwner == owner {
+			stored.LeaseExpiresAt = &leaseExpiresAt
+		}
+	}
+	return nil
+}
+
+func (repository *fakeNotificationRepository) ReleaseLeases(owner string) (int64, error) {
+	return repository.release(func(stored *data.Notification) bool { return stored.LeaseOwner == owner })
+}
+
+func (repository *fakeNotificationRepository) ReleaseExpiredLeases() (int64, error) {
+	now := time.Now()
+	return repository.release(func(stored *data.Notification) bool {
+		if !stored.LeaseExpiresAt.Before(now) {
+			return false
+		}
+		// The expiry counts as an attempt.
+		stored.AttemptCount++
+		stored.LastError = repositories.ErrLeaseExpired.Error()
+		return true
+	})
+}
+
+func (repository *fakeNotificationRepository) release(selected func(stored *data.Notification) bool) (int64, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+
+	var released int64
+	for i := range repository.notifications {
+		stored := &repository.notifications[i]
+		if stored.Status == data.Processing && selected(stored) {
+			stored.Status = data.Pending
+			stored.LeaseOwner = ""
+			stored.LeaseExpiresAt = nil
+			released++
+		}
+	}
+	return released, nil
+}
+
+// Returns the stored notification; the lock has to be held.
+func (repository *fakeNotificationRepository) find(id int) *data.Notification {
+	for i := range repository.notifications {
+		if repository.notifications[i].Id == id {
+			return &repository.notifications[i]
+		}
+	}
+	return nil
+}
+
+// Stores a notification as if it was created by another replica.
+func (repository *fakeNotificationRepository) add(notification data.Notification) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	repository.notifications = append(repository.notifications, notification)
+}
+
+// Returns a copy of the stored notification.
+func (repository *fakeNotificationRepository) stored(id int) data.Notification {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	return *repository.find(id)
+}
+
+// fakeInboxRepository keeps the delivered inbox items in memory.
+type fakeInboxRepository struct {
+	lock  sync.Mutex
+	items []data.InboxItem
+}
+
+func (repository *fakeInboxRepository) Deliver(_ context.Context, notification *data.Notification) (*data.InboxItem, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+
+	// Like the unique notification id of the inbox items, a notification which is sent again gets its item back.
+	for _, item := range repository.items {
+		if item.NotificationId == notification.Id {
+			return &item, nil
+		}
+	}
+	item := data.NewInboxItem(notification)
+	item.Id = len(repository.items) + 1
+	repository.items = append(repository.items, *item)
+	return item, nil
+}
+
+// FindAllByUserId returns a copy of the items, as the notification workers deliver to them concurrently.
+func (repository *fakeInboxRepository) FindAllByUserId(string, int, int) (*[]data.InboxItem, int64, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+	items := slices.Clone(repository.items)
+	return &items, int64(len(items)), nil
+}
+
+func (repository *fakeInboxRepository) CountUnread(string) (int64, error) {
+	return 0, nil
+}
+
+func (repository *fakeInboxRepository) MarkRead(string, int) (bool, error) {
+	return false, nil
+}
+
+func (repository *fakeInboxRepository) MarkAllRead(string) (int64, error) {
+	return 0, nil
+}
+
+func (repository *fakeInboxRepository) Archive(string, int) (bool, error) {
+	return false, nil
+}
+
+type fakeDeliveryAttemptRepository struct {
+	lock     sync.Mutex
+	attempts []data.DeliveryAttempt
+}
+
+func (repository *fakeDeliveryAttemptRepository) Add(attempt *data.DeliveryAttempt) error {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+
+	attempt.AttemptNumber = 1
+	for _, recorded := range repository.attempts {
+		if recorded.NotificationId == attempt.NotificationId {
+			attempt.AttemptNumber++
+		}
+	}
+	attempt.Id = len(repository.attempts) + 1
+	repository.attempts = append(repository.attempts, *attempt)
+	return nil
+}
+
+func (repository *fakeDeliveryAttemptRepository) FindAllByNotificationId(notificationId int) (*[]data.DeliveryAttempt, error) {
+	repository.lock.Lock()
+	defer repository.lock.Unlock()
+
+	attempts := []data.DeliveryAttempt{}
+	for _, attempt := range repository.attempts {
+		if attempt.NotificationId == notificationId {
+			attempts = append(attempts, attempt)
+		}
+	}
+	return &attempts, nil
+}
+
+// Returns the attempts recorded for the notification.
+func (repository *fakeNotificationRepository) recordedAttempts(id int) []data.DeliveryAttempt {
+	attempts, _ := repository.attempts.FindAllByNotificationId(id)
+	return *attempts
+}
+
+// Processes the notification with a Slack webhook which answers with the given status and returns the saved notification.
+func processWithSlackStatus(t *testing.T, cfg *config.Config, statusCode int, notification data.Notification) data.Notification {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+		if statusCode == http.StatusOK {
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	t.Cleanup(webhook.Close)
+	cfg.Slack.WebhookUrl = webhook.URL
+
+	service, repository := startNotificationService(t, cfg, notification)
+	service.OnNotificationsReceived([]int{notification.Id})
+
+	return awaitSaved(t, repository)
+}
+
+// Starts a notification service over the stored notifications; the service is stopped by the cleanup of the test.
+func startNotificationService(
+	t *testing.T,
+	cfg *config.Config,
+	notifications ...data.Notification,
+) (services.NotificationsService, *fakeNotificationRepository) {
+	repository := newFakeNotificationRepository(notifications...)
+	return startReplica(t, cfg, repository), repository
+}
+
+// Starts a notification service over the repository, which could be shared by several replicas.
+func startReplica(t *testing.T, cfg *config.Config, repository *fakeNotificationRepository) services.NotificationsService {
+	return startListeningReplica(t, cfg, repository, nil)
+}
+
+// Starts a notification service which is woken up by the listener, unless it is nil.
+func startListeningReplica(
+	t *testing.T,
+	cfg *config.Config,
+	repository *fakeNotificationRepository,
+	listener services.Listener,
+) services.NotificationsService {
+	// The sends held by the tests are not awaited when the service is stopped, unless a test sets the grace period.
+	if cfg.Shutdown.GracePeriod == 0 {
+		cfg.Shutdown.GracePeriod = 10 * time.Millisecond
+	}
+	lgr := logger.Setup(config.ServiceEnv{Name: "test"})
+	registry, err := notifiers.NewRegistry(cfg, notifiers.Dependencies{InboxRepository: repository.inbox}, lgr)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = registry.Close() })
+
+	// The dead-lettered notifications are reported as saved too.
+	deadLetterQueue := services.NewDeadLetterQueue(&fakeDeadLetterRepository{saved: repository.saved}, registry, nil, cfg, lgr)
+	service := services.NewNotificationService(repository, repository.attempts, deadLetterQueue, listener, registry, cfg, lgr)
+	service.StartNotificationService()
+	t.Cleanup(service.StopNotificationService)
+	return service
+}
+
+func awaitSaved(t *testing.T, repository *fakeNotificationRepository) data.Notification {
+	select {
+	case saved := <-repository.saved:
+		return saved
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "the notification was not saved")
+		return data.Notification{}
+	}
+}
+
+// A Slack webhook which holds the requests until it is released and tracks the count of the concurrent ones.
+type slowWebhook struct {
+	*httptest.Server
+	release       chan struct{}
+	requests      atomic.Int32
+	inFlight      atomic.Int32
+	maxConcurrent atomic.Int32
+}
+
+func newSlowWebhook(t *testing.T) *slowWebhook {
+	webhook := &slowWebhook{release: make(chan struct{})}
+	webhook.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhook.requests.Add(1)
+		inFlight := webhook.inFlight.Add(1)
+		defer webhook.inFlight.Add(-1)
+		for {
+			current := webhook.maxConcurrent.Load()
+			if inFlight <= current || webhook.maxConcurrent.CompareAndSwap(current, inFlight) {
+				break
+			}
+		}
+
+		<-webhook.release
+		_, _ = w.Write([]byte("ok"))
+	}))
+	// The server is closed after the notification service is stopped, which waits for the requests.
+	t.Cleanup(webhook.Close)
+	t.Cleanup(webhook.Release)
+	return webhook
+}
+
+// Release lets the held requests and the later ones through.
+func (webhook *slowWebhook) Release() {
+	select {
+	case <-webhook.release:
+	default:
+		close(webhook.release)
+	}
+}
+
+func TestNotificationService_SchedulesRetryOfTransientFailure(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Delivery.Channels = map[string]config.DeliverySettings{
+		"Slack": {Retry: config.RetryPolicy{BaseDelay: time.Minute, MaxAttempts: 3}},
+	}
+	notification := data.Notification{Id: 1, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack, AttemptCount: 1}
+
+	before := time.Now()
+	saved := processWithSlackStatus(t, cfg, http.StatusServiceUnavailable, notification)
+
+	assert.Equal(t, data.Pending, saved.Status)
+	assert.Equal(t, 2, saved.AttemptCount)
+	assert.Equal(t, http.StatusServiceUnavailable, saved.ProviderResponseCode)
+	assert.NotEmpty(t, saved.LastError)
+	// The second retry is delayed by the base delay multiplied once by the default multiplier of 2.
+	assert.WithinRange(t, saved.NextAttemptAt, before.Add(2*time.Minute), time.Now().Add(2*time.Minute))
+}
+
+func TestNotificationService_RecordsDeliveryAttempts(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		outcome    string
+	}{
+		{"Delivered", http.StatusOK, "delivered"},
+		{"TransientFailure", http.StatusServiceUnavailable, "transient"},
+		{"PermanentFailure", http.StatusNotFound, "permanent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				_, _ = w.Write([]byte("ok"))
+			}))
+			t.Cleanup(webhook.Close)
+			cfg := &config.Config{}
+			cfg.Slack.WebhookUrl = webhook.URL
+			service, repository := startNotificationService(t, cfg, slackNotifications("general", 1)...)
+
+			before := time.Now()
+			service.OnNotificationsReceived([]int{1})
+			awaitSaved(t, repository)
+
+			attempts := repository.recordedAttempts(1)
+			require.Len(t, attempts, 1)
+			assert.Equal(t, 1, attempts[0].AttemptNumber)
+			assert.Equal(t, "webhook", attempts[0].Provider)
+			assert.Equal(t, tt.outcome, attempts[0].Outcome)
+			assert.Equal(t, tt.statusCode, attempts[0].ProviderResponseCode)
+			assert.WithinRange(t, attempts[0].StartedAt, before, time.Now())
+			assert.Equal(t, tt.statusCode != http.StatusOK, attempts[0].Error != "")
+		})
+	}
+}
+
+func TestNotificationService_RecordsDeliveryAttemptPerProvider(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(primary.Close)
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(backup.Close)
+	cfg := &config.Config{}
+	cfg.Slack.Providers = []config.SlackProvider{
+		{Name: "primary", SlackConnection: config.SlackConnection{WebhookUrl: primary.URL}},
+		{Name: "backup", SlackConnection: config.SlackConnection{WebhookUrl: backup.URL}},
+	}
+	service, repository := startNotificationService(t, cfg, slackNotifications("general", 1)...)
+
+	service.OnNotificationsReceived([]int{1})
+	saved := awaitSaved(t, repository)
+
+	assert.Equal(t, data.Completed, saved.Status)
+	attempts := repository.recordedAttempts(1)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, 1, attempts[0].AttemptNumber)
+	assert.Equal(t, "primary", attempts[0].Provider)
+	assert.Equal(t, "transient", attempts[0].Outcome)
+	assert.Equal(t, http.StatusServiceUnavailable, attempts[0].ProviderResponseCode)
+	assert.NotEmpty(t, attempts[0].Error)
+	assert.Equal(t, 2, attempts[1].AttemptNumber)
+	assert.Equal(t, "backup", attempts[1].Provider)
+	assert.Equal(t, "delivered", attempts[1].Outcome)
+	assert.Empty(t, attempts[1].Error)
+	assert.False(t, attempts[1].StartedAt.Before(attempts[0].StartedAt))
+}
+
+func TestNotificationService_CompletesClaimedInAppNotification(t *testing.T) {
+	notification := data.Notification{Id: 1, Message: "m", Status: data.Pending, DeliveryChannel: data.InApp, UserId: "user-1"}
+	service, repository := startNotificationService(t, &config.Config{}, notification)
+
+	service.OnNotificationsReceived([]int{1})
+	saved := awaitSaved(t, repository)
+
+	// The result of the InApp delivery is saved under the claim like the results of the other channels.
+	assert.Equal(t, data.Completed, saved.Status)
+	assert.Equal(t, 1, saved.AttemptCount)
+	assert.Equal(t, "1", saved.ProviderMessageId)
+	assert.Empty(t, saved.LastError)
+	stored := repository.stored(1)
+	assert.Equal(t, data.Completed, stored.Status)
+	assert.Empty(t, stored.LeaseOwner)
+	assert.Nil(t, stored.LeaseExpiresAt)
+	items, _, err := repository.inbox.FindAllByUserId("user-1", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, *items, 1)
+	assert.Equal(t, "user-1", (*items)[0].UserId)
+}
+
+func TestNotificationService_FailsNotification(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCode   int
+		attemptCount int
+		status       data.NotificationStatus
+	}{
+		{"PermanentFailure", http.StatusNotFound, 0, data.Failed},
+		{"ExhaustedAttempts", http.StatusServiceUnavailable, 2, data.DeadLettered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Delivery.Defaults.Retry.MaxAttempts = 3
+			notification := data.Notification{
+				Id: 1, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack, AttemptCount: tt.attemptCount,
+			}
+
+			saved := processWithSlackStatus(t, cfg, tt.statusCode, notification)
+
+			assert.Equal(t, tt.status, saved.Status)
+			assert.Equal(t, tt.attemptCount+1, saved.AttemptCount)
+			assert.NotEmpty(t, saved.LastError)
+		})
+	}
+}
+
+func TestNotificationService_CompletesDeliveredNotification(t *testing.T) {
+	notification := data.Notification{Id: 1, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack}
+
+	saved := processWithSlackStatus(t, &config.Config{}, http.StatusOK, notification)
+
+	assert.Equal(t, data.Completed, saved.Status)
+	assert.Equal(t, 1, saved.AttemptCount)
+	assert.Empty(t, saved.LastError)
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := config.RetryPolicy{BaseDelay: 10 * time.Second, Multiplier: 3, MaxDelay: time.Minute, Jitter: 0.5}
+
+	assert.Equal(t, 10*time.Second, policy.Delay(1, 0.5))
+	assert.Equal(t, 30*time.Second, policy.Delay(2, 0.5))
+	assert.Equal(t, time.Minute, policy.Delay(3, 0.5))
+	assert.Equal(t, 5*time.Second, policy.Delay(1, 0))
+	assert.Equal(t, 15*time.Second, policy.Delay(1, 1))
+}
+
+func TestNotificationService_SlowChannelDoesNotStarveOtherChannels(t *testing.T) {
+	webhook := newSlowWebhook(t)
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = webhook.URL
+	cfg.Sink.Output = "file"
+	cfg.Sink.Path = filepath.Join(t.TempDir(), "sink.log")
+	notifications := []data.Notification{
+		{Id: 1, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack},
+		{Id: 2, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack},
+		{Id: 3, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack},
+		{Id: 4, Message: "m", Status: data.Pending, DeliveryChannel: data.Sink},
+	}
+
+	service, repository := startNotificationService(t, cfg, notifications...)
+	service.OnNotificationsReceived([]int{1, 2, 3, 4})
+
+	// The Sink notification is sent while the workers of the Slack channel are held by the webhook.
+	saved := awaitSaved(t, repository)
+	assert.Equal(t, 4, saved.Id)
+	assert.Equal(t, data.Completed, saved.Status)
+
+	webhook.Release()
+	for range 3 {
+		assert.Equal(t, data.Completed, awaitSaved(t, repository).Status)
+	}
+}
+
+func TestNotificationService_SendsUpToConcurrencyOfChannel(t *testing.T) {
+	webhook := newSlowWebhook(t)
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = webhook.URL
+	cfg.Delivery.Channels = map[string]config.DeliverySettings{"Slack": {Concurrency: 3}}
+	var notifications []data.Notification
+	var ids []int
+	for id := 1; id <= 6; id++ {
+		notifications = append(notifications, data.Notification{Id: id, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack})
+		ids = append(ids, id)
+	}
+
+	service, repository := startNotificationService(t, cfg, notifications...)
+	service.OnNotificationsReceived(ids)
+	// The notifications which are queued or being sent are not queued again.
+	service.OnNotificationsReceived(ids)
+
+	assert.Eventually(t, func() bool { return webhook.inFlight.Load() == 3 }, 5*time.Second, 10*time.Millisecond)
+	webhook.Release()
+	var savedIds []int
+	for range ids {
+		savedIds = append(savedIds, awaitSaved(t, repository).Id)
+	}
+
+	slices.Sort(savedIds)
+	assert.Equal(t, ids, savedIds)
+	assert.Equal(t, int32(3), webhook.maxConcurrent.Load())
+	assert.Equal(t, int32(6), webhook.requests.Load())
+}
+
+func TestNotificationService_ReplicasClaimEveryNotificationOnce(t *testing.T) {
+	webhook := newSlowWebhook(t)
+	webhook.Release()
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = webhook.URL
+	var notifications []data.Notification
+	var ids []int
+	for id := 1; id <= 10; id++ {
+		notifications = append(notifications, data.Notification{Id: id, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack})
+		ids = append(ids, id)
+	}
+
+	repository := newFakeNotificationRepository(notifications...)
+	replicas := []services.NotificationsService{startReplica(t, cfg, repository), startReplica(t, cfg, repository)}
+	for _, replica := range replicas {
+		replica.OnNotificationsReceived(ids)
+	}
+
+	for range ids {
+		assert.Equal(t, data.Completed, awaitSaved(t, repository).Status)
+	}
+	assert.Equal(t, int32(10), webhook.requests.Load())
+}
+
+func TestNotificationService_RenewsLeasesOfLongSends(t *testing.T) {
+	webhook := newSlowWebhook(t)
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = webhook.URL
+	cfg.Delivery.LeaseDuration = 60 * time.Millisecond
+	notification := data.Notification{Id: 1, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack}
+
+	service, repository := startNotificationService(t, cfg, notification)
+	service.OnNotificationsReceived([]int{1})
+	assert.Eventually(t, func() bool { return webhook.inFlight.Load() == 1 }, 5*time.Second, 5*time.Millisecond)
+	claimedUntil := *repository.stored(1).LeaseExpiresAt
+
+	// The send outlives its initial lease, which is renewed by the heartbeats instead of being released.
+	time.Sleep(150 * time.Millisecond)
+	stored := repository.stored(1)
+	assert.Equal(t, data.Processing, stored.Status)
+	assert.True(t, stored.LeaseExpiresAt.After(claimedUntil))
+
+	webhook.Release()
+	assert.Equal(t, data.Completed, awaitSaved(t, repository).Status)
+}
+
+func TestNotificationService_ReleasesExpiredLeases(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Sink.Output = "file"
+	cfg.Sink.Path = filepath.Join(t.TempDir(), "sink.log")
+	cfg.Delivery.LeaseDuration = 30 * time.Millisecond
+	expiredAt := time.Now().Add(-time.Minute)
+	// A notification claimed by a replica which has crashed.
+	notification := data.Notification{
+		Id: 1, Message: "m", Status: data.Processing, DeliveryChannel: data.Sink,
+		LeaseOwner: "crashed-replica", LeaseExpiresAt: &expiredAt,
+	}
+
+	service, repository := startNotificationService(t, cfg, notification)
+	assert.Eventually(t, func() bool { return repository.stored(1).Status == data.Pending }, 5*time.Second, 5*time.Millisecond)
+
+	service.OnNotificationsReceived([]int{1})
+	saved := awaitSaved(t, repository)
+	assert.Equal(t, data.Completed, saved.Status)
+	// The expired lease has counted as an attempt.
+	assert.Equal(t, 2, saved.AttemptCount)
+}
+
+func TestNotificationService_DeadLettersNotificationExhaustedByExpiredLeases(t *testing.T) {
+	var requests atomic.Int32
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(webhook.Close)
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = webhook.URL
+	cfg.Delivery.LeaseDuration = 30 * time.Millisecond
+	cfg.Delivery.Defaults.Retry.MaxAttempts = 3
+	expiredAt := time.Now().Add(-time.Minute)
+	// A notification whose sends have crashed its replicas on the earlier attempts.
+	notification := data.Notification{
+		Id: 1, Message: "m", Status: data.Processing, DeliveryChannel: data.Slack, AttemptCount: 2,
+		LeaseOwner: "crashed-replica", LeaseExpiresAt: &expiredAt,
+	}
+
+	service, repository := startNotificationService(t, cfg, notification)
+	assert.Eventually(t, func() bool { return repository.stored(1).Status == data.Pending }, 5*time.Second, 5*time.Millisecond)
+
+	service.OnNotificationsReceived([]int{1})
+	saved := awaitSaved(t, repository)
+	assert.Equal(t, data.DeadLettered, saved.Status)
+	assert.Equal(t, 3, saved.AttemptCount)
+	assert.Equal(t, repositories.ErrLeaseExpired.Error(), saved.LastError)
+	assert.Zero(t, requests.Load())
+}
+
+func TestNotificationService_StopReturnsClaimedNotificationsToPending(t *testing.T) {
+	webhook := newSlowWebhook(t)
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = webhook.URL
+	notifications := []data.Notification{
+		{Id: 1, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack},
+		{Id: 2, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack},
+		{Id: 3, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack},
+	}
+
+	service, repository := startNotificationService(t, cfg, notifications...)
+	service.OnNotificationsReceived([]int{1, 2, 3})
+	assert.Eventually(t, func() bool { return webhook.inFlight.Load() == 2 }, 5*time.Second, 5*time.Millisecond)
+	service.StopNotificationService()
+
+	for id := 1; id <= 3; id++ {
+		stored := repository.stored(id)
+		assert.Equal(t, data.Pending, stored.Status)
+		assert.Empty(t, stored.LeaseOwner)
+		assert.Zero(t, stored.AttemptCount)
+		// The sends cancelled by the stop are not recorded as attempts.
+		assert.Empty(t, repository.recordedAttempts(id))
+	}
+	assert.Empty(t, repository.saved)
+}
+
+func TestNotificationService_StopDrainsClaimedNotifications(t *testing.T) {
+	webhook := newSlowWebhook(t)
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = webhook.URL
+	cfg.Shutdown.GracePeriod = 5 * time.Second
+	repository := newFakeNotificationRepository(slackNotifications("general", 1, 2, 3)...)
+	service := startReplica(t, cfg, repository)
+
+	service.OnNotificationsReceived([]int{1, 2, 3})
+	assert.Eventually(t, func() bool { return webhook.inFlight.Load() == 2 }, 5*time.Second, 5*time.Millisecond)
+	stopped := make(chan struct{})
+	go func() {
+		service.StopNotificationService()
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	webhook.Release()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "the notification service was not stopped")
+	}
+	// Both the in-flight and the queued notifications are sent.
+	for id := 1; id <= 3; id++ {
+		assert.Equal(t, data.Completed, repository.stored(id).Status)
+	}
+	assert.Equal(t, int32(3), webhook.requests.Load())
+}
+
+// A listener which publishes the payloads sent by the test, or fails to connect when it is down.
+type fakeListener struct {
+	down     bool
+	created  chan string
+	connects atomic.Int32
+}
+
+func (listener *fakeListener) Listen(
+	ctx context.Context,
+	channel string,
+	onListening func(),
+	onNotification func(payload string),
+) error {
+	listener.connects.Add(1)
+	if listener.down {
+		return errors.New("connection refused")
+	}
+
+	onListening()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case payload := <-listener.created:
+			onNotification(payload)
+		}
+	}
+}
+
+func TestNotificationService_WakesUpOnCreatedNotifications(t *testing.T) {
+	webhook := newSlowWebhook(t)
+	webhook.Release()
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = webhook.URL
+	cfg.Delivery.PollingInterval = time.Hour
+	listener := &fakeListener{created: make(chan string)}
+	repository := newFakeNotificationRepository()
+	startListeningReplica(t, cfg, repository, listener)
+	require.Eventually(t, func() bool { return listener.connects.Load() == 1 }, 5*time.Second, 5*time.Millisecond)
+
+	repository.add(data.Notification{Id: 1, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack})
+	listener.created <- "invalid"
+	listener.created <- "1"
+
+	assert.Equal(t, data.Completed, awaitSaved(t, repository).Status)
+}
+
+func TestNotificationService_FallsBackToPollingWhileListenerIsDown(t *testing.T) {
+	webhook := newSlowWebhook(t)
+	webhook.Release()
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = webhook.URL
+	cfg.Delivery.PollingInterval = time.Hour
+	cfg.Delivery.FallbackPollingInterval = 20 * time.Millisecond
+	repository := newFakeNotificationRepository(
+		data.Notification{Id: 1, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack})
+
+	startListeningReplica(t, cfg, repository, &fakeListener{down: true})
+
+	assert.Equal(t, data.Completed, awaitSaved(t, repository).Status)
+}
+
+// Returns the stored notifications of the Slack channel with the given ids.
+func slackNotifications(slackChannel string, ids ...int) []data.Notification {
+	notifications := make([]data.Notification, 0, len(ids))
+	for _, id := range ids {
+		notifications = append(notifications, data.Notification{
+			Id: id, Message: "m", Status: data.Pending, DeliveryChannel: data.Slack, SlackChannel: slackChannel,
+		})
+	}
+	return notifications
+}
+
+func TestNotificationService_LimitsRateOfChannel(t *testing.T) {
+	webhook := newSlowWebhook(t)
+	webhook.Release()
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = webhook.URL
+	cfg.Delivery.Channels = map[string]config.DeliverySettings{
+		"Slack": {Concurrency: 4, RateLimit: config.RateLimit{Count: 10}},
+	}
+	service, repository := startNotificationService(t, cfg, slackNotifications("general", 1, 2, 3, 4)...)
+
+	start := time.Now()
+	service.OnNotificationsReceived([]int{1, 2, 3, 4})
+	for range 4 {
+		awaitSaved(t, repository)
+	}
+
+	// The first send takes the single token of the burst and the others wait 100ms each for a new one.
+	assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+}
+
+func TestNotificationService_LimitsRateOfDestination(t *testing.T) {
+	webhook := newSlowWebhook(t)
+	webhook.Release()
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = webhook.URL
+	cfg.Delivery.Channels = map[string]config.DeliverySettings{
+		"Slack": {Concurrency: 3, DestinationRateLimit: config.RateLimit{Count: 1, Period: time.Hour}},
+	}
+	notifications := append(slackNotifications("general", 1, 2), slackNotifications("random", 3)...)
+	service, repository := startNotificationService(t, cfg, notifications...)
+
+	service.OnNotificationsReceived([]int{1, 2, 3})
+	sentIds := []int{awaitSaved(t, repository).Id, awaitSaved(t, repository).Id}
+
+	// One notification of each Slack channel is sent, while the other one of 'general' waits for the next hour.
+	assert.Contains(t, sentIds, 3)
+	assert.Equal(t, int32(2), webhook.requests.Load())
+}
+
+func TestNotificationService_PausesChannelOnRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(webhook.Close)
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = webhook.URL
+	cfg.Delivery.Channels = map[string]config.DeliverySettings{"Slack": {Concurrency: 1}}
+	service, repository := startNotificationService(t, cfg, slackNotifications("general", 1, 2)...)
+
+	service.OnNotificationsReceived([]int{1, 2})
+	postponed := awaitSaved(t, repository)
+	pausedAt := time.Now()
+	sent := awaitSaved(t, repository)
+
+	// The rate limited notification is postponed without counting the attempt.
+	assert.Equal(t, data.Pending, postponed.Status)
+	assert.Equal(t, 0, postponed.AttemptCount)
+	assert.Equal(t, http.StatusTooManyRequests, postponed.ProviderResponseCode)
+	assert.WithinDuration(t, pausedAt.Add(time.Second), postponed.NextAttemptAt, 500*time.Millisecond)
+	// The next notification of the channel is sent once the pause is over.
+	assert.Equal(t, data.Completed, sent.Status)
+	assert.GreaterOrEqual(t, time.Since(pausedAt), 800*time.Millisecond)
+}
+
+func TestNotificationService_DefersNotificationsWhileCircuitIsOpen(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(webhook.Close)
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = webhook.URL
+	cfg.Delivery.Channels = map[string]config.DeliverySettings{"Slack": {
+		Concurrency:    1,
+		CircuitBreaker: config.CircuitBreakerSettings{FailureThreshold: 1, CoolDown: time.Hour},
+	}}
+	service, repository := startNotificationService(t, cfg, slackNotifications("general", 1, 2)...)
+
+	before := time.Now()
+	service.OnNotificationsReceived([]int{1, 2})
+	failed := awaitSaved(t, repository)
+	deferred := awaitSaved(t, repository)
+
+	assert.Equal(t, 1, failed.AttemptCount)
+	// The notification is not sent while the circuit is open and the attempt is not counted.
+	assert.Equal(t, data.Pending, deferred.Status)
+	assert.Equal(t, 0, deferred.AttemptCount)
+	assert.WithinRange(t, deferred.NextAttemptAt, before.Add(59*time.Minute), time.Now().Add(time.Hour))
+	// Only the sends which called the provider are recorded as attempts.
+	assert.Len(t, repository.recordedAttempts(failed.Id), 1)
+	assert.Empty(t, repository.recordedAttempts(deferred.Id))
+}
@@ -0,0 +1,34 @@
+package notifiers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/plyovchev/notifications-service/internal/config"
+)
+
+// A message published to a message broker.
+type BrokerMessage struct {
+	// The id by which the broker deduplicates the message when it is published again, e.g. after a retry.
+	Id      string
+	Headers map[string]string
+	Body    []byte
+}
+
+// Broker publishes messages to a message broker such as NATS or AMQP.
+type Broker interface {
+	// Publish returns once the broker confirmed that it stored the message.
+	// The returned id identifies the stored message within the broker.
+	Publish(ctx context.Context, subject string, message BrokerMessage) (string, error)
+	Close() error
+}
+
+// Connects to the broker of the Queue channel.
+func newBroker(cfg *config.Config) (Broker, error) {
+	switch cfg.Queue.Broker {
+	case "", "nats":
+		return newNatsBroker(cfg.Queue.Url, cfg.Queue.Username, cfg.Queue.Password)
+	default:
+		return nil, fmt.Errorf("unsupported message broker %q", cfg.Queue.Broker)
+	}
+}
@@ -0,0 +1,205 @@
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+)
+
+// ErrCircuitOpen is the error of the sends which are deferred as the circuit of their delivery channel is open.
+var ErrCircuitOpen = errors.New("circuit of the delivery channel is open")
+
+// CircuitState is the state of the circuit breaker of a delivery channel.
+type CircuitState string
+
+const (
+	// The sends are let through and their transient failures are counted.
+	CircuitClosed CircuitState = "closed"
+	// The provider is considered down and the sends are deferred until the cool-down is over.
+	CircuitOpen CircuitState = "open"
+	// The cool-down is over and trial sends are let through one at a time to probe the provider.
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitStatus is the state of the circuit breaker of a delivery channel as reported by the status APIs.
+type CircuitStatus struct {
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	// The time when the circuit was opened and the time when it lets a trial send through; set unless it is closed.
+	OpenedAt *time.Time `json:"openedAt,omitempty"`
+	RetryAt  *time.Time `json:"retryAt,omitempty"`
+}
+
+// circuitBreakerNotifier stops calling the provider of a delivery channel which is down. The circuit is opened by
+// consecutive transient failures of the sends, and the sends are then deferred without calling the provider until
+// the cool-down is over. A half-open circuit lets trial sends through one at a time; the successful ones close it,
+// while a failed one opens it again.
+type circuitBreakerNotifier struct {
+	Notifier
+	deliveryChannel data.DeliveryChannel
+	settings        config.CircuitBreakerSettings
+	logger          *logger.AppLogger
+
+	lock                 sync.Mutex
+	state                CircuitState
+	consecutiveFailures  int
+	consecutiveSuccesses int
+	openedAt             time.Time
+	trialInFlight        bool
+}
+
+func newCircuitBreakerNotifier(
+	notifier Notifier,
+	deliveryChannel data.DeliveryChannel,
+	settings config.CircuitBreakerSettings,
+	logger *logger.AppLogger,
+) *circuitBreakerNotifier {
+	return &circuitBreakerNotifier{
+		Notifier:        notifier,
+		deliveryChannel: deliveryChannel,
+		settings:        settings,
+		logger:          logger,
+		state:           CircuitClosed,
+	}
+}
+
+// SendNotification sends the notification unless the circuit defers it. The deferred sends return the time
+// after which the circuit lets a send through as their retry-after.
+func (breaker *circuitBreakerNotifier) SendNotification(ctx context.Context, notification *data.Notification) SendResult {
+	trial, retryAfter := breaker.acquire(time.Now())
+	if retryAfter > 0 {
+		return SendResult{
+			Outcome:    Deferred,
+			RetryAfter: retryAfter,
+			Err:        fmt.Errorf("%w: %s", ErrCircuitOpen, breaker.deliveryChannel),
+		}
+	}
+
+	result := breaker.Notifier.SendNotification(ctx, notification)
+	breaker.record(trial, result, ctx.Err() != nil, time.Now())
+	return result
+}
+
+// Status returns the state of the circuit.
+func (breaker *circuitBreakerNotifier) Status() CircuitStatus {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	status := CircuitStatus{State: breaker.state, ConsecutiveFailures: breaker.consecutiveFailures}
+	if breaker.state != CircuitClosed {
+		openedAt := breaker.openedAt
+		retryAt := openedAt.Add(breaker.settings.CoolDown)
+		status.OpenedAt, status.RetryAt = &openedAt, &retryAt
+	}
+	return status
+}
+
+// Lets the send through, reporting whether it is a trial send of a half-open circuit, or returns the time after which
+// the deferred send should be made again.
+func (breaker *circuitBreakerNotifier) acquire(now time.Time) (bool, time.Duration) {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	if breaker.state == CircuitOpen {
+		if remaining := breaker.openedAt.Add(breaker.settings.CoolDown).Sub(now); remaining > 0 {
+			return false, remaining
+		}
+		breaker.transition(CircuitHalfOpen, now)
+	}
+	if breaker.state == CircuitHalfOpen {
+		if breaker.trialInFlight {
+			// The other sends wait for the outcome of the trial for another cool-down.
+			return false, breaker.settings.CoolDown
+		}
+		breaker.trialInFlight = true
+		return true, 0
+	}
+	return false, 0
+}
+
+// Records the result of a send which has been let through. The transient failures count against the provider, while
+// the delivered notifications and the permanent failures show that it is up. The rate limited and the cancelled sends
+// are not counted.
+func (breaker *circuitBreakerNotifier) record(trial bool, result SendResult, cancelled bool, now time.Time) {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	if trial {
+		breaker.trialInFlight = false
+	}
+
+	switch {
+	case cancelled || result.Outcome == RateLimited:
+	case result.Outcome == TransientFailure:
+		breaker.consecutiveSuccesses = 0
+		breaker.consecutiveFailures++
+		if trial || (breaker.state == CircuitClosed && breaker.consecutiveFailures >= breaker.settings.FailureThreshold) {
+			breaker.transition(CircuitOpen, now)
+		}
+	default:
+		breaker.consecutiveFailures = 0
+		if trial {
+			breaker.consecutiveSuccesses++
+			if breaker.consecutiveSuccesses >= breaker.settings.SuccessThreshold {
+				breaker.transition(CircuitClosed, now)
+			}
+		}
+	}
+}
+
+// Moves the circuit to the state; the caller holds the lock.
+func (breaker *circuitBreakerNotifier) transition(state CircuitState, now time.Time) {
+	breaker.state = state
+	breaker.consecutiveSuccesses = 0
+
+	event := breaker.logger.Info()
+	switch state {
+	case CircuitOpen:
+		breaker.openedAt = now
+		event = breaker.logger.Warn().Time("retryAt", now.Add(breaker.settings.CoolDown))
+	case CircuitClosed:
+		breaker.consecutiveFailures = 0
+	}
+	event.
+		Str("deliveryChannel", string(breaker.deliveryChannel)).
+		Str("circuitState", string(state)).
+		Int("consecutiveFailures", breaker.consecutiveFailures).
+		Msg("The circuit of the delivery channel has changed its state.")
+}
+
+func (breaker *circuitBreakerNotifier) Preview(
+	ctx context.Context,
+	notification *data.Notification,
+	blobStore blobstore.BlobStore,
+) (Preview, error) {
+	return previewWith(ctx, breaker.Notifier, notification, blobStore)
+}
+
+// Destinations returns the destinations of the wrapped notifier, or none when it has only the default destination.
+func (breaker *circuitBreakerNotifier) Destinations() []string {
+	if destinationsNotifier, ok := breaker.Notifier.(DestinationsNotifier); ok {
+		return destinationsNotifier.Destinations()
+	}
+	return nil
+}
+
+func (breaker *circuitBreakerNotifier) CloseIdleConnections() {
+	if closer, ok := breaker.Notifier.(IdleConnectionsCloser); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+func (breaker *circuitBreakerNotifier) Close() error {
+	if closer, ok := breaker.Notifier.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package notifiers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Builds a registry with a Slack webhook which answers with the current status and counts the requests.
+func newBreakerRegistry(t *testing.T, status *atomic.Int32, requests *atomic.Int32) *notifiers.Registry {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(int(status.Load()))
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(webhook.Close)
+
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = webhook.URL
+	cfg.Delivery.Channels = map[string]config.DeliverySettings{
+		"Slack": {CircuitBreaker: config.CircuitBreakerSettings{FailureThreshold: 2, CoolDown: 50 * time.Millisecond}},
+	}
+	registry, err := notifiers.NewRegistry(cfg, notifiers.Dependencies{}, logger.Setup(config.ServiceEnv{Name: "test"}))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = registry.Close() })
+	return registry
+}
+
+func send(t *testing.T, registry *notifiers.Registry) notifiers.SendResult {
+	notifier, err := registry.Notifier(data.Slack)
+	require.NoError(t, err)
+	return notifier.SendNotification(context.Background(), &data.Notification{Message: "m", DeliveryChannel: data.Slack})
+}
+
+func TestCircuitBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	var status, requests atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	registry := newBreakerRegistry(t, &status, &requests)
+
+	assert.Equal(t, notifiers.TransientFailure, send(t, registry).Outcome)
+	assert.Equal(t, notifiers.CircuitClosed, registry.CircuitStatuses()[data.Slack].State)
+	assert.Equal(t, notifiers.TransientFailure, send(t, registry).Outcome)
+
+	circuit := registry.CircuitStatuses()[data.Slack]
+	assert.Equal(t, notifiers.CircuitOpen, circuit.State)
+	assert.Equal(t, 2, circuit.ConsecutiveFailures)
+	require.NotNil(t, circuit.RetryAt)
+
+	deferred := send(t, registry)
+	assert.Equal(t, notifiers.Deferred, deferred.Outcome)
+	assert.ErrorIs(t, deferred.Err, notifiers.ErrCircuitOpen)
+	assert.InDelta(t, 50*time.Millisecond, deferred.RetryAfter, float64(50*time.Millisecond))
+	// The deferred send does not call the provider.
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestCircuitBreaker_HalfOpenTrialClosesOrReopensCircuit(t *testing.T) {
+	var status, requests atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	registry := newBreakerRegistry(t, &status, &requests)
+	send(t, registry)
+	send(t, registry)
+
+	// A failed trial after the cool-down opens the circuit again.
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, notifiers.TransientFailure, send(t, registry).Outcome)
+	assert.Equal(t, notifiers.CircuitOpen, registry.CircuitStatuses()[data.Slack].State)
+	assert.Equal(t, notifiers.Deferred, send(t, registry).Outcome)
+
+	// A successful trial closes it.
+	status.Store(http.StatusOK)
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, notifiers.Delivered, send(t, registry).Outcome)
+	circuit := registry.CircuitStatuses()[data.Slack]
+	assert.Equal(t, notifiers.CircuitClosed, circuit.State)
+	assert.Zero(t, circuit.ConsecutiveFailures)
+	assert.Nil(t, circuit.OpenedAt)
+	assert.Equal(t, notifiers.Delivered, send(t, registry).Outcome)
+	assert.Equal(t, int32(5), requests.Load())
+}
+
+func TestCircuitBreaker_PermanentFailuresKeepCircuitClosed(t *testing.T) {
+	var status, requests atomic.Int32
+	status.Store(http.StatusNotFound)
+	registry := newBreakerRegistry(t, &status, &requests)
+
+	for range 3 {
+		assert.Equal(t, notifiers.PermanentFailure, send(t, registry).Outcome)
+	}
+	assert.Equal(t, notifiers.CircuitClosed, registry.CircuitStatuses()[data.Slack].State)
+}
@@ -0,0 +1,186 @@
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+)
+
+// DefaultDestination is the name of the destination built from the top level settings of a channel.
+const DefaultDestination = "default"
+
+// ErrUnknownDestination is returned for a notification which targets a destination that is not configured.
+var ErrUnknownDestination = errors.New("unknown destination")
+
+// An optional interface of the notifiers which deliver to more than one named destination.
+type DestinationsNotifier interface {
+	Notifier
+	// Destinations returns the names of the configured destinations in alphabetical order.
+	Destinations() []string
+}
+
+// destinationRouter sends every notification with the notifier of the destination targeted by it.
+type destinationRouter struct {
+	defaultDestination string
+	notifiers          map[string]Notifier
+}
+
+// Builds a notifier for the default settings of a channel and for each of its named destinations.
+// The build function returns ErrChannelNotConfigured for settings which are left empty; this is allowed
+// only for the default settings. The channel is disabled when it has no destinations at all.
+func newDestinationRouter[S any](
+	defaultSettings S,
+	destinations map[string]S,
+	defaultDestination string,
+	build func(destination string, settings S) (Notifier, error),
+) (Notifier, error) {
+	router := &destinationRouter{notifiers: make(map[string]Notifier)}
+
+	notifier, err := build(DefaultDestination, defaultSettings)
+	switch {
+	case err == nil:
+		router.notifiers[DefaultDestination] = notifier
+	case !errors.Is(err, ErrChannelNotConfigured):
+		return nil, err
+	}
+
+	for destination, settings := range destinations {
+		if destination == DefaultDestination {
+			_ = router.Close()
+			return nil, fmt.Errorf("the destination name %q is reserved for the top level settings", DefaultDestination)
+		}
+
+		notifier, err := build(destination, settings)
+		if errors.Is(err, ErrChannelNotConfigured) {
+			err = errors.New("the destination has no settings")
+		}
+		if err != nil {
+			_ = router.Close()
+			return nil, fmt.Errorf("destination %q: %w", destination, err)
+		}
+		router.notifiers[destination] = notifier
+	}
+
+	if len(router.notifiers) == 0 {
+		return nil, ErrChannelNotConfigured
+	}
+
+	router.defaultDestination = defaultDestination
+	if router.defaultDestination == "" {
+		router.defaultDestination = DefaultDestination
+	}
+	if _, present := router.notifiers[router.defaultDestination]; !present {
+		_ = router.Close()
+		return nil, fmt.Errorf("the default destination %q is not configured", router.defaultDestination)
+	}
+
+	return router, nil
+}
+
+// capturedNotifier sends the notifications of a channel with another notifier, e.g. the sink,
+// while keeping the destinations of the channel.
+type capturedNotifier struct {
+	Notifier
+	destinations []string
+}
+
+func (notifier *capturedNotifier) Destinations() []string {
+	return notifier.destinations
+}
+
+func (notifier *capturedNotifier) Preview(
+	ctx context.Context,
+	notification *data.Notification,
+	blobStore blobstore.BlobStore,
+) (Preview, error) {
+	return previewWith(ctx, notifier.Notifier, notification, blobStore)
+}
+
+// Returns the names of the destinations configured for the delivery channel in alphabetical order.
+// The channels without named destinations have only the default one.
+func configuredDestinations(cfg *config.Config, deliveryChannel data.DeliveryChannel) []string {
+	destinations := []string{DefaultDestination}
+	switch deliveryChannel {
+	case data.Email:
+		for destination := range cfg.Email.Destinations {
+			destinations = append(destinations, destination)
+		}
+	case data.Slack:
+		for destination := range cfg.Slack.Destinations {
+			destinations = append(destinations, destination)
+		}
+	}
+	slices.Sort(destinations)
+	return destinations
+}
+
+func (router *destinationRouter) SendNotification(ctx context.Context, notification *data.Notification) SendResult {
+	_, notifier, err := router.route(notification)
+	if err != nil {
+		return failedResult(err)
+	}
+	return notifier.SendNotification(ctx, notification)
+}
+
+// Preview renders the notification with the notifier of the destination targeted by it.
+func (router *destinationRouter) Preview(
+	ctx context.Context,
+	notification *data.Notification,
+	blobStore blobstore.BlobStore,
+) (Preview, error) {
+	destination, notifier, err := router.route(notification)
+	if err != nil {
+		return Preview{}, err
+	}
+
+	preview, err := previewWith(ctx, notifier, notification, blobStore)
+	preview.Destination = destination
+	return preview, err
+}
+
+// Returns the destination targeted by the notification together with its notifier.
+func (router *destinationRouter) route(notification *data.Notification) (string, Notifier, error) {
+	destination := notification.Destination
+	if destination == "" {
+		destination = router.defaultDestination
+	}
+
+	notifier, present := router.notifiers[destination]
+	if !present {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnknownDestination, destination)
+	}
+	return destination, notifier, nil
+}
+
+func (router *destinationRouter) Destinations() []string {
+	destinations := make([]string, 0, len(router.notifiers))
+	for destination := range router.notifiers {
+		destinations = append(destinations, destination)
+	}
+	slices.Sort(destinations)
+	return destinations
+}
+
+func (router *destinationRouter) CloseIdleConnections() {
+	for _, notifier := range router.notifiers {
+		if closer, ok := notifier.(IdleConnectionsCloser); ok {
+			closer.CloseIdleConnections()
+		}
+	}
+}
+
+func (router *destinationRouter) Close() error {
+	var errs []error
+	for _, notifier := range router.notifiers {
+		if closer, ok := notifier.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,186 @@
+package notifiers
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+type DkimCanonicalization string
+
+const (
+	DkimSimple  DkimCanonicalization = "simple"
+	DkimRelaxed DkimCanonicalization = "relaxed"
+)
+
+// The headers signed when no list is configured, as recommended by RFC 6376 section 5.4.1.
+var defaultDkimSignedHeaders = []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type"}
+
+type DkimKeyConfig struct {
+	Selector       string
+	PrivateKeyFile string
+	// The time from which the key is used for signing. Used for key rotation:
+	// the key with the latest NotBefore which is not in the future is used.
+	NotBefore time.Time
+}
+
+type DkimConfig struct {
+	Domain                 string
+	SignedHeaders          []string
+	HeaderCanonicalization DkimCanonicalization
+	BodyCanonicalization   DkimCanonicalization
+	Keys                   []DkimKeyConfig
+}
+
+type dkimKey struct {
+	selector  string
+	notBefore time.Time
+	signer    crypto.Signer
+}
+
+// dkimSigner adds a DKIM-Signature header (RFC 6376) to outgoing messages.
+type dkimSigner struct {
+	domain                 string
+	signedHeaders          []string
+	headerCanonicalization DkimCanonicalization
+	bodyCanonicalization   DkimCanonicalization
+	keys                   []dkimKey
+}
+
+// Creates a signer from the configuration. Returns nil if no DKIM domain is configured.
+func newDkimSigner(dkimConfig DkimConfig) (*dkimSigner, error) {
+	if dkimConfig.Domain == "" {
+		return nil, nil
+	}
+	if len(dkimConfig.Keys) == 0 {
+		return nil, errors.New("dkim requires at least one key")
+	}
+
+	signer := &dkimSigner{
+		domain:                 dkimConfig.Domain,
+		signedHeaders:          dkimConfig.SignedHeaders,
+		headerCanonicalization: dkimConfig.HeaderCanonicalization,
+		bodyCanonicalization:   dkimConfig.BodyCanonicalization,
+	}
+	if len(signer.signedHeaders) == 0 {
+		signer.signedHeaders = defaultDkimSignedHeaders
+	}
+	if !containsHeader(signer.signedHeaders, "From") {
+		return nil, errors.New("dkim signed headers must include From")
+	}
+
+	for _, canonicalization := range []*DkimCanonicalization{&signer.headerCanonicalization, &signer.bodyCanonicalization} {
+		switch *canonicalization {
+		case "":
+			*canonicalization = DkimRelaxed
+		case DkimSimple, DkimRelaxed:
+		default:
+			return nil, fmt.Errorf("unsupported dkim canonicalization %q", *canonicalization)
+		}
+	}
+
+	for _, keyConfig := range dkimConfig.Keys {
+		key, err := loadDkimKey(keyConfig)
+		if err != nil {
+			return nil, err
+		}
+		signer.keys = append(signer.keys, *key)
+	}
+
+	return signer, nil
+}
+
+// Sign returns the message with a DKIM-Signature header prepended, signed by the key which is active at the time.
+// The message has to use CRLF line endings.
+func (signer *dkimSigner) Sign(message []byte, now time.Time) ([]byte, error) {
+	key := signer.activeKey(now)
+	if key == nil {
+		return nil, errors.New("no dkim key is active")
+	}
+
+	var signed bytes.Buffer
+	err := dkim.Sign(&signed, bytes.NewReader(message), &dkim.SignOptions{
+		Domain:                 signer.domain,
+		Selector:               key.selector,
+		Signer:                 key.signer,
+		Hash:                   crypto.SHA256,
+		HeaderCanonicalization: dkim.Canonicalization(signer.headerCanonicalization),
+		BodyCanonicalization:   dkim.Canonicalization(signer.bodyCanonicalization),
+		HeaderKeys:             signer.signedHeaders,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign the message with the dkim key of selector %s: %w", key.selector, err)
+	}
+	return signed.Bytes(), nil
+}
+
+// Returns the key with the latest NotBefore which is not after the given time.
+func (signer *dkimSigner) activeKey(now time.Time) *dkimKey {
+	var active *dkimKey
+	for i := range signer.keys {
+		key := &signer.keys[i]
+		if key.notBefore.After(now) {
+			continue
+		}
+		if active == nil || key.notBefore.After(active.notBefore) {
+			active = key
+		}
+	}
+	return active
+}
+
+func containsHeader(names []string, name string) bool {
+	for _, candidate := range names {
+		if strings.EqualFold(candidate, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Loads an RSA or Ed25519 private key from a PEM file in PKCS #1 or PKCS #8 format.
+func loadDkimKey(keyConfig DkimKeyConfig) (*dkimKey, error) {
+	if keyConfig.Selector == "" {
+		return nil, errors.New("dkim key requires a selector")
+	}
+
+	pemBytes, err := os.ReadFile(keyConfig.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the dkim key of selector %s: %w", keyConfig.Selector, err)
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in the dkim key of selector %s", keyConfig.Selector)
+	}
+
+	var parsed any
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid dkim key of selector %s: %w", keyConfig.Selector, err)
+	}
+
+	key := &dkimKey{selector: keyConfig.Selector, notBefore: keyConfig.NotBefore}
+	switch privateKey := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.signer = privateKey
+	case ed25519.PrivateKey:
+		key.signer = privateKey
+	default:
+		return nil, fmt.Errorf("unsupported dkim key type of selector %s", keyConfig.Selector)
+	}
+	return key, nil
+}
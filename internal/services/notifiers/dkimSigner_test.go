@@ -0,0 +1,191 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dkimTestDomain = "example.com"
+
+// A DKIM key of the test together with the DNS TXT record which publishes its public key.
+type dkimTestKey struct {
+	config    DkimKeyConfig
+	txtRecord string
+}
+
+func newRsaDkimTestKey(t *testing.T, selector string, notBefore time.Time) dkimTestKey {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	return dkimTestKey{
+		config:    DkimKeyConfig{Selector: selector, PrivateKeyFile: writeTestKeyFile(t, selector, pemBytes), NotBefore: notBefore},
+		txtRecord: "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(publicKey),
+	}
+}
+
+func newEd25519DkimTestKey(t *testing.T, selector string) dkimTestKey {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return dkimTestKey{
+		config:    DkimKeyConfig{Selector: selector, PrivateKeyFile: writeTestKeyFile(t, selector, pemBytes)},
+		txtRecord: "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(publicKey),
+	}
+}
+
+func writeTestKeyFile(t *testing.T, selector string, pemBytes []byte) string {
+	path := filepath.Join(t.TempDir(), selector+".pem")
+	require.NoError(t, os.WriteFile(path, pemBytes, 0600))
+	return path
+}
+
+// Verifies the DKIM signatures of the message, resolving the public keys from the test keys.
+func verifyDkim(t *testing.T, message []byte, keys ...dkimTestKey) []*dkim.Verification {
+	options := &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			for _, key := range keys {
+				if domain == key.config.Selector+"._domainkey."+dkimTestDomain {
+					return []string{key.txtRecord}, nil
+				}
+			}
+			return nil, nil
+		},
+	}
+
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(message), options)
+	require.NoError(t, err)
+	return verifications
+}
+
+func newTestEmail(t *testing.T) []byte {
+	notification := &data.Notification{
+		Id:      42,
+		Subject: "Zahlung   storniert",
+		Message: "Payment  has failed   \nPlease check.\n\n\n",
+	}
+	message, err := buildEmailMessage(context.Background(), notification, "payments@example.com", []string{"ops@example.com"}, nil)
+	require.NoError(t, err)
+	return message
+}
+
+func TestDkimSigner_SignaturesVerify(t *testing.T) {
+	rsaKey := newRsaDkimTestKey(t, "rsa2024", time.Time{})
+	ed25519Key := newEd25519DkimTestKey(t, "ed2024")
+
+	tests := []struct {
+		name   string
+		key    dkimTestKey
+		header DkimCanonicalization
+		body   DkimCanonicalization
+	}{
+		{"RsaRelaxedRelaxed", rsaKey, DkimRelaxed, DkimRelaxed},
+		{"RsaSimpleSimple", rsaKey, DkimSimple, DkimSimple},
+		{"RsaRelaxedSimple", rsaKey, DkimRelaxed, DkimSimple},
+		{"Ed25519RelaxedRelaxed", ed25519Key, DkimRelaxed, DkimRelaxed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := newDkimSigner(DkimConfig{
+				Domain:                 dkimTestDomain,
+				HeaderCanonicalization: tt.header,
+				BodyCanonicalization:   tt.body,
+				Keys:                   []DkimKeyConfig{tt.key.config},
+			})
+			require.NoError(t, err)
+
+			signed, err := signer.Sign(newTestEmail(t), time.Now())
+			require.NoError(t, err)
+
+			verifications := verifyDkim(t, signed, tt.key)
+			require.Len(t, verifications, 1)
+			assert.NoError(t, verifications[0].Err)
+			assert.Equal(t, dkimTestDomain, verifications[0].Domain)
+			assert.Contains(t, verifications[0].HeaderKeys, "Subject")
+		})
+	}
+}
+
+func TestDkimSigner_RelaxedSurvivesWhitespaceChanges(t *testing.T) {
+	key := newRsaDkimTestKey(t, "rsa2024", time.Time{})
+	signer, err := newDkimSigner(DkimConfig{Domain: dkimTestDomain, Keys: []DkimKeyConfig{key.config}})
+	require.NoError(t, err)
+
+	signed, err := signer.Sign(newTestEmail(t), time.Now())
+	require.NoError(t, err)
+
+	// Relays may refold headers and change trailing whitespace, which relaxed canonicalization tolerates.
+	modified := bytes.Replace(signed, []byte("Subject: Zahlung   storniert"), []byte("Subject:  Zahlung\r\n\tstorniert "), 1)
+	verifications := verifyDkim(t, modified, key)
+	require.Len(t, verifications, 1)
+	assert.NoError(t, verifications[0].Err)
+
+	tampered := bytes.Replace(signed, []byte("Please check."), []byte("Please pay."), 1)
+	verifications = verifyDkim(t, tampered, key)
+	require.Len(t, verifications, 1)
+	assert.Error(t, verifications[0].Err)
+}
+
+func TestDkimSigner_KeyRotation(t *testing.T) {
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	oldKey := newRsaDkimTestKey(t, "s2024", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	currentKey := newRsaDkimTestKey(t, "s2025", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	futureKey := newRsaDkimTestKey(t, "s2026", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	signer, err := newDkimSigner(DkimConfig{
+		Domain: dkimTestDomain,
+		Keys:   []DkimKeyConfig{oldKey.config, futureKey.config, currentKey.config},
+	})
+	require.NoError(t, err)
+
+	signed, err := signer.Sign(newTestEmail(t), now)
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(string(signed), "s=s2025;"))
+
+	verifications := verifyDkim(t, signed, oldKey, currentKey, futureKey)
+	require.Len(t, verifications, 1)
+	assert.NoError(t, verifications[0].Err)
+}
+
+func TestDkimSigner_InvalidConfig(t *testing.T) {
+	key := newRsaDkimTestKey(t, "rsa2024", time.Time{})
+
+	signer, err := newDkimSigner(DkimConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, signer)
+
+	_, err = newDkimSigner(DkimConfig{Domain: dkimTestDomain})
+	assert.Error(t, err)
+
+	_, err = newDkimSigner(DkimConfig{Domain: dkimTestDomain, Keys: []DkimKeyConfig{{Selector: "missing", PrivateKeyFile: "missing.pem"}}})
+	assert.Error(t, err)
+
+	_, err = newDkimSigner(DkimConfig{Domain: dkimTestDomain, SignedHeaders: []string{"Subject"}, Keys: []DkimKeyConfig{key.config}})
+	assert.Error(t, err)
+
+	_, err = newDkimSigner(DkimConfig{Domain: dkimTestDomain, BodyCanonicalization: "nowsp", Keys: []DkimKeyConfig{key.config}})
+	assert.Error(t, err)
+}
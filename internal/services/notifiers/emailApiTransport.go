@@ -0,0 +1,110 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/config"
+)
+
+// The maximum size of an email API response body which is read for error reporting.
+const emailApiResponseLimit = 4096
+
+type EmailApiConfig struct {
+	Url string
+	Key string
+}
+
+// EmailApiError is returned when the HTTP email API rejects a message.
+type EmailApiError struct {
+	StatusCode int
+	Message    string
+	// The Retry-After hint of a rate limited request.
+	RetryAfter time.Duration
+}
+
+func (err *EmailApiError) Error() string {
+	return fmt.Sprintf("email api request failed with http status %d: %s", err.StatusCode, err.Message)
+}
+
+// The body of a send request to the HTTP email API. The message is the complete
+// RFC 5322 message, so it is sent exactly as it would be sent over SMTP (including the DKIM signature).
+type emailApiRequest struct {
+	From       string   `json:"from"`
+	Recipients []string `json:"recipients"`
+	// Encoded as base64 by the JSON encoder.
+	RawMessage []byte `json:"rawMessage"`
+}
+
+// The optional body of a successful response of the HTTP email API.
+type emailApiResponse struct {
+	MessageId string `json:"messageId"`
+}
+
+// emailApiTransport sends messages to an HTTP email API authenticated with a bearer key.
+type emailApiTransport struct {
+	EmailApiConfig
+	httpClient *http.Client
+}
+
+func newEmailApiTransport(apiConfig EmailApiConfig) *emailApiTransport {
+	return &emailApiTransport{
+		EmailApiConfig: apiConfig,
+		httpClient:     &http.Client{},
+	}
+}
+
+// Send posts the message to the email API and returns the message id from its response, if any.
+func (transport *emailApiTransport) Send(ctx context.Context, from string, recipients []string, message []byte) (string, int, error) {
+	body, err := json.Marshal(emailApiRequest{From: from, Recipients: recipients, RawMessage: message})
+	if err != nil {
+		return "", 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, transport.Url, bytes.NewReader(body))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if requestId := requestIdFromContext(ctx); requestId != "" {
+		req.Header.Set(config.RequestIdentifier, requestId)
+	}
+	if transport.Key != "" {
+		req.Header.Set("Authorization", "Bearer "+transport.Key)
+	}
+
+	resp, err := transport.httpClient.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, emailApiResponseLimit))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message := strings.TrimSpace(string(responseBody))
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return "", resp.StatusCode, &EmailApiError{
+			StatusCode: resp.StatusCode,
+			Message:    message,
+			RetryAfter: parseRetryAfter(resp.Header),
+		}
+	}
+
+	var response emailApiResponse
+	_ = json.Unmarshal(responseBody, &response)
+	return response.MessageId, resp.StatusCode, nil
+}
+
+// Close releases the idle HTTP connections.
+func (transport *emailApiTransport) Close() error {
+	transport.httpClient.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,257 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+)
+
+const (
+	defaultEmailSubject = "Notification"
+	// The maximum line length of base64 encoded content as recommended by RFC 2045.
+	base64LineLength = 76
+)
+
+// Builds an RFC 5322 message for the notification with a multipart/alternative body
+// which contains a plain text and an HTML version of the message.
+// When the notification has attachments, the body is multipart/mixed with the alternative
+// body as its first part followed by the attachments read from the blob store.
+// Non-ASCII header values are encoded according to RFC 2047.
+func buildEmailMessage(
+	ctx context.Context,
+	notification *data.Notification,
+	from string,
+	recipients []string,
+	blobStore blobstore.BlobStore,
+) ([]byte, error) {
+	fromAddress, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", from, err)
+	}
+
+	toAddresses := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		toAddress, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient address %q: %w", recipient, err)
+		}
+		toAddresses[i] = toAddress.String()
+	}
+
+	date := notification.CreatedAt
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var message bytes.Buffer
+	body := multipart.NewWriter(&message)
+
+	bodyType := "multipart/alternative"
+	if len(notification.Attachments) > 0 {
+		bodyType = "multipart/mixed"
+	}
+
+	writeHeader(&message, "From", fromAddress.String())
+	writeHeader(&message, "To", strings.Join(toAddresses, ", "))
+	writeHeader(&message, "Subject", mime.QEncoding.Encode("utf-8", emailSubject(notification)))
+	writeHeader(&message, "Date", date.Format(time.RFC1123Z))
+	writeHeader(&message, "Message-ID", emailMessageId(notification, fromAddress.Address))
+	if requestId := requestIdFromContext(ctx); requestId != "" {
+		writeHeader(&message, config.RequestIdentifier, mime.QEncoding.Encode("utf-8", requestId))
+	}
+	writeHeader(&message, "MIME-Version", "1.0")
+	writeHeader(&message, "Content-Type", mime.FormatMediaType(bodyType, map[string]string{"boundary": body.Boundary()}))
+	message.WriteString("\r\n")
+
+	if len(notification.Attachments) == 0 {
+		if err := writeAlternativeParts(body, notification); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := writeMixedParts(body, notification, blobStore); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	return message.Bytes(), nil
+}
+
+// Writes the plain text and the HTML versions of the message.
+func writeAlternativeParts(body *multipart.Writer, notification *data.Notification) error {
+	if err := writeTextPart(body, "text/plain", notification.Message); err != nil {
+		return err
+	}
+	return writeTextPart(body, "text/html", emailHtml(notification))
+}
+
+// Writes the alternative body as a nested part followed by a part for each attachment.
+func writeMixedParts(body *multipart.Writer, notification *data.Notification, blobStore blobstore.BlobStore) error {
+	alternativeBoundary := multipart.NewWriter(io.Discard).Boundary()
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": alternativeBoundary}))
+
+	part, err := body.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	alternative := multipart.NewWriter(part)
+	if err := alternative.SetBoundary(alternativeBoundary); err != nil {
+		return err
+	}
+	if err := writeAlternativeParts(alternative, notification); err != nil {
+		return err
+	}
+	if err := alternative.Close(); err != nil {
+		return err
+	}
+
+	for i := range notification.Attachments {
+		if err := writeAttachmentPart(body, &notification.Attachments[i], blobStore); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes the content of the attachment as a base64 encoded part.
+// Non-ASCII filenames are encoded according to RFC 2231.
+func writeAttachmentPart(body *multipart.Writer, attachment *data.Attachment, blobStore blobstore.BlobStore) error {
+	if blobStore == nil {
+		return errors.New("no blob store for the email attachments")
+	}
+
+	content, err := blobStore.Open(attachment.BlobId)
+	if err != nil {
+		return fmt.Errorf("failed to open the attachment %q: %w", attachment.Filename, err)
+	}
+	defer content.Close()
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType(attachment.ContentType, map[string]string{"name": attachment.Filename}))
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	header.Set("Content-Transfer-Encoding", "base64")
+
+	part, err := body.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	lines := &lineWrapper{writer: part, lineLength: base64LineLength}
+	encoder := base64.NewEncoder(base64.StdEncoding, lines)
+	if _, err := io.Copy(encoder, content); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	return lines.Close()
+}
+
+// Returns the subject of the notification email, falling back to the notification key.
+func emailSubject(notification *data.Notification) string {
+	if notification.Subject != "" {
+		return notification.Subject
+	}
+	if notification.Key != "" {
+		return notification.Key
+	}
+	return defaultEmailSubject
+}
+
+// Returns a Message-ID which is stable for the notification, so a resent email is recognized as the same message.
+func emailMessageId(notification *data.Notification, fromAddress string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(fromAddress, "@"); at != -1 {
+		domain = fromAddress[at+1:]
+	}
+	return fmt.Sprintf("<notification-%d@%s>", notification.Id, domain)
+}
+
+// Renders the notification message as a minimal HTML document.
+func emailHtml(notification *data.Notification) string {
+	message := strings.ReplaceAll(html.EscapeString(notification.Message), "\n", "<br>\n")
+	return "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>" +
+		html.EscapeString(emailSubject(notification)) +
+		"</title></head><body><p>" + message + "</p></body></html>"
+}
+
+func writeHeader(message *bytes.Buffer, name string, value string) {
+	message.WriteString(name + ": " + value + "\r\n")
+}
+
+// Writes the text as a quoted-printable encoded UTF-8 part of the given media type.
+func writeTextPart(body *multipart.Writer, mediaType string, text string) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mediaType+"; charset=utf-8")
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	part, err := body.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	encoder := quotedprintable.NewWriter(part)
+	if _, err := encoder.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// lineWrapper breaks the written content into CRLF terminated lines of the given length.
+type lineWrapper struct {
+	writer     io.Writer
+	lineLength int
+	written    int
+}
+
+func (wrapper *lineWrapper) Write(content []byte) (int, error) {
+	total := 0
+	for len(content) > 0 {
+		chunk := min(wrapper.lineLength-wrapper.written, len(content))
+		n, err := wrapper.writer.Write(content[:chunk])
+		total += n
+		if err != nil {
+			return total, err
+		}
+
+		wrapper.written += chunk
+		content = content[chunk:]
+		if wrapper.written == wrapper.lineLength {
+			if _, err := wrapper.writer.Write([]byte("\r\n")); err != nil {
+				return total, err
+			}
+			wrapper.written = 0
+		}
+	}
+	return total, nil
+}
+
+// Close terminates the last line if it is not complete.
+func (wrapper *lineWrapper) Close() error {
+	if wrapper.written == 0 {
+		return nil
+	}
+	wrapper.written = 0
+	_, err := wrapper.writer.Write([]byte("\r\n"))
+	return err
+}
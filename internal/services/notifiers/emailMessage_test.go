@@ -0,0 +1,135 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildEmailMessage(t *testing.T) {
+	notification := &data.Notification{
+		Id:        42,
+		Key:       "payment-cancelled",
+		Subject:   "Zahlung storniert – Händler",
+		Message:   "Payment <42> has failed\nPlease check.",
+		CreatedAt: time.Date(2024, 4, 27, 8, 0, 0, 0, time.UTC),
+	}
+
+	raw, err := buildEmailMessage(context.Background(), notification, "Payments <payments@example.com>", []string{"ops@example.com", "risk@example.com"}, nil)
+	require.NoError(t, err)
+
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(message.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, notification.Subject, subject)
+	assert.NotEqual(t, notification.Subject, message.Header.Get("Subject"), "non-ASCII subject should be encoded")
+
+	assert.Equal(t, `"Payments" <payments@example.com>`, message.Header.Get("From"))
+	assert.Equal(t, "<ops@example.com>, <risk@example.com>", message.Header.Get("To"))
+	assert.Equal(t, "<notification-42@example.com>", message.Header.Get("Message-ID"))
+	assert.Equal(t, "1.0", message.Header.Get("MIME-Version"))
+	date, err := message.Header.Date()
+	require.NoError(t, err)
+	assert.True(t, notification.CreatedAt.Equal(date))
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	parts := multipart.NewReader(message.Body, params["boundary"])
+
+	textPart, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", textPart.Header.Get("Content-Type"))
+	text, _ := io.ReadAll(textPart)
+	assert.Equal(t, "Payment <42> has failed\r\nPlease check.", string(text))
+
+	htmlPart, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "text/html; charset=utf-8", htmlPart.Header.Get("Content-Type"))
+	html, _ := io.ReadAll(htmlPart)
+	assert.Contains(t, string(html), "Payment &lt;42&gt; has failed<br>")
+
+	_, err = parts.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestBuildEmailMessage_SubjectFallsBackToKey(t *testing.T) {
+	raw, err := buildEmailMessage(context.Background(), &data.Notification{Id: 1, Key: "payment-cancelled", Message: "m"}, "payments@example.com", []string{"ops@example.com"}, nil)
+	require.NoError(t, err)
+
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.Equal(t, "payment-cancelled", message.Header.Get("Subject"))
+}
+
+func TestBuildEmailMessage_InvalidRecipient(t *testing.T) {
+	_, err := buildEmailMessage(context.Background(), &data.Notification{Message: "m"}, "payments@example.com", []string{"not an address"}, nil)
+
+	assert.Error(t, err)
+}
+
+func TestBuildEmailMessage_WithAttachments(t *testing.T) {
+	store, err := blobstore.NewLocalBlobStore(t.TempDir())
+	require.NoError(t, err)
+	content := strings.Repeat("date,amount\n2024-04-27,42.00\n", 10)
+	blobId, size, err := store.Put(strings.NewReader(content))
+	require.NoError(t, err)
+
+	notification := &data.Notification{
+		Id:      7,
+		Message: "Settlement report attached",
+		Attachments: []data.Attachment{
+			{BlobId: blobId, Filename: "Abrechnung-März.csv", ContentType: "text/csv", Size: size},
+		},
+	}
+
+	raw, err := buildEmailMessage(context.Background(), notification, "payments@example.com", []string{"finance@example.com"}, store)
+	require.NoError(t, err)
+
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	parts := multipart.NewReader(message.Body, params["boundary"])
+
+	alternativePart, err := parts.NextPart()
+	require.NoError(t, err)
+	alternativeType, _, err := mime.ParseMediaType(alternativePart.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", alternativeType)
+
+	attachmentPart, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "Abrechnung-März.csv", attachmentPart.FileName())
+	assert.Equal(t, "base64", attachmentPart.Header.Get("Content-Transfer-Encoding"))
+
+	encoded, err := io.ReadAll(attachmentPart)
+	require.NoError(t, err)
+	for _, line := range strings.Split(strings.TrimSpace(string(encoded)), "\r\n") {
+		assert.LessOrEqual(t, len(line), 76)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(decoded))
+
+	_, err = parts.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -1,45 +1,244 @@
 package notifiers
 
 import (
-	"net/smtp"
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"time"
 
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
 	"github.com/plyovchev/notifications-service/internal/logger"
 	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/util"
 )
 
 type EmailSenderConfig struct {
 	From       string
-	Password   string
 	Recipients []string
-	SmtpHost   string
-	SmtpPort   string
+	SmtpTransportConfig
+	// The HTTP email API through which the emails are sent instead of SMTP when its url is set.
+	Api  EmailApiConfig
+	Dkim DkimConfig
+}
+
+// The transport over which the email messages are delivered.
+type emailTransport interface {
+	// Send returns the id which the transport assigned to the message, if any, and the response code of the server.
+	Send(ctx context.Context, from string, recipients []string, message []byte) (string, int, error)
+	Close() error
+}
+
+const (
+	emailProviderSmtp    = "smtp"
+	emailProviderHttpApi = "http_api"
+	// The name of the provider built from the top level SMTP settings of a destination.
+	defaultSmtpProviderName = "smtp"
+)
+
+func init() {
+	RegisterFactory(data.Email, newEmailNotifierFromConfig)
 }
 
 type EmailNotifier struct {
 	EmailSenderConfig
-	logger *logger.AppLogger
+	logger    *logger.AppLogger
+	transport emailTransport
+	blobStore blobstore.BlobStore
+	// Signs the outgoing emails; nil when DKIM signing is not configured.
+	dkimSigner *dkimSigner
 }
 
-func NewEmailNotifier(emailSenderConfig EmailSenderConfig, logger *logger.AppLogger) *EmailNotifier {
+func NewEmailNotifier(
+	emailSenderConfig EmailSenderConfig,
+	blobStore blobstore.BlobStore,
+	logger *logger.AppLogger,
+) (*EmailNotifier, error) {
+	if emailSenderConfig.Username == "" {
+		emailSenderConfig.Username = emailSenderConfig.From
+	}
+
+	var transport emailTransport = newEmailApiTransport(emailSenderConfig.Api)
+	if emailSenderConfig.Api.Url == "" {
+		smtpTransport, err := newSmtpTransport(emailSenderConfig.SmtpTransportConfig)
+		if err != nil {
+			return nil, err
+		}
+		transport = smtpTransport
+	}
+
+	signer, err := newDkimSigner(emailSenderConfig.Dkim)
+	if err != nil {
+		return nil, err
+	}
+
 	return &EmailNotifier{
 		logger:            logger,
 		EmailSenderConfig: emailSenderConfig,
-	}
+		transport:         transport,
+		blobStore:         blobStore,
+		dkimSigner:        signer,
+	}, nil
 }
 
-func (notifier *EmailNotifier) SendNotification(notification *data.Notification) error {
+// SendNotification sends the notification as an email. The message id of the result is the id assigned
+// by the HTTP email API or, for SMTP, the Message-ID header of the email.
+func (notifier *EmailNotifier) SendNotification(ctx context.Context, notification *data.Notification) SendResult {
 	notifier.logger.Debug().Msg("Sending email.")
 
-	// Authentication.
-	auth := smtp.PlainAuth("", notifier.From, notifier.Password, notifier.SmtpHost)
-
-	err := smtp.SendMail(notifier.SmtpHost+":"+notifier.SmtpPort, auth, notifier.From, notifier.Recipients, []byte(notification.Message))
+	// The message could not be built by any provider, so such failures are permanent.
+	message, err := notifier.buildMessage(ctx, notification, notifier.blobStore)
+	if err != nil {
+		return failedResult(&PermanentError{Err: err})
+	}
 
+	messageId, responseCode, err := notifier.transport.Send(ctx, notifier.From, notifier.Recipients, message)
 	if err != nil {
-		return err
+		return failedResult(err)
+	}
+	if messageId == "" {
+		// The sender address is validated by the building of the message.
+		fromAddress, _ := mail.ParseAddress(notifier.From)
+		messageId = emailMessageId(notification, fromAddress.Address)
 	}
 
 	notifier.logger.Debug().Msg("Email has been sent.")
 
+	return deliveredResult(messageId, responseCode)
+}
+
+// Preview renders the email as the complete RFC 5322 message, including the DKIM signature.
+func (notifier *EmailNotifier) Preview(
+	ctx context.Context,
+	notification *data.Notification,
+	blobStore blobstore.BlobStore,
+) (Preview, error) {
+	message, err := notifier.buildMessage(ctx, notification, blobStore)
+	if err != nil {
+		return Preview{}, err
+	}
+	return Preview{Recipients: notifier.Recipients, ContentType: "message/rfc822", Payload: string(message)}, nil
+}
+
+// Builds the email message of the notification and signs it when DKIM signing is configured.
+func (notifier *EmailNotifier) buildMessage(
+	ctx context.Context,
+	notification *data.Notification,
+	blobStore blobstore.BlobStore,
+) ([]byte, error) {
+	message, err := buildEmailMessage(ctx, notification, notifier.From, notifier.Recipients, blobStore)
+	if err != nil || notifier.dkimSigner == nil {
+		return message, err
+	}
+	return notifier.dkimSigner.Sign(message, time.Now())
+}
+
+// CloseIdleConnections closes the SMTP connections kept for reuse.
+func (notifier *EmailNotifier) CloseIdleConnections() {
+	_ = notifier.transport.Close()
+}
+
+// Close closes the SMTP connections kept for reuse.
+func (notifier *EmailNotifier) Close() error {
+	return notifier.transport.Close()
+}
+
+// Builds the email notifier of every configured destination.
+func newEmailNotifierFromConfig(cfg *config.Config, dependencies Dependencies, logger *logger.AppLogger) (Notifier, error) {
+	build := func(_ string, settings config.EmailDestination) (Notifier, error) {
+		return newEmailDestinationNotifier(settings, dependencies, logger)
+	}
+	return newDestinationRouter(cfg.Email.EmailDestination, cfg.Email.Destinations, cfg.Email.DefaultDestination, build)
+}
+
+// Builds the email notifier of a destination with its providers in the configured order.
+// The top level SMTP settings are the only provider when no providers are listed;
+// the destination is not configured when neither is set.
+func newEmailDestinationNotifier(
+	settings config.EmailDestination,
+	dependencies Dependencies,
+	logger *logger.AppLogger,
+) (Notifier, error) {
+	providerSettings := settings.Providers
+	if len(providerSettings) == 0 {
+		if settings.SmtpHost == "" {
+			return nil, ErrChannelNotConfigured
+		}
+		providerSettings = []config.EmailProvider{{Name: defaultSmtpProviderName, SmtpSettings: settings.SmtpSettings}}
+	}
+
+	if _, err := mail.ParseAddress(settings.From); err != nil {
+		return nil, fmt.Errorf("invalid from address: %w", err)
+	}
+	if len(settings.Recipients) == 0 {
+		return nil, errors.New("at least one recipient is required")
+	}
+	for _, recipient := range settings.Recipients {
+		if _, err := mail.ParseAddress(recipient); err != nil {
+			return nil, fmt.Errorf("invalid recipient address %q: %w", recipient, err)
+		}
+	}
+
+	providers, err := newProviders(
+		providerSettings,
+		func(provider config.EmailProvider) string { return provider.Name },
+		func(provider config.EmailProvider) (Notifier, error) {
+			if err := validateEmailProvider(provider); err != nil {
+				return nil, err
+			}
+			return NewEmailNotifier(newEmailSenderConfig(settings, provider), dependencies.BlobStore, logger)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return newFailoverNotifier(providers, logger), nil
+}
+
+func validateEmailProvider(provider config.EmailProvider) error {
+	switch provider.Kind {
+	case emailProviderSmtp, "":
+		if provider.SmtpHost == "" || provider.SmtpPort == "" {
+			return errors.New("smtp_host and smtp_port are required")
+		}
+	case emailProviderHttpApi:
+		if err := validateHttpUrl(provider.ApiUrl); err != nil {
+			return fmt.Errorf("invalid api_url: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported provider kind %q", provider.Kind)
+	}
 	return nil
 }
+
+// Maps the settings of an email destination and one of its providers to the configuration of the email notifier.
+func newEmailSenderConfig(settings config.EmailDestination, provider config.EmailProvider) EmailSenderConfig {
+	senderConfig := EmailSenderConfig{
+		From:       settings.From,
+		Recipients: settings.Recipients,
+		SmtpTransportConfig: SmtpTransportConfig{
+			Host:               provider.SmtpHost,
+			Port:               provider.SmtpPort,
+			Username:           provider.Username,
+			Password:           provider.Password,
+			TlsMode:            SmtpTlsMode(provider.TlsMode),
+			Auth:               SmtpAuthMechanism(provider.Auth),
+			CaCertFile:         provider.CaCertFile,
+			MaxIdleConnections: provider.MaxIdleConnections,
+		},
+		Dkim: DkimConfig{
+			Domain:                 settings.Dkim.Domain,
+			SignedHeaders:          settings.Dkim.SignedHeaders,
+			HeaderCanonicalization: DkimCanonicalization(settings.Dkim.HeaderCanonicalization),
+			BodyCanonicalization:   DkimCanonicalization(settings.Dkim.BodyCanonicalization),
+			Keys: util.Map(settings.Dkim.Keys, func(key config.DkimKey) DkimKeyConfig {
+				return DkimKeyConfig{Selector: key.Selector, PrivateKeyFile: key.PrivateKeyFile, NotBefore: key.NotBefore}
+			}),
+		},
+	}
+	if provider.Kind == emailProviderHttpApi {
+		senderConfig.Api = EmailApiConfig{Url: provider.ApiUrl, Key: provider.ApiKey}
+	}
+	return senderConfig
+}
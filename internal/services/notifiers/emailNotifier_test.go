@@ -0,0 +1,161 @@
+package notifiers_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEmailNotifier(t *testing.T, server *fakeSmtpServer, transportConfig notifiers.SmtpTransportConfig) *notifiers.EmailNotifier {
+	transportConfig.Host = "127.0.0.1"
+	transportConfig.Port = server.port()
+	transportConfig.Password = smtpTestPassword
+
+	emailSenderConfig := notifiers.EmailSenderConfig{
+		From:                smtpTestUsername,
+		Recipients:          []string{"ops@example.com"},
+		SmtpTransportConfig: transportConfig,
+	}
+	notifier, err := notifiers.NewEmailNotifier(emailSenderConfig, nil, logger.Setup(config.ServiceEnv{Name: "test"}))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = notifier.Close() })
+	return notifier
+}
+
+func TestEmailNotifier_ReusesConnection(t *testing.T) {
+	server, _ := startFakeSmtpServer(t, fakeSmtpServerOptions{authMechanisms: "PLAIN"})
+	notifier := newEmailNotifier(t, server, notifiers.SmtpTransportConfig{TlsMode: notifiers.SmtpTlsNone})
+
+	require.NoError(t, notifier.SendNotification(context.Background(), &data.Notification{Id: 1, Message: "first"}).Err)
+	require.NoError(t, notifier.SendNotification(context.Background(), &data.Notification{Id: 2, Message: "second"}).Err)
+
+	connections, messages, _ := server.stats()
+	assert.Equal(t, 1, connections)
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages[0], "Message-ID: <notification-1@example.com>")
+	assert.Contains(t, messages[1], "Message-ID: <notification-2@example.com>")
+}
+
+func TestEmailNotifier_DropsConnectionAfterFailure(t *testing.T) {
+	server, _ := startFakeSmtpServer(t, fakeSmtpServerOptions{})
+	notifier := newEmailNotifier(t, server, notifiers.SmtpTransportConfig{TlsMode: notifiers.SmtpTlsNone, Auth: notifiers.SmtpAuthNone})
+	notifier.Recipients = []string{"rejected@example.com"}
+
+	require.Error(t, notifier.SendNotification(context.Background(), &data.Notification{Id: 1, Message: "first"}).Err)
+
+	notifier.Recipients = []string{"ops@example.com"}
+	require.NoError(t, notifier.SendNotification(context.Background(), &data.Notification{Id: 2, Message: "second"}).Err)
+
+	connections, messages, _ := server.stats()
+	assert.Equal(t, 2, connections)
+	assert.Len(t, messages, 1)
+}
+
+func TestEmailNotifier_TlsModesAndAuthMechanisms(t *testing.T) {
+	tests := []struct {
+		name          string
+		serverOptions fakeSmtpServerOptions
+		tlsMode       notifiers.SmtpTlsMode
+		auth          notifiers.SmtpAuthMechanism
+		expectTls     bool
+	}{
+		{"StartTlsRequiredPlain", fakeSmtpServerOptions{startTls: true, authMechanisms: "PLAIN"}, notifiers.SmtpStartTlsRequired, notifiers.SmtpAuthPlain, true},
+		{"StartTlsOptionalWithoutSupport", fakeSmtpServerOptions{authMechanisms: "PLAIN"}, notifiers.SmtpStartTlsOptional, notifiers.SmtpAuthPlain, false},
+		{"ImplicitTlsLogin", fakeSmtpServerOptions{implicitTls: true, authMechanisms: "LOGIN"}, notifiers.SmtpImplicitTls, notifiers.SmtpAuthLogin, true},
+		{"CramMd5", fakeSmtpServerOptions{authMechanisms: "CRAM-MD5"}, notifiers.SmtpTlsNone, notifiers.SmtpAuthCramMd5, false},
+		{"NoAuthRelay", fakeSmtpServerOptions{startTls: true}, notifiers.SmtpStartTlsOptional, notifiers.SmtpAuthNone, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, caCertFile := startFakeSmtpServer(t, tt.serverOptions)
+			notifier := newEmailNotifier(t, server, notifiers.SmtpTransportConfig{
+				TlsMode:    tt.tlsMode,
+				Auth:       tt.auth,
+				CaCertFile: caCertFile,
+			})
+
+			require.NoError(t, notifier.SendNotification(context.Background(), &data.Notification{Id: 1, Message: "message"}).Err)
+
+			_, messages, usedTls := server.stats()
+			require.Len(t, messages, 1)
+			assert.Equal(t, tt.expectTls, usedTls[0])
+		})
+	}
+}
+
+func TestEmailNotifier_StartTlsRequiredWithoutSupport(t *testing.T) {
+	server, _ := startFakeSmtpServer(t, fakeSmtpServerOptions{authMechanisms: "PLAIN"})
+	notifier := newEmailNotifier(t, server, notifiers.SmtpTransportConfig{TlsMode: notifiers.SmtpStartTlsRequired})
+
+	err := notifier.SendNotification(context.Background(), &data.Notification{Id: 1, Message: "message"}).Err
+
+	assert.ErrorIs(t, err, notifiers.ErrStartTlsNotSupported)
+}
+
+func TestEmailNotifier_InvalidConfig(t *testing.T) {
+	lgr := logger.Setup(config.ServiceEnv{Name: "test"})
+
+	_, err := notifiers.NewEmailNotifier(notifiers.EmailSenderConfig{SmtpTransportConfig: notifiers.SmtpTransportConfig{TlsMode: "ssl"}}, nil, lgr)
+	assert.Error(t, err)
+
+	_, err = notifiers.NewEmailNotifier(notifiers.EmailSenderConfig{SmtpTransportConfig: notifiers.SmtpTransportConfig{Auth: "xoauth2"}}, nil, lgr)
+	assert.Error(t, err)
+}
+
+func TestEmailNotifier_HungServerTimesOut(t *testing.T) {
+	// A server which accepts connections but never sends its greeting.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+	}()
+
+	emailSenderConfig := notifiers.EmailSenderConfig{
+		From:       smtpTestUsername,
+		Recipients: []string{"ops@example.com"},
+		SmtpTransportConfig: notifiers.SmtpTransportConfig{
+			Host:    "127.0.0.1",
+			Port:    strconv.Itoa(listener.Addr().(*net.TCPAddr).Port),
+			TlsMode: notifiers.SmtpTlsNone,
+			Auth:    notifiers.SmtpAuthNone,
+		},
+	}
+	notifier, err := notifiers.NewEmailNotifier(emailSenderConfig, nil, logger.Setup(config.ServiceEnv{Name: "test"}))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = notifier.SendNotification(ctx, &data.Notification{Id: 1, Message: "message"}).Err
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestEmailNotifier_PropagatesRequestId(t *testing.T) {
+	server, _ := startFakeSmtpServer(t, fakeSmtpServerOptions{})
+	notifier := newEmailNotifier(t, server, notifiers.SmtpTransportConfig{TlsMode: notifiers.SmtpTlsNone, Auth: notifiers.SmtpAuthNone})
+
+	ctx := context.WithValue(context.Background(), config.ContextKey(config.RequestIdentifier), "request-42")
+	require.NoError(t, notifier.SendNotification(ctx, &data.Notification{Id: 1, Message: "message"}).Err)
+
+	_, messages, _ := server.stats()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0], "\nX-Request-ID: request-42\n")
+}
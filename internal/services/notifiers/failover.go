@@ -0,0 +1,142 @@
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+)
+
+// A named provider of a delivery channel, e.g. an SMTP relay or an HTTP email API.
+type provider struct {
+	name     string
+	notifier Notifier
+}
+
+// failoverNotifier sends the notifications through the first of its providers which delivers them.
+// A send falls through to the next provider only on a transient failure, as a permanent failure
+// would be repeated by the other providers too.
+type failoverNotifier struct {
+	providers []provider
+	logger    *logger.AppLogger
+}
+
+func newFailoverNotifier(providers []provider, logger *logger.AppLogger) *failoverNotifier {
+	return &failoverNotifier{providers: providers, logger: logger}
+}
+
+// SendNotification records the name of the provider which delivered the notification on it, while the result names
+// the provider which was tried last and lists the tries of all providers.
+// When all providers fail, the result of the last provider is returned with the errors of all of them.
+func (notifier *failoverNotifier) SendNotification(ctx context.Context, notification *data.Notification) SendResult {
+	var result SendResult
+	var tries []ProviderTry
+	var errs []error
+	for i, provider := range notifier.providers {
+		startedAt := time.Now()
+		result = provider.notifier.SendNotification(ctx, notification)
+		result.Provider = provider.name
+		tries = append(tries, ProviderTry{
+			Provider:     provider.name,
+			StartedAt:    startedAt,
+			Duration:     time.Since(startedAt),
+			Outcome:      result.Outcome,
+			ResponseCode: result.ResponseCode,
+			Err:          result.Err,
+		})
+		result.Tries = tries
+		if result.IsDelivered() {
+			notification.Provider = provider.name
+			return result
+		}
+
+		errs = append(errs, fmt.Errorf("provider %s: %w", provider.name, result.Err))
+		// The remaining providers are not tried when the send is abandoned.
+		if !result.CanRetry() || ctx.Err() != nil {
+			break
+		}
+
+		if i < len(notifier.providers)-1 {
+			notifier.logger.Warn().
+				Err(result.Err).
+				Int("notificationId", notification.Id).
+				Str("provider", provider.name).
+				Str("nextProvider", notifier.providers[i+1].name).
+				Msg("Provider failed, falling through to the next provider.")
+		}
+	}
+
+	result.Err = errors.Join(errs...)
+	return result
+}
+
+// Preview renders the notification with the first provider, through which it would be sent
+// unless the provider fails.
+func (notifier *failoverNotifier) Preview(
+	ctx context.Context,
+	notification *data.Notification,
+	blobStore blobstore.BlobStore,
+) (Preview, error) {
+	first := notifier.providers[0]
+	preview, err := previewWith(ctx, first.notifier, notification, blobStore)
+	preview.Provider = first.name
+	return preview, err
+}
+
+func (notifier *failoverNotifier) CloseIdleConnections() {
+	for _, provider := range notifier.providers {
+		if closer, ok := provider.notifier.(IdleConnectionsCloser); ok {
+			closer.CloseIdleConnections()
+		}
+	}
+}
+
+func (notifier *failoverNotifier) Close() error {
+	var errs []error
+	for _, provider := range notifier.providers {
+		if closer, ok := provider.notifier.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Builds the providers in the configured order. The provider names must be unique
+// as they are recorded on the delivered notifications.
+func newProviders[P any](
+	settings []P,
+	name func(P) string,
+	build func(P) (Notifier, error),
+) ([]provider, error) {
+	providers := make([]provider, 0, len(settings))
+	closeBuilt := func() {
+		_ = newFailoverNotifier(providers, nil).Close()
+	}
+
+	for _, providerSettings := range settings {
+		providerName := name(providerSettings)
+		if providerName == "" {
+			closeBuilt()
+			return nil, errors.New("every provider requires a name")
+		}
+		for _, built := range providers {
+			if built.name == providerName {
+				closeBuilt()
+				return nil, fmt.Errorf("duplicate provider name %q", providerName)
+			}
+		}
+
+		notifier, err := build(providerSettings)
+		if err != nil {
+			closeBuilt()
+			return nil, fmt.Errorf("provider %q: %w", providerName, err)
+		}
+		providers = append(providers, provider{name: providerName, notifier: notifier})
+	}
+	return providers, nil
+}
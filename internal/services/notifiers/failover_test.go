@@ -0,0 +1,181 @@
+package notifiers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Starts a fake HTTP email API which stores the raw messages it receives.
+func startFakeEmailApi(t *testing.T) (*httptest.Server, *[]string) {
+	var messages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer api-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			From       string   `json:"from"`
+			Recipients []string `json:"recipients"`
+			RawMessage []byte   `json:"rawMessage"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		messages = append(messages, string(request.RawMessage))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+	return server, &messages
+}
+
+// Returns the port of a closed listener, on which the connections are refused.
+func closedPort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func newEmailFailoverNotifier(t *testing.T, recipient string, providers ...config.EmailProvider) notifiers.Notifier {
+	cfg := &config.Config{}
+	cfg.Email.From = smtpTestUsername
+	cfg.Email.Recipients = []string{recipient}
+	cfg.Email.Providers = providers
+
+	registry, err := notifiers.NewRegistry(cfg, notifiers.Dependencies{}, logger.Setup(config.ServiceEnv{Name: "test"}))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = registry.Close() })
+
+	notifier, err := registry.Notifier(data.Email)
+	require.NoError(t, err)
+	return notifier
+}
+
+func TestFailover_FallsThroughOnTransientFailure(t *testing.T) {
+	api, messages := startFakeEmailApi(t)
+	notifier := newEmailFailoverNotifier(t, "ops@example.com",
+		config.EmailProvider{
+			Name:         "primary_smtp",
+			SmtpSettings: config.SmtpSettings{SmtpHost: "127.0.0.1", SmtpPort: closedPort(t), TlsMode: "none", Auth: "none"},
+		},
+		config.EmailProvider{Name: "mail_api", Kind: "http_api", ApiUrl: api.URL, ApiKey: "api-key"},
+	)
+
+	notification := &data.Notification{Id: 1, Subject: "Payment failed", Message: "Payment has failed"}
+	result := notifier.SendNotification(context.Background(), notification)
+
+	require.NoError(t, result.Err)
+	assert.True(t, result.IsDelivered())
+	assert.Equal(t, http.StatusAccepted, result.ResponseCode)
+	assert.NotEmpty(t, result.MessageId)
+	assert.Equal(t, "mail_api", notification.Provider)
+	require.Len(t, *messages, 1)
+	assert.Contains(t, (*messages)[0], "Subject: Payment failed")
+}
+
+func TestFailover_StopsOnPermanentFailure(t *testing.T) {
+	server, _ := startFakeSmtpServer(t, fakeSmtpServerOptions{})
+	api, messages := startFakeEmailApi(t)
+	notifier := newEmailFailoverNotifier(t, "rejected@example.com",
+		config.EmailProvider{
+			Name:         "primary_smtp",
+			SmtpSettings: config.SmtpSettings{SmtpHost: "127.0.0.1", SmtpPort: server.port(), TlsMode: "none", Auth: "none"},
+		},
+		config.EmailProvider{Name: "mail_api", Kind: "http_api", ApiUrl: api.URL, ApiKey: "api-key"},
+	)
+
+	notification := &data.Notification{Id: 1, Message: "Payment has failed"}
+	result := notifier.SendNotification(context.Background(), notification)
+
+	require.Error(t, result.Err)
+	assert.Equal(t, notifiers.PermanentFailure, result.Outcome)
+	assert.Equal(t, 550, result.ResponseCode)
+	assert.Empty(t, notification.Provider)
+	assert.Empty(t, *messages)
+	// The providers after a permanent failure are not tried.
+	require.Len(t, result.Tries, 1)
+	assert.Equal(t, "primary_smtp", result.Tries[0].Provider)
+}
+
+func TestFailover_SlackProviders(t *testing.T) {
+	var primaryCalls, backupCalls atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(primary.Close)
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backupCalls.Add(1)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(backup.Close)
+
+	cfg := &config.Config{}
+	cfg.Slack.Providers = []config.SlackProvider{
+		{Name: "primary", SlackConnection: config.SlackConnection{WebhookUrl: primary.URL}},
+		{Name: "backup", SlackConnection: config.SlackConnection{WebhookUrl: backup.URL}},
+	}
+	registry, err := notifiers.NewRegistry(cfg, notifiers.Dependencies{}, logger.Setup(config.ServiceEnv{Name: "test"}))
+	require.NoError(t, err)
+	notifier, err := registry.Notifier(data.Slack)
+	require.NoError(t, err)
+
+	notification := &data.Notification{Message: "Payment has failed"}
+	result := notifier.SendNotification(context.Background(), notification)
+	require.NoError(t, result.Err)
+
+	assert.Equal(t, "backup", notification.Provider)
+	assert.Equal(t, int32(1), primaryCalls.Load())
+	assert.Equal(t, int32(1), backupCalls.Load())
+	// Every provider tried is reported, so that the failure of the primary provider is not lost.
+	require.Len(t, result.Tries, 2)
+	assert.Equal(t, "primary", result.Tries[0].Provider)
+	assert.Equal(t, notifiers.TransientFailure, result.Tries[0].Outcome)
+	assert.Equal(t, http.StatusServiceUnavailable, result.Tries[0].ResponseCode)
+	assert.Error(t, result.Tries[0].Err)
+	assert.Equal(t, "backup", result.Tries[1].Provider)
+	assert.Equal(t, notifiers.Delivered, result.Tries[1].Outcome)
+	assert.NoError(t, result.Tries[1].Err)
+}
+
+func TestFailover_InvalidProviders(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers []config.EmailProvider
+	}{
+		{"MissingName", []config.EmailProvider{{SmtpSettings: config.SmtpSettings{SmtpHost: "smtp.example.com", SmtpPort: "587"}}}},
+		{"DuplicateName", []config.EmailProvider{
+			{Name: "smtp", SmtpSettings: config.SmtpSettings{SmtpHost: "smtp.example.com", SmtpPort: "587"}},
+			{Name: "smtp", SmtpSettings: config.SmtpSettings{SmtpHost: "smtp2.example.com", SmtpPort: "587"}},
+		}},
+		{"UnsupportedKind", []config.EmailProvider{{Name: "sms", Kind: "sms"}}},
+		{"HttpApiWithoutUrl", []config.EmailProvider{{Name: "mail_api", Kind: "http_api"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Email.From = smtpTestUsername
+			cfg.Email.Recipients = []string{"ops@example.com"}
+			cfg.Email.Providers = tt.providers
+
+			_, err := notifiers.NewRegistry(cfg, notifiers.Dependencies{}, logger.Setup(config.ServiceEnv{Name: "test"}))
+
+			assert.Error(t, err)
+		})
+	}
+}
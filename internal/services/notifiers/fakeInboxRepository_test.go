@@ -0,0 +1,39 @@
+package notifiers_test
+
+import (
+	"context"
+
+	"github.com/plyovchev/notifications-service/internal/models/data"
+)
+
+// fakeInboxRepository keeps the delivered inbox items in memory.
+type fakeInboxRepository struct {
+	items []data.InboxItem
+}
+
+func (repository *fakeInboxRepository) Deliver(_ context.Context, notification *data.Notification) (*data.InboxItem, error) {
+	item := data.NewInboxItem(notification)
+	item.Id = len(repository.items) + 1
+	repository.items = append(repository.items, *item)
+	return item, nil
+}
+
+func (repository *fakeInboxRepository) FindAllByUserId(string, int, int) (*[]data.InboxItem, int64, error) {
+	return &repository.items, int64(len(repository.items)), nil
+}
+
+func (repository *fakeInboxRepository) CountUnread(string) (int64, error) {
+	return int64(len(repository.items)), nil
+}
+
+func (repository *fakeInboxRepository) MarkRead(string, int) (bool, error) {
+	return true, nil
+}
+
+func (repository *fakeInboxRepository) MarkAllRead(string) (int64, error) {
+	return int64(len(repository.items)), nil
+}
+
+func (repository *fakeInboxRepository) Archive(string, int) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,67 @@
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/repositories"
+)
+
+var ErrMissingUserId = errors.New("in-app notification has no user id")
+
+func init() {
+	RegisterFactory(data.InApp, newInAppNotifierFromConfig)
+}
+
+// InAppNotifier delivers notifications to the inbox of a user instead of calling a 3rd party service.
+type InAppNotifier struct {
+	logger          *logger.AppLogger
+	inboxRepository repositories.InboxRepository
+}
+
+func NewInAppNotifier(inboxRepository repositories.InboxRepository, logger *logger.AppLogger) *InAppNotifier {
+	return &InAppNotifier{
+		logger:          logger,
+		inboxRepository: inboxRepository,
+	}
+}
+
+// SendNotification stores the notification in the inbox of its user.
+// The id of the inbox item is the message id of the result.
+func (notifier *InAppNotifier) SendNotification(ctx context.Context, notification *data.Notification) SendResult {
+	notifier.logger.Debug().Msg("Storing in-app notification.")
+
+	if notification.UserId == "" {
+		return failedResult(&PermanentError{Err: ErrMissingUserId})
+	}
+
+	item, err := notifier.inboxRepository.Deliver(ctx, notification)
+	if err != nil {
+		return failedResult(err)
+	}
+
+	notifier.logger.Debug().Int("inboxItemId", item.Id).Msg("In-app notification has been stored.")
+
+	return deliveredResult(strconv.Itoa(item.Id), 0)
+}
+
+// Preview renders the inbox item which would be created for the user, without storing it.
+func (notifier *InAppNotifier) Preview(_ context.Context, notification *data.Notification, _ blobstore.BlobStore) (Preview, error) {
+	if notification.UserId == "" {
+		return Preview{}, ErrMissingUserId
+	}
+	return jsonPreview(data.NewInboxItem(notification), notification.UserId)
+}
+
+// Builds the in-app notifier. The channel is disabled when there is no inbox repository.
+func newInAppNotifierFromConfig(_ *config.Config, dependencies Dependencies, logger *logger.AppLogger) (Notifier, error) {
+	if dependencies.InboxRepository == nil {
+		return nil, ErrChannelNotConfigured
+	}
+	return NewInAppNotifier(dependencies.InboxRepository, logger), nil
+}
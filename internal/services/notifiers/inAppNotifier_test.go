@@ -0,0 +1,48 @@
+package notifiers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInAppNotifier_SendNotification(t *testing.T) {
+	repository := &fakeInboxRepository{}
+	notifier := notifiers.NewInAppNotifier(repository, logger.Setup(config.ServiceEnv{Name: "test"}))
+
+	_ = notifier.SendNotification(context.Background(), &data.Notification{Id: 1, UserId: "user-1", Message: "first"})
+	result := notifier.SendNotification(context.Background(), &data.Notification{Id: 2, UserId: "user-1", Message: "second"})
+
+	require.True(t, result.IsDelivered())
+	// The id of the inbox item is the message id.
+	assert.Equal(t, "2", result.MessageId)
+	require.Len(t, repository.items, 2)
+	assert.Equal(t, 2, repository.items[1].NotificationId)
+	assert.Equal(t, "second", repository.items[1].Message)
+}
+
+func TestInAppNotifier_SendNotification_MissingUserId(t *testing.T) {
+	repository := &fakeInboxRepository{}
+	notifier := notifiers.NewInAppNotifier(repository, logger.Setup(config.ServiceEnv{Name: "test"}))
+
+	result := notifier.SendNotification(context.Background(), &data.Notification{Id: 1, Message: "m"})
+
+	assert.Equal(t, notifiers.PermanentFailure, result.Outcome)
+	assert.ErrorIs(t, result.Err, notifiers.ErrMissingUserId)
+	assert.Empty(t, repository.items)
+}
+
+func TestInAppNotifier_DisabledWithoutInboxRepository(t *testing.T) {
+	registry, err := notifiers.NewRegistry(&config.Config{}, notifiers.Dependencies{}, logger.Setup(config.ServiceEnv{Name: "test"}))
+
+	require.NoError(t, err)
+	assert.False(t, registry.IsEnabled(data.InApp))
+	_, err = registry.Notifier(data.InApp)
+	assert.ErrorIs(t, err, notifiers.ErrChannelDisabled)
+}
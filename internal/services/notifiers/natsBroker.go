@@ -0,0 +1,67 @@
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsBroker publishes the messages to the JetStream streams of a NATS server.
+// The acknowledgement of JetStream is the confirmation that the stream stored the message,
+// so the subject has to be bound to a stream.
+type natsBroker struct {
+	conn      *nats.Conn
+	jetStream jetstream.JetStream
+}
+
+func newNatsBroker(url string, username string, password string) (*natsBroker, error) {
+	options := []nats.Option{
+		nats.Name("notifications-service"),
+		// The startup does not depend on the availability of the broker; the publishes fail until it is reachable.
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	}
+	if username != "" {
+		options = append(options, nats.UserInfo(username, password))
+	}
+
+	conn, err := nats.Connect(url, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	jetStream, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &natsBroker{conn: conn, jetStream: jetStream}, nil
+}
+
+// Publish returns the stream and the sequence of the stored message, e.g. 'NOTIFICATIONS:42'.
+// A message which is published again with the same id within the duplicate window of the stream
+// is not stored twice and the sequence of the original message is returned.
+func (broker *natsBroker) Publish(ctx context.Context, subject string, message BrokerMessage) (string, error) {
+	msg := nats.NewMsg(subject)
+	msg.Data = message.Body
+	for name, value := range message.Headers {
+		msg.Header.Set(name, value)
+	}
+
+	ack, err := broker.jetStream.PublishMsg(ctx, msg, jetstream.WithMsgID(message.Id))
+	if err != nil {
+		if errors.Is(err, nats.ErrMaxPayload) {
+			return "", &PermanentError{Err: err}
+		}
+		return "", err
+	}
+	return fmt.Sprintf("%s:%d", ack.Stream, ack.Sequence), nil
+}
+
+func (broker *natsBroker) Close() error {
+	return broker.conn.Drain()
+}
@@ -0,0 +1,36 @@
+package notifiers
+
+import (
+	"context"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/repositories"
+)
+
+// An interface for sending a notification to a 3rd party service.
+// The send is abandoned when the context is done; the id of the originating request is carried
+// by the context and passed on to the 3rd party service where its protocol allows.
+type Notifier interface {
+	SendNotification(ctx context.Context, notification *data.Notification) SendResult
+}
+
+// An optional interface of the notifiers which keep connections open for reuse.
+// The idle connections are closed after a batch of notifications is processed.
+type IdleConnectionsCloser interface {
+	CloseIdleConnections()
+}
+
+// The repositories and stores required by the notifiers which keep state in the service.
+type Dependencies struct {
+	InboxRepository       repositories.InboxRepository
+	SlackThreadRepository repositories.SlackThreadRepository
+	BlobStore             blobstore.BlobStore
+}
+
+// Returns the id of the request which originated the notification or an empty string.
+func requestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(config.ContextKey(config.RequestIdentifier)).(string)
+	return requestId
+}
@@ -0,0 +1,68 @@
+package notifiers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+)
+
+// ErrPreviewNotSupported is returned for a delivery channel whose notifier could not render a preview.
+var ErrPreviewNotSupported = errors.New("preview is not supported by the delivery channel")
+
+// Preview is the payload which would be sent for a notification, rendered without calling the provider.
+type Preview struct {
+	// The destination and the provider through which the notification would be sent first.
+	Destination string `json:"destination,omitempty"`
+	Provider    string `json:"provider,omitempty"`
+	// The recipients of the notification, e.g. the email addresses, the Slack channel, the user or the queue subject.
+	Recipients  []string `json:"recipients,omitempty"`
+	ContentType string   `json:"contentType"`
+	// The rendered payload; a JSON payload is embedded as it is, while the other ones are strings.
+	Payload any `json:"payload"`
+}
+
+// An optional interface of the notifiers which render the payload of a notification without sending it.
+type Previewer interface {
+	// Preview reads the content of the attachments of the notification from the blob store,
+	// as the attachments of a preview are not stored.
+	Preview(ctx context.Context, notification *data.Notification, blobStore blobstore.BlobStore) (Preview, error)
+}
+
+// Preview renders the notification with the notifier of its delivery channel.
+func (registry *Registry) Preview(
+	ctx context.Context,
+	notification *data.Notification,
+	blobStore blobstore.BlobStore,
+) (Preview, error) {
+	notifier, err := registry.Notifier(notification.DeliveryChannel)
+	if err != nil {
+		return Preview{}, err
+	}
+	return previewWith(ctx, notifier, notification, blobStore)
+}
+
+func previewWith(
+	ctx context.Context,
+	notifier Notifier,
+	notification *data.Notification,
+	blobStore blobstore.BlobStore,
+) (Preview, error) {
+	previewer, ok := notifier.(Previewer)
+	if !ok {
+		return Preview{}, fmt.Errorf("%w: %s", ErrPreviewNotSupported, notification.DeliveryChannel)
+	}
+	return previewer.Preview(ctx, notification, blobStore)
+}
+
+// Builds the preview of a JSON payload.
+func jsonPreview(payload any, recipients ...string) (Preview, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Preview{}, err
+	}
+	return Preview{Recipients: recipients, ContentType: "application/json", Payload: json.RawMessage(body)}, nil
+}
@@ -0,0 +1,148 @@
+package notifiers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+)
+
+// The version of the envelope of the published notifications. It is increased on incompatible changes
+// of the envelope, so the consumers could tell the formats apart.
+const queueEnvelopeVersion = 1
+
+func init() {
+	RegisterFactory(data.Queue, newQueueNotifierFromConfig)
+}
+
+// The message published for a notification.
+type queueEnvelope struct {
+	Version      int                       `json:"version"`
+	Notification queueEnvelopeNotification `json:"notification"`
+}
+
+type queueEnvelopeNotification struct {
+	Id          int                       `json:"id"`
+	Key         string                    `json:"key"`
+	Subject     string                    `json:"subject,omitempty"`
+	Message     string                    `json:"message"`
+	Type        data.NotificationType     `json:"type"`
+	UserId      string                    `json:"userId,omitempty"`
+	Resolved    bool                      `json:"resolved"`
+	RequestId   string                    `json:"requestId,omitempty"`
+	Attachments []queueEnvelopeAttachment `json:"attachments,omitempty"`
+	CreatedAt   time.Time                 `json:"createdAt"`
+}
+
+// The metadata of an attachment; the content is not published.
+type queueEnvelopeAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// QueueNotifier publishes the notifications to a message broker for the systems which consume them from a queue.
+type QueueNotifier struct {
+	logger  *logger.AppLogger
+	broker  Broker
+	subject string
+}
+
+func NewQueueNotifier(broker Broker, subject string, logger *logger.AppLogger) *QueueNotifier {
+	return &QueueNotifier{
+		logger:  logger,
+		broker:  broker,
+		subject: subject,
+	}
+}
+
+func newQueueNotifierFromConfig(cfg *config.Config, _ Dependencies, logger *logger.AppLogger) (Notifier, error) {
+	if cfg.Queue.Url == "" {
+		return nil, ErrChannelNotConfigured
+	}
+	if cfg.Queue.Subject == "" {
+		return nil, errors.New("the queue subject is required")
+	}
+
+	broker, err := newBroker(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewQueueNotifier(broker, cfg.Queue.Subject, logger), nil
+}
+
+// SendNotification publishes the envelope of the notification. The message id of the result is the id
+// of the message within the broker. The notification id is the deduplication id of the message,
+// so a retry of a publish whose confirmation was lost does not publish the notification twice.
+func (notifier *QueueNotifier) SendNotification(ctx context.Context, notification *data.Notification) SendResult {
+	notifier.logger.Debug().Msg("Publishing notification to the queue.")
+
+	body, err := json.Marshal(newQueueEnvelope(notification))
+	if err != nil {
+		return failedResult(&PermanentError{Err: err})
+	}
+
+	headers := map[string]string{
+		"Content-Type":     "application/json",
+		"Envelope-Version": strconv.Itoa(queueEnvelopeVersion),
+	}
+	if requestId := requestIdFromContext(ctx); requestId != "" {
+		headers[config.RequestIdentifier] = requestId
+	}
+
+	messageId, err := notifier.broker.Publish(ctx, notifier.subject, BrokerMessage{
+		Id:      "notification-" + strconv.Itoa(notification.Id),
+		Headers: headers,
+		Body:    body,
+	})
+	if err != nil {
+		return failedResult(err)
+	}
+
+	notifier.logger.Debug().Str("messageId", messageId).Msg("Notification has been published to the queue.")
+
+	return deliveredResult(messageId, 0)
+}
+
+// Preview renders the envelope published to the subject.
+func (notifier *QueueNotifier) Preview(_ context.Context, notification *data.Notification, _ blobstore.BlobStore) (Preview, error) {
+	return jsonPreview(newQueueEnvelope(notification), notifier.subject)
+}
+
+// Close disconnects from the broker.
+func (notifier *QueueNotifier) Close() error {
+	return notifier.broker.Close()
+}
+
+func newQueueEnvelope(notification *data.Notification) queueEnvelope {
+	attachments := make([]queueEnvelopeAttachment, 0, len(notification.Attachments))
+	for _, attachment := range notification.Attachments {
+		attachments = append(attachments, queueEnvelopeAttachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Size:        attachment.Size,
+		})
+	}
+
+	return queueEnvelope{
+		Version: queueEnvelopeVersion,
+		Notification: queueEnvelopeNotification{
+			Id:          notification.Id,
+			Key:         notification.Key,
+			Subject:     notification.Subject,
+			Message:     notification.Message,
+			Type:        notification.Type,
+			UserId:      notification.UserId,
+			Resolved:    notification.Resolved,
+			RequestId:   notification.RequestId,
+			Attachments: attachments,
+			CreatedAt:   notification.CreatedAt,
+		},
+	}
+}
@@ -0,0 +1,148 @@
+package notifiers_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Starts an in-process NATS server with a JetStream stream bound to the 'notifications.>' subjects.
+func startNatsServer(t *testing.T) (*server.Server, jetstream.Stream) {
+	natsServer, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	require.NoError(t, err)
+	go natsServer.Start()
+	t.Cleanup(natsServer.Shutdown)
+	require.True(t, natsServer.ReadyForConnections(5*time.Second))
+
+	conn, err := nats.Connect(natsServer.ClientURL())
+	require.NoError(t, err)
+	t.Cleanup(conn.Close)
+	jetStream, err := jetstream.New(conn)
+	require.NoError(t, err)
+	stream, err := jetStream.CreateStream(context.Background(), jetstream.StreamConfig{
+		Name:     "NOTIFICATIONS",
+		Subjects: []string{"notifications.>"},
+	})
+	require.NoError(t, err)
+
+	return natsServer, stream
+}
+
+func newQueueNotifier(t *testing.T, url string) notifiers.Notifier {
+	cfg := &config.Config{}
+	cfg.Queue.Url = url
+	cfg.Queue.Subject = "notifications.payments"
+
+	registry, err := notifiers.NewRegistry(cfg, notifiers.Dependencies{}, logger.Setup(config.ServiceEnv{Name: "test"}))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = registry.Close() })
+
+	notifier, err := registry.Notifier(data.Queue)
+	require.NoError(t, err)
+	return notifier
+}
+
+func TestQueueNotifier_PublishesEnvelope(t *testing.T) {
+	natsServer, stream := startNatsServer(t)
+	notifier := newQueueNotifier(t, natsServer.ClientURL())
+
+	ctx := context.WithValue(context.Background(), config.ContextKey(config.RequestIdentifier), "request-42")
+	notification := &data.Notification{
+		Id:          7,
+		Key:         "payment-failed",
+		Message:     "Payment has failed",
+		Type:        data.Error,
+		Attachments: []data.Attachment{{Filename: "receipt.pdf", ContentType: "application/pdf", Size: 42}},
+	}
+	result := notifier.SendNotification(ctx, notification)
+
+	require.NoError(t, result.Err)
+	assert.Equal(t, "NOTIFICATIONS:1", result.MessageId)
+
+	message, err := stream.GetMsg(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "notifications.payments", message.Subject)
+	assert.Equal(t, "request-42", message.Header.Get(config.RequestIdentifier))
+	assert.Equal(t, "1", message.Header.Get("Envelope-Version"))
+
+	var envelope struct {
+		Version      int `json:"version"`
+		Notification struct {
+			Id          int    `json:"id"`
+			Key         string `json:"key"`
+			Message     string `json:"message"`
+			Type        string `json:"type"`
+			Attachments []struct {
+				Filename string `json:"filename"`
+			} `json:"attachments"`
+		} `json:"notification"`
+	}
+	require.NoError(t, json.Unmarshal(message.Data, &envelope))
+	assert.Equal(t, 1, envelope.Version)
+	assert.Equal(t, 7, envelope.Notification.Id)
+	assert.Equal(t, "payment-failed", envelope.Notification.Key)
+	assert.Equal(t, "Payment has failed", envelope.Notification.Message)
+	assert.Equal(t, "Error", envelope.Notification.Type)
+	require.Len(t, envelope.Notification.Attachments, 1)
+	assert.Equal(t, "receipt.pdf", envelope.Notification.Attachments[0].Filename)
+}
+
+func TestQueueNotifier_DeduplicatesRetriedPublishes(t *testing.T) {
+	natsServer, stream := startNatsServer(t)
+	notifier := newQueueNotifier(t, natsServer.ClientURL())
+
+	first := notifier.SendNotification(context.Background(), &data.Notification{Id: 1, Message: "first"})
+	retried := notifier.SendNotification(context.Background(), &data.Notification{Id: 1, Message: "first"})
+	second := notifier.SendNotification(context.Background(), &data.Notification{Id: 2, Message: "second"})
+
+	require.NoError(t, first.Err)
+	require.NoError(t, retried.Err)
+	require.NoError(t, second.Err)
+	assert.Equal(t, first.MessageId, retried.MessageId)
+	assert.Equal(t, "NOTIFICATIONS:2", second.MessageId)
+
+	info, err := stream.Info(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), info.State.Msgs)
+}
+
+func TestQueueNotifier_InvalidConfiguration(t *testing.T) {
+	tests := []struct {
+		name    string
+		broker  string
+		subject string
+	}{
+		{"MissingSubject", "nats", ""},
+		{"UnsupportedBroker", "kafka", "notifications.payments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Queue.Broker = tt.broker
+			cfg.Queue.Url = "nats://127.0.0.1:4222"
+			cfg.Queue.Subject = tt.subject
+
+			_, err := notifiers.NewRegistry(cfg, notifiers.Dependencies{}, logger.Setup(config.ServiceEnv{Name: "test"}))
+
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package notifiers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+)
+
+// ErrChannelNotConfigured is returned by a factory when the configuration has no settings for its channel.
+// Such a channel is disabled rather than failing the startup.
+var ErrChannelNotConfigured = errors.New("delivery channel is not configured")
+
+// ErrChannelDisabled is returned for a delivery channel which has no notifier in the registry.
+var ErrChannelDisabled = errors.New("delivery channel is not enabled")
+
+// Factory builds the notifier of a delivery channel from the configuration.
+type Factory func(cfg *config.Config, dependencies Dependencies, logger *logger.AppLogger) (Notifier, error)
+
+var (
+	factoriesLock sync.Mutex
+	factories     = make(map[data.DeliveryChannel]Factory)
+)
+
+// RegisterFactory makes the notifier factory available for the delivery channel.
+// It is called from the init functions of the notifiers and panics if the channel is registered twice.
+func RegisterFactory(deliveryChannel data.DeliveryChannel, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	if _, present := factories[deliveryChannel]; present {
+		panic(fmt.Sprintf("notifier factory for %s is already registered", deliveryChannel))
+	}
+	factories[deliveryChannel] = factory
+}
+
+// Registry holds the notifiers of the enabled delivery channels.
+// The notifiers are built once, when the registry is created, and shared by all sends.
+type Registry struct {
+	notifiers map[data.DeliveryChannel]Notifier
+}
+
+// NewRegistry builds the notifiers of all registered delivery channels, each behind the circuit breaker of its channel.
+// A channel without configuration is disabled, while a channel with invalid configuration fails the creation.
+func NewRegistry(cfg *config.Config, dependencies Dependencies, logger *logger.AppLogger) (*Registry, error) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	registry := &Registry{notifiers: make(map[data.DeliveryChannel]Notifier)}
+	for deliveryChannel, factory := range factories {
+		notifier, err := factory(cfg, dependencies, logger)
+		if errors.Is(err, ErrChannelNotConfigured) {
+			logger.Info().Str("deliveryChannel", string(deliveryChannel)).Msg("Delivery channel is disabled as it is not configured.")
+			continue
+		}
+		if err != nil {
+			_ = registry.Close()
+			return nil, fmt.Errorf("invalid configuration of the %s delivery channel: %w", deliveryChannel, err)
+		}
+
+		breakerSettings := cfg.ChannelDelivery(string(deliveryChannel)).CircuitBreaker
+		registry.notifiers[deliveryChannel] = newCircuitBreakerNotifier(notifier, deliveryChannel, breakerSettings, logger)
+	}
+
+	logger.Info().Interface("deliveryChannels", registry.EnabledChannels()).Msg("Enabled delivery channels.")
+	return registry, nil
+}
+
+// NewCapturingRegistry routes the notifications of all registered delivery channels to the sink,
+// so no 3rd party service is called. It is meant for the development environments, where the notifications
+// could be inspected in the output of the sink. The destinations of the channels are validated as configured.
+func NewCapturingRegistry(cfg *config.Config, logger *logger.AppLogger) (*Registry, error) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	sink, err := newSink(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration of the %s delivery channel: %w", data.Sink, err)
+	}
+
+	registry := &Registry{notifiers: make(map[data.DeliveryChannel]Notifier)}
+	for deliveryChannel := range factories {
+		registry.notifiers[deliveryChannel] = &capturedNotifier{
+			Notifier:     sink,
+			destinations: configuredDestinations(cfg, deliveryChannel),
+		}
+	}
+	// The sink is closed once, as the notifier of its own channel.
+	registry.notifiers[data.Sink] = sink
+
+	logger.Warn().Interface("deliveryChannels", registry.EnabledChannels()).Msg("All delivery channels are captured by the sink.")
+	return registry, nil
+}
+
+// Notifier returns the notifier of the delivery channel or ErrChannelDisabled.
+func (registry *Registry) Notifier(deliveryChannel data.DeliveryChannel) (Notifier, error) {
+	notifier, present := registry.notifiers[deliveryChannel]
+	if !present {
+		return nil, fmt.Errorf("%w: %s", ErrChannelDisabled, deliveryChannel)
+	}
+	return notifier, nil
+}
+
+// IsEnabled reports whether the delivery channel has a notifier.
+func (registry *Registry) IsEnabled(deliveryChannel data.DeliveryChannel) bool {
+	_, present := registry.notifiers[deliveryChannel]
+	return present
+}
+
+// HasDestination reports whether the delivery channel is enabled and has the named destination.
+// An empty destination stands for the default destination of the channel.
+func (registry *Registry) HasDestination(deliveryChannel data.DeliveryChannel, destination string) bool {
+	notifier, present := registry.notifiers[deliveryChannel]
+	if !present {
+		return false
+	}
+	if destination == "" {
+		return true
+	}
+
+	destinationsNotifier, ok := notifier.(DestinationsNotifier)
+	return ok && slices.Contains(destinationsNotifier.Destinations(), destination)
+}
+
+// EnabledChannels returns the enabled delivery channels in alphabetical order.
+func (registry *Registry) EnabledChannels() []data.DeliveryChannel {
+	channels := make([]data.DeliveryChannel, 0, len(registry.notifiers))
+	for deliveryChannel := range registry.notifiers {
+		channels = append(channels, deliveryChannel)
+	}
+	slices.Sort(channels)
+	return channels
+}
+
+// CircuitStatuses returns the states of the circuit breakers of the enabled delivery channels. The channels which are
+// captured by the sink have no circuit breakers.
+func (registry *Registry) CircuitStatuses() map[data.DeliveryChannel]CircuitStatus {
+	statuses := make(map[data.DeliveryChannel]CircuitStatus)
+	for deliveryChannel, notifier := range registry.notifiers {
+		if breaker, ok := notifier.(*circuitBreakerNotifier); ok {
+			statuses[deliveryChannel] = breaker.Status()
+		}
+	}
+	return statuses
+}
+
+// CloseIdleConnections closes the idle connections kept by the notifiers.
+func (registry *Registry) CloseIdleConnections() {
+	for _, notifier := range registry.notifiers {
+		if closer, ok := notifier.(IdleConnectionsCloser); ok {
+			closer.CloseIdleConnections()
+		}
+	}
+}
+
+// Close releases the resources held by the notifiers.
+func (registry *Registry) Close() error {
+	var errs []error
+	for _, notifier := range registry.notifiers {
+		if closer, ok := notifier.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,129 @@
+package notifiers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_EnablesConfiguredChannels(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = "https://hooks.slack.com/services/T000/B000/XXXX"
+	dependencies := notifiers.Dependencies{InboxRepository: &fakeInboxRepository{}}
+
+	registry, err := notifiers.NewRegistry(cfg, dependencies, logger.Setup(config.ServiceEnv{Name: "test"}))
+
+	require.NoError(t, err)
+	assert.Equal(t, []data.DeliveryChannel{data.InApp, data.Slack}, registry.EnabledChannels())
+	assert.True(t, registry.IsEnabled(data.Slack))
+	assert.False(t, registry.IsEnabled(data.Email))
+
+	notifier, err := registry.Notifier(data.Slack)
+	require.NoError(t, err)
+
+	sameNotifier, _ := registry.Notifier(data.Slack)
+	assert.Same(t, notifier, sameNotifier)
+
+	_, err = registry.Notifier(data.Email)
+	assert.ErrorIs(t, err, notifiers.ErrChannelDisabled)
+}
+
+func TestRegistry_RoutesToNamedDestinations(t *testing.T) {
+	var received []string
+	newWebhook := func(name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = append(received, name)
+			_, _ = w.Write([]byte("ok"))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	cfg := &config.Config{}
+	cfg.Slack.WebhookUrl = newWebhook("default").URL
+	cfg.Slack.Destinations = map[string]config.SlackDestination{
+		"payments_ops": {SlackConnection: config.SlackConnection{WebhookUrl: newWebhook("payments_ops").URL}},
+		"risk":         {SlackConnection: config.SlackConnection{WebhookUrl: newWebhook("risk").URL}},
+	}
+	cfg.Slack.DefaultDestination = "risk"
+
+	registry, err := notifiers.NewRegistry(cfg, notifiers.Dependencies{}, logger.Setup(config.ServiceEnv{Name: "test"}))
+	require.NoError(t, err)
+
+	assert.True(t, registry.HasDestination(data.Slack, "payments_ops"))
+	assert.True(t, registry.HasDestination(data.Slack, notifiers.DefaultDestination))
+	assert.True(t, registry.HasDestination(data.Slack, ""))
+	assert.False(t, registry.HasDestination(data.Slack, "marketing"))
+	assert.False(t, registry.HasDestination(data.Email, ""))
+
+	notifier, err := registry.Notifier(data.Slack)
+	require.NoError(t, err)
+	destinationsNotifier, ok := notifier.(notifiers.DestinationsNotifier)
+	require.True(t, ok)
+	assert.Equal(t, []string{"default", "payments_ops", "risk"}, destinationsNotifier.Destinations())
+
+	require.NoError(t, notifier.SendNotification(context.Background(), &data.Notification{Message: "a", Destination: "payments_ops"}).Err)
+	require.NoError(t, notifier.SendNotification(context.Background(), &data.Notification{Message: "b", Destination: notifiers.DefaultDestination}).Err)
+	require.NoError(t, notifier.SendNotification(context.Background(), &data.Notification{Message: "c"}).Err)
+	err = notifier.SendNotification(context.Background(), &data.Notification{Message: "d", Destination: "marketing"}).Err
+
+	assert.ErrorIs(t, err, notifiers.ErrUnknownDestination)
+	assert.Equal(t, []string{"payments_ops", "default", "risk"}, received)
+}
+
+func TestRegistry_FailsOnMisconfiguredChannel(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(cfg *config.Config)
+	}{
+		{"EmailWithoutRecipients", func(cfg *config.Config) {
+			cfg.Email.SmtpHost, cfg.Email.SmtpPort, cfg.Email.From = "smtp.example.com", "587", "payments@example.com"
+		}},
+		{"EmailInvalidTlsMode", func(cfg *config.Config) {
+			cfg.Email.SmtpHost, cfg.Email.SmtpPort, cfg.Email.From = "smtp.example.com", "587", "payments@example.com"
+			cfg.Email.Recipients = []string{"ops@example.com"}
+			cfg.Email.TlsMode = "ssl"
+		}},
+		{"SlackRelativeWebhookUrl", func(cfg *config.Config) {
+			cfg.Slack.WebhookUrl = "hooks.slack.com/services"
+		}},
+		{"SlackDestinationWithoutSettings", func(cfg *config.Config) {
+			cfg.Slack.WebhookUrl = "https://hooks.slack.com/services/T000/B000/XXXX"
+			cfg.Slack.Destinations = map[string]config.SlackDestination{"risk": {DefaultChannel: "#risk"}}
+		}},
+		{"SlackUnknownDefaultDestination", func(cfg *config.Config) {
+			cfg.Slack.Destinations = map[string]config.SlackDestination{"risk": {SlackConnection: config.SlackConnection{BotToken: "xoxb-risk"}}}
+			cfg.Slack.DefaultDestination = "payments_ops"
+		}},
+		{"SlackReservedDestinationName", func(cfg *config.Config) {
+			cfg.Slack.Destinations = map[string]config.SlackDestination{"default": {SlackConnection: config.SlackConnection{BotToken: "xoxb-risk"}}}
+		}},
+		{"EmailDestinationWithoutFrom", func(cfg *config.Config) {
+			cfg.Email.Destinations = map[string]config.EmailDestination{
+				"payments": {
+					SmtpSettings: config.SmtpSettings{SmtpHost: "smtp.example.com", SmtpPort: "587"},
+					Recipients:   []string{"ops@example.com"},
+				},
+			}
+			cfg.Email.DefaultDestination = "payments"
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			tt.configure(cfg)
+
+			_, err := notifiers.NewRegistry(cfg, notifiers.Dependencies{}, logger.Setup(config.ServiceEnv{Name: "test"}))
+
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// SendOutcome classifies the result of a send.
+type SendOutcome string
+
+const (
+	// The notification was accepted by the provider.
+	Delivered SendOutcome = "delivered"
+	// The send failed but could succeed on a retry or through another provider, e.g. a network error.
+	TransientFailure SendOutcome = "transient"
+	// The send would fail again, e.g. a rejected recipient or an unknown webhook.
+	PermanentFailure SendOutcome = "permanent"
+	// The provider throttles the sends; it should not be called again before the retry-after hint.
+	RateLimited SendOutcome = "rate_limited"
+	// The send was not attempted, as the circuit of the delivery channel is open; it should be made after the retry-after.
+	Deferred SendOutcome = "deferred"
+)
+
+// SendResult is the outcome of sending a notification through a notifier.
+type SendResult struct {
+	Outcome SendOutcome
+	// The name of the provider which was tried last; empty for the notifiers without providers.
+	Provider string
+	// The id which the provider assigned to the delivered message, e.g. the Slack message ts.
+	MessageId string
+	// The response code of the provider, e.g. the HTTP status or the SMTP reply code; 0 when there was no response.
+	ResponseCode int
+	// How long to wait before the next send when the provider is rate limiting or the send is deferred; 0 when unknown.
+	RetryAfter time.Duration
+	// The failure; nil when the notification was delivered.
+	Err error
+	// The sends through the providers of a notifier with several providers, in the order in which they were tried;
+	// empty for the notifiers which send through a single provider.
+	Tries []ProviderTry
+}
+
+// ProviderTry is the send of a notification through a single provider of its delivery channel.
+type ProviderTry struct {
+	Provider     string
+	StartedAt    time.Time
+	Duration     time.Duration
+	Outcome      SendOutcome
+	ResponseCode int
+	Err          error
+}
+
+// IsDelivered reports whether the notification was accepted by the provider.
+func (result SendResult) IsDelivered() bool {
+	return result.Outcome == Delivered
+}
+
+// CanRetry reports whether the failed send could succeed on a later attempt.
+func (result SendResult) CanRetry() bool {
+	return result.Outcome == TransientFailure || result.Outcome == RateLimited || result.Outcome == Deferred
+}
+
+// PermanentError marks a failure which would not succeed on a retry or through another provider,
+// e.g. an email message which could not be built.
+type PermanentError struct {
+	Err error
+}
+
+func (err *PermanentError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *PermanentError) Unwrap() error {
+	return err.Err
+}
+
+func deliveredResult(messageId string, responseCode int) SendResult {
+	return SendResult{Outcome: Delivered, MessageId: messageId, ResponseCode: responseCode}
+}
+
+// Builds the result of a failed send and classifies the failure by the errors of the providers.
+// Failures which are not classified, such as network errors, are considered transient.
+func failedResult(err error) SendResult {
+	result := SendResult{Outcome: TransientFailure, Err: err}
+
+	var permanentErr *PermanentError
+	var slackErr *SlackError
+	var emailApiErr *EmailApiError
+	var smtpErr *textproto.Error
+	switch {
+	case errors.As(err, &permanentErr):
+		result.Outcome = PermanentFailure
+	case errors.As(err, &slackErr):
+		result.ResponseCode, result.RetryAfter = slackErr.StatusCode, slackErr.RetryAfter
+		result.Outcome = classifyHttpStatus(slackErr.StatusCode)
+		switch {
+		case slackErr.Code == slackRateLimitedCode:
+			result.Outcome = RateLimited
+		case slices.Contains(slackTransientCodes, slackErr.Code):
+			result.Outcome = TransientFailure
+		}
+	case errors.As(err, &emailApiErr):
+		result.ResponseCode, result.RetryAfter = emailApiErr.StatusCode, emailApiErr.RetryAfter
+		result.Outcome = classifyHttpStatus(emailApiErr.StatusCode)
+	case errors.As(err, &smtpErr):
+		// SMTP replies with 4xx codes are temporary, while 5xx codes are permanent.
+		result.ResponseCode = smtpErr.Code
+		if smtpErr.Code >= 500 {
+			result.Outcome = PermanentFailure
+		}
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+	case errors.Is(err, ErrMissingSlackChannel), errors.Is(err, ErrUnknownDestination), errors.Is(err, ErrMissingUserId):
+		result.Outcome = PermanentFailure
+	}
+	return result
+}
+
+func classifyHttpStatus(statusCode int) SendOutcome {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return RateLimited
+	case statusCode == http.StatusRequestTimeout || statusCode >= 500:
+		return TransientFailure
+	default:
+		return PermanentFailure
+	}
+}
+
+// Parses the Retry-After header given in seconds; the HTTP date form is not used by the supported providers.
+func parseRetryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,104 @@
+package notifiers
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	defaultSinkMaxSizeBytes = 10 * 1024 * 1024
+	defaultSinkMaxBackups   = 3
+)
+
+// rotatingFile appends to a file which is rotated once it reaches its max size. The rotated files are
+// renamed to '<path>.1' (the newest) up to '<path>.<maxBackups>', and the oldest one is removed.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	lock sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = defaultSinkMaxSizeBytes
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultSinkMaxBackups
+	}
+
+	rotating := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rotating.open(); err != nil {
+		return nil, err
+	}
+	return rotating, nil
+}
+
+// Write writes the content as a whole to the current file, so a line is never split between two files.
+func (rotating *rotatingFile) Write(content []byte) (int, error) {
+	rotating.lock.Lock()
+	defer rotating.lock.Unlock()
+
+	if rotating.size > 0 && rotating.size+int64(len(content)) > rotating.maxSize {
+		if err := rotating.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	written, err := rotating.file.Write(content)
+	rotating.size += int64(written)
+	return written, err
+}
+
+func (rotating *rotatingFile) Close() error {
+	rotating.lock.Lock()
+	defer rotating.lock.Unlock()
+
+	return rotating.file.Close()
+}
+
+func (rotating *rotatingFile) open() error {
+	file, err := os.OpenFile(rotating.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	rotating.file, rotating.size = file, info.Size()
+	return nil
+}
+
+func (rotating *rotatingFile) rotate() error {
+	if err := rotating.file.Close(); err != nil {
+		return err
+	}
+
+	_ = os.Remove(rotating.backupPath(rotating.maxBackups))
+	var renameErr error
+	for i := rotating.maxBackups - 1; i >= 1 && renameErr == nil; i-- {
+		if err := os.Rename(rotating.backupPath(i), rotating.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			renameErr = err
+		}
+	}
+	if renameErr == nil {
+		renameErr = os.Rename(rotating.path, rotating.backupPath(1))
+	}
+
+	// The file is reopened even when the rotation failed, so the sink keeps writing to the current file.
+	if err := rotating.open(); err != nil {
+		return err
+	}
+	return renameErr
+}
+
+func (rotating *rotatingFile) backupPath(index int) string {
+	return fmt.Sprintf("%s.%d", rotating.path, index)
+}
@@ -0,0 +1,135 @@
+package notifiers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+)
+
+func init() {
+	RegisterFactory(data.Sink, newSinkNotifierFromConfig)
+}
+
+// A line written by the sink for a notification.
+type sinkRecord struct {
+	Time            time.Time            `json:"time"`
+	DeliveryChannel data.DeliveryChannel `json:"deliveryChannel"`
+	Destination     string               `json:"destination,omitempty"`
+	RequestId       string               `json:"requestId,omitempty"`
+	Notification    *data.Notification   `json:"notification"`
+	// The notification as it would be sent over its delivery channel, e.g. the Slack message payload.
+	Rendered any `json:"rendered,omitempty"`
+}
+
+// The rendering of a notification for the Email channel.
+type sinkEmail struct {
+	Subject string `json:"subject"`
+	Html    string `json:"html"`
+}
+
+// SinkNotifier writes the notifications as JSON lines instead of sending them to a 3rd party service.
+// It is meant for the local development.
+type SinkNotifier struct {
+	logger *logger.AppLogger
+	lock   sync.Mutex
+	writer io.Writer
+}
+
+func NewSinkNotifier(writer io.Writer, logger *logger.AppLogger) *SinkNotifier {
+	return &SinkNotifier{
+		logger: logger,
+		writer: writer,
+	}
+}
+
+func newSinkNotifierFromConfig(cfg *config.Config, _ Dependencies, logger *logger.AppLogger) (Notifier, error) {
+	if cfg.Sink.Output == "" {
+		return nil, ErrChannelNotConfigured
+	}
+	return newSink(cfg, logger)
+}
+
+// Builds the sink of the configured output; the standard output is used when no output is configured.
+func newSink(cfg *config.Config, logger *logger.AppLogger) (*SinkNotifier, error) {
+	switch cfg.Sink.Output {
+	case "", "stdout":
+		return NewSinkNotifier(os.Stdout, logger), nil
+	case "file":
+		if cfg.Sink.Path == "" {
+			return nil, errors.New("the sink path is required for the file output")
+		}
+		file, err := newRotatingFile(cfg.Sink.Path, cfg.Sink.MaxSizeBytes, cfg.Sink.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		return NewSinkNotifier(file, logger), nil
+	default:
+		return nil, fmt.Errorf("unsupported sink output %q", cfg.Sink.Output)
+	}
+}
+
+// SendNotification writes the notification together with its rendering for its delivery channel.
+func (notifier *SinkNotifier) SendNotification(ctx context.Context, notification *data.Notification) SendResult {
+	line, err := json.Marshal(newSinkRecord(ctx, notification))
+	if err != nil {
+		return failedResult(&PermanentError{Err: err})
+	}
+
+	notifier.lock.Lock()
+	_, err = notifier.writer.Write(append(line, '\n'))
+	notifier.lock.Unlock()
+	if err != nil {
+		return failedResult(err)
+	}
+
+	return deliveredResult("", 0)
+}
+
+// Preview renders the line which would be written for the notification.
+func (notifier *SinkNotifier) Preview(ctx context.Context, notification *data.Notification, _ blobstore.BlobStore) (Preview, error) {
+	return jsonPreview(newSinkRecord(ctx, notification))
+}
+
+// Close closes the file of the file output; the standard output is left open.
+func (notifier *SinkNotifier) Close() error {
+	if closer, ok := notifier.writer.(io.Closer); ok && notifier.writer != os.Stdout {
+		return closer.Close()
+	}
+	return nil
+}
+
+func newSinkRecord(ctx context.Context, notification *data.Notification) sinkRecord {
+	return sinkRecord{
+		Time:            time.Now().UTC(),
+		DeliveryChannel: notification.DeliveryChannel,
+		Destination:     notification.Destination,
+		RequestId:       requestIdFromContext(ctx),
+		Notification:    notification,
+		Rendered:        renderForChannel(notification),
+	}
+}
+
+// Renders the notification as it would be sent over its delivery channel;
+// nil for the channels which send the notification as it is.
+func renderForChannel(notification *data.Notification) any {
+	switch notification.DeliveryChannel {
+	case data.Email:
+		return sinkEmail{Subject: emailSubject(notification), Html: emailHtml(notification)}
+	case data.Slack:
+		return newSlackMessage(notification)
+	case data.Queue:
+		return newQueueEnvelope(notification)
+	default:
+		return nil
+	}
+}
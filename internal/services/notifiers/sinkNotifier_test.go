@@ -0,0 +1,127 @@
+package notifiers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sinkLine struct {
+	DeliveryChannel string `json:"deliveryChannel"`
+	Destination     string `json:"destination"`
+	RequestId       string `json:"requestId"`
+	Notification    struct {
+		Id      int    `json:"id"`
+		Message string `json:"message"`
+	} `json:"notification"`
+	Rendered map[string]any `json:"rendered"`
+}
+
+func readSinkLines(t *testing.T, content string) []sinkLine {
+	var lines []sinkLine
+	for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+		var parsed sinkLine
+		require.NoError(t, json.Unmarshal([]byte(line), &parsed))
+		lines = append(lines, parsed)
+	}
+	return lines
+}
+
+func TestSinkNotifier_WritesRenderedNotifications(t *testing.T) {
+	var output bytes.Buffer
+	notifier := notifiers.NewSinkNotifier(&output, logger.Setup(config.ServiceEnv{Name: "test"}))
+
+	ctx := context.WithValue(context.Background(), config.ContextKey(config.RequestIdentifier), "request-42")
+	require.NoError(t, notifier.SendNotification(ctx, &data.Notification{
+		Id: 1, Key: "payment-failed", Message: "Payment has failed", DeliveryChannel: data.Slack, Destination: "payments_ops",
+	}).Err)
+	require.NoError(t, notifier.SendNotification(ctx, &data.Notification{
+		Id: 2, Subject: "Payment failed", Message: "Payment has failed", DeliveryChannel: data.Email,
+	}).Err)
+
+	lines := readSinkLines(t, output.String())
+	require.Len(t, lines, 2)
+	assert.Equal(t, "Slack", lines[0].DeliveryChannel)
+	assert.Equal(t, "payments_ops", lines[0].Destination)
+	assert.Equal(t, "request-42", lines[0].RequestId)
+	assert.Equal(t, 1, lines[0].Notification.Id)
+	assert.Equal(t, "Payment has failed", lines[0].Rendered["text"])
+	assert.Equal(t, "Email", lines[1].DeliveryChannel)
+	assert.Equal(t, "Payment failed", lines[1].Rendered["subject"])
+	assert.Contains(t, lines[1].Rendered["html"], "<p>Payment has failed</p>")
+}
+
+func TestSinkNotifier_RotatesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.jsonl")
+	cfg := &config.Config{}
+	cfg.Sink.Output = "file"
+	cfg.Sink.Path = path
+	cfg.Sink.MaxSizeBytes = 600
+	cfg.Sink.MaxBackups = 2
+
+	registry, err := notifiers.NewRegistry(cfg, notifiers.Dependencies{}, logger.Setup(config.ServiceEnv{Name: "test"}))
+	require.NoError(t, err)
+	notifier, err := registry.Notifier(data.Sink)
+	require.NoError(t, err)
+
+	for i := 1; i <= 6; i++ {
+		require.NoError(t, notifier.SendNotification(context.Background(), &data.Notification{
+			Id: i, Message: "Payment has failed", DeliveryChannel: data.Sink,
+		}).Err)
+	}
+	require.NoError(t, registry.Close())
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := readSinkLines(t, string(current))
+	assert.Equal(t, 6, lines[len(lines)-1].Notification.Id)
+	assert.LessOrEqual(t, len(current), 600)
+
+	assert.FileExists(t, path+".1")
+	assert.FileExists(t, path+".2")
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestCapturingRegistry_RoutesAllChannelsToSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.jsonl")
+	cfg := &config.Config{}
+	cfg.Sink.Output = "file"
+	cfg.Sink.Path = path
+	cfg.Slack.Destinations = map[string]config.SlackDestination{
+		"payments_ops": {SlackConnection: config.SlackConnection{WebhookUrl: "https://hooks.slack.com/services/T111/B111/YYYY"}},
+	}
+
+	registry, err := notifiers.NewCapturingRegistry(cfg, logger.Setup(config.ServiceEnv{Name: "test"}))
+	require.NoError(t, err)
+
+	for _, deliveryChannel := range []data.DeliveryChannel{data.Email, data.Slack, data.InApp, data.Queue, data.Sink} {
+		assert.True(t, registry.IsEnabled(deliveryChannel), deliveryChannel)
+	}
+	assert.True(t, registry.HasDestination(data.Slack, "payments_ops"))
+	assert.False(t, registry.HasDestination(data.Slack, "marketing"))
+
+	notifier, err := registry.Notifier(data.Slack)
+	require.NoError(t, err)
+	require.NoError(t, notifier.SendNotification(context.Background(), &data.Notification{
+		Id: 1, Message: "Payment has failed", DeliveryChannel: data.Slack, Destination: "payments_ops",
+	}).Err)
+	require.NoError(t, registry.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := readSinkLines(t, string(content))
+	require.Len(t, lines, 1)
+	assert.Equal(t, "Slack", lines[0].DeliveryChannel)
+	assert.Equal(t, "payments_ops", lines[0].Destination)
+}
@@ -0,0 +1,213 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/repositories"
+)
+
+const (
+	defaultSlackApiBaseUrl = "https://slack.com/api"
+	resolvedMessagePrefix  = "Resolved: "
+)
+
+var ErrMissingSlackChannel = errors.New("slack notification has no channel")
+
+type SlackApiConfig struct {
+	// The name of the destination; the threads are kept per destination as it could be a separate workspace.
+	Destination    string
+	BotToken       string
+	ApiBaseUrl     string
+	DefaultChannel string
+}
+
+// SlackApiNotifier posts messages over the Slack Web API using a bot token.
+// Notifications with the same key are threaded under the first message posted for the key in a channel,
+// and a resolution updates that first message.
+type SlackApiNotifier struct {
+	SlackApiConfig
+	logger           *logger.AppLogger
+	threadRepository repositories.SlackThreadRepository
+	httpClient       *http.Client
+}
+
+type slackApiResponse struct {
+	Ok      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"`
+	Ts      string `json:"ts"`
+}
+
+func NewSlackApiNotifier(
+	slackApiConfig SlackApiConfig,
+	threadRepository repositories.SlackThreadRepository,
+	logger *logger.AppLogger,
+) *SlackApiNotifier {
+	if slackApiConfig.ApiBaseUrl == "" {
+		slackApiConfig.ApiBaseUrl = defaultSlackApiBaseUrl
+	}
+	slackApiConfig.ApiBaseUrl = strings.TrimSuffix(slackApiConfig.ApiBaseUrl, "/")
+
+	return &SlackApiNotifier{
+		SlackApiConfig:   slackApiConfig,
+		logger:           logger,
+		threadRepository: threadRepository,
+		httpClient:       &http.Client{},
+	}
+}
+
+// SendNotification posts the notification and returns the ts of the posted message as its message id.
+func (notifier *SlackApiNotifier) SendNotification(ctx context.Context, notification *data.Notification) SendResult {
+	notifier.logger.Debug().Msg("Sending slack message over the Web API")
+
+	response, err := notifier.send(ctx, notification)
+	if err != nil {
+		return failedResult(err)
+	}
+	return deliveredResult(response.Ts, http.StatusOK)
+}
+
+// Preview renders the payload of the chat.postMessage call. A notification whose key already has a thread
+// is rendered as a reply in the thread; the update of the first message by a resolution is not rendered.
+func (notifier *SlackApiNotifier) Preview(
+	ctx context.Context,
+	notification *data.Notification,
+	_ blobstore.BlobStore,
+) (Preview, error) {
+	channel, thread, err := notifier.resolveThread(ctx, notification)
+	if err != nil {
+		return Preview{}, err
+	}
+
+	message := newSlackMessage(notification)
+	message.Channel = channel
+	if thread != nil {
+		message.Channel, message.ThreadTs = thread.ChannelId, thread.Ts
+	}
+	return jsonPreview(message, channel)
+}
+
+func (notifier *SlackApiNotifier) send(ctx context.Context, notification *data.Notification) (*slackApiResponse, error) {
+	channel, thread, err := notifier.resolveThread(ctx, notification)
+	if err != nil {
+		return nil, err
+	}
+
+	if thread == nil {
+		return notifier.startThread(ctx, notification, channel)
+	}
+
+	if notification.Resolved {
+		update := newSlackMessage(notification)
+		update.Channel, update.Ts = thread.ChannelId, thread.Ts
+		if _, err := notifier.call(ctx, "chat.update", update); err != nil {
+			return nil, err
+		}
+	}
+
+	reply := newSlackMessage(notification)
+	reply.Channel, reply.ThreadTs = thread.ChannelId, thread.Ts
+	return notifier.call(ctx, "chat.postMessage", reply)
+}
+
+// Returns the channel of the notification and the thread of its key in the channel; nil when there is no thread yet.
+func (notifier *SlackApiNotifier) resolveThread(
+	ctx context.Context,
+	notification *data.Notification,
+) (string, *data.SlackThread, error) {
+	channel := notification.SlackChannel
+	if channel == "" {
+		channel = notifier.DefaultChannel
+	}
+	if channel == "" {
+		return "", nil, ErrMissingSlackChannel
+	}
+
+	if notification.Key == "" {
+		return channel, nil, nil
+	}
+	thread, err := notifier.threadRepository.FindByDestinationKeyAndChannel(ctx, notifier.Destination, notification.Key, channel)
+	return channel, thread, err
+}
+
+// Posts the notification as a new message and remembers it as the thread for the notification key.
+func (notifier *SlackApiNotifier) startThread(
+	ctx context.Context,
+	notification *data.Notification,
+	channel string,
+) (*slackApiResponse, error) {
+	message := newSlackMessage(notification)
+	message.Channel = channel
+
+	response, err := notifier.call(ctx, "chat.postMessage", message)
+	if err != nil {
+		return nil, err
+	}
+
+	if notification.Key == "" {
+		return response, nil
+	}
+
+	thread := &data.SlackThread{
+		Destination: notifier.Destination,
+		Key:         notification.Key,
+		Channel:     channel,
+		ChannelId:   response.Channel,
+		Ts:          response.Ts,
+	}
+	if _, err := notifier.threadRepository.Create(ctx, thread); err != nil {
+		// The message is already posted, so only the threading of the follow-ups is lost.
+		notifier.logger.Error().Err(err).Str("key", notification.Key).Msg("Failed to store the slack thread.")
+	}
+
+	return response, nil
+}
+
+// Calls the Slack Web API method and returns its response if the call has succeeded.
+func (notifier *SlackApiNotifier) call(ctx context.Context, method string, message slackMessage) (*slackApiResponse, error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notifier.ApiBaseUrl+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+notifier.BotToken)
+	if requestId := requestIdFromContext(ctx); requestId != "" {
+		req.Header.Set(config.RequestIdentifier, requestId)
+	}
+
+	resp, err := notifier.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	retryAfter := parseRetryAfter(resp.Header)
+	var response slackApiResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, slackResponseLimit)).Decode(&response); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, &SlackError{StatusCode: resp.StatusCode, Code: http.StatusText(resp.StatusCode), RetryAfter: retryAfter}
+		}
+		return nil, fmt.Errorf("slack %s returned an invalid response: %w", method, err)
+	}
+	if resp.StatusCode != http.StatusOK || !response.Ok {
+		return nil, &SlackError{StatusCode: resp.StatusCode, Code: response.Error, RetryAfter: retryAfter}
+	}
+
+	return &response, nil
+}
@@ -0,0 +1,142 @@
+package notifiers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSlackThreadRepository struct {
+	threads []data.SlackThread
+}
+
+func (repository *fakeSlackThreadRepository) Create(_ context.Context, thread *data.SlackThread) (*data.SlackThread, error) {
+	repository.threads = append(repository.threads, *thread)
+	return thread, nil
+}
+
+func (repository *fakeSlackThreadRepository) FindByDestinationKeyAndChannel(
+	_ context.Context,
+	destination string,
+	key string,
+	channel string,
+) (*data.SlackThread, error) {
+	for _, thread := range repository.threads {
+		if thread.Destination == destination && thread.Key == key && thread.Channel == channel {
+			return &thread, nil
+		}
+	}
+	return nil, nil
+}
+
+type slackApiCall struct {
+	Method        string
+	Authorization string
+	Body          map[string]any
+}
+
+// A fake of the Slack Web API which records the calls and answers them the way Slack does.
+type fakeSlackApi struct {
+	lock  sync.Mutex
+	calls []slackApiCall
+}
+
+func (api *fakeSlackApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	api.lock.Lock()
+	api.calls = append(api.calls, slackApiCall{Method: r.URL.Path, Authorization: r.Header.Get("Authorization"), Body: body})
+	api.lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch body["channel"] {
+	case "#missing":
+		_, _ = w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`))
+		return
+	case "#unavailable":
+		_, _ = w.Write([]byte(`{"ok":false,"error":"service_unavailable"}`))
+		return
+	}
+	_, _ = w.Write([]byte(`{"ok":true,"channel":"C0001","ts":"1700000000.000100"}`))
+}
+
+func newSlackApiNotifier(t *testing.T, api *fakeSlackApi, repository *fakeSlackThreadRepository) *notifiers.SlackApiNotifier {
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	slackApiConfig := notifiers.SlackApiConfig{BotToken: "xoxb-test", ApiBaseUrl: server.URL + "/", DefaultChannel: "#alerts"}
+	return notifiers.NewSlackApiNotifier(slackApiConfig, repository, logger.Setup(config.ServiceEnv{Name: "test"}))
+}
+
+func TestSlackApiNotifier_ThreadsFollowUps(t *testing.T) {
+	api := &fakeSlackApi{}
+	repository := &fakeSlackThreadRepository{}
+	notifier := newSlackApiNotifier(t, api, repository)
+
+	require.NoError(t, notifier.SendNotification(context.Background(), &data.Notification{Key: "payment-1", Message: "Payment failed"}).Err)
+	require.NoError(t, notifier.SendNotification(context.Background(), &data.Notification{Key: "payment-1", Message: "Still failing"}).Err)
+
+	require.Len(t, api.calls, 2)
+	assert.Equal(t, "/chat.postMessage", api.calls[0].Method)
+	assert.Equal(t, "Bearer xoxb-test", api.calls[0].Authorization)
+	assert.Equal(t, "#alerts", api.calls[0].Body["channel"])
+	assert.Empty(t, api.calls[0].Body["thread_ts"])
+
+	assert.Equal(t, "/chat.postMessage", api.calls[1].Method)
+	assert.Equal(t, "C0001", api.calls[1].Body["channel"])
+	assert.Equal(t, "1700000000.000100", api.calls[1].Body["thread_ts"])
+
+	require.Len(t, repository.threads, 1)
+	assert.Equal(t, "#alerts", repository.threads[0].Channel)
+}
+
+func TestSlackApiNotifier_ResolutionUpdatesOriginalMessage(t *testing.T) {
+	api := &fakeSlackApi{}
+	repository := &fakeSlackThreadRepository{}
+	notifier := newSlackApiNotifier(t, api, repository)
+
+	require.NoError(t, notifier.SendNotification(context.Background(), &data.Notification{Key: "payment-1", Message: "Payment failed", SlackChannel: "#payments"}).Err)
+	require.NoError(t, notifier.SendNotification(context.Background(), &data.Notification{Key: "payment-1", Message: "Payment retried", SlackChannel: "#payments", Resolved: true}).Err)
+
+	require.Len(t, api.calls, 3)
+	assert.Equal(t, "#payments", api.calls[0].Body["channel"])
+	assert.Equal(t, "/chat.update", api.calls[1].Method)
+	assert.Equal(t, "1700000000.000100", api.calls[1].Body["ts"])
+	assert.Equal(t, "Resolved: Payment retried", api.calls[1].Body["text"])
+	assert.Equal(t, "/chat.postMessage", api.calls[2].Method)
+	assert.Equal(t, "1700000000.000100", api.calls[2].Body["thread_ts"])
+}
+
+func TestSlackApiNotifier_ReturnsSlackErrors(t *testing.T) {
+	tests := []struct {
+		channel string
+		code    string
+		outcome notifiers.SendOutcome
+	}{
+		{"#missing", "channel_not_found", notifiers.PermanentFailure},
+		// The failures of Slack itself are reported with HTTP 200 too, but they are retried.
+		{"#unavailable", "service_unavailable", notifiers.TransientFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			notifier := newSlackApiNotifier(t, &fakeSlackApi{}, &fakeSlackThreadRepository{})
+
+			result := notifier.SendNotification(context.Background(), &data.Notification{Message: "Payment failed", SlackChannel: tt.channel})
+
+			require.Error(t, result.Err)
+			assert.Contains(t, result.Err.Error(), tt.code)
+			assert.Equal(t, tt.outcome, result.Outcome)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package notifiers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/plyovchev/notifications-service/internal/models/data"
+)
+
+const (
+	slackHeaderMaxLength = 150
+	defaultSlackHeader   = "Notification"
+	resolvedColor        = "#2eb886"
+)
+
+// The colour of the message attachment bar for each severity.
+var severityColors = map[data.NotificationType]string{
+	data.Info:    "#439fe0",
+	data.Warning: "#daa038",
+	data.Error:   "#a30200",
+}
+
+// A Slack message as accepted by both incoming webhooks and chat.postMessage/chat.update.
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Ts          string            `json:"ts,omitempty"`
+	ThreadTs    string            `json:"thread_ts,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+// An attachment is used to render the blocks next to a bar in the colour of the severity.
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type     string       `json:"type"`
+	Text     *slackText   `json:"text,omitempty"`
+	Elements []*slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// An error reported by Slack, for example 'invalid_payload' or 'channel_not_found'.
+type SlackError struct {
+	StatusCode int
+	Code       string
+	// The Retry-After hint of a rate limited request.
+	RetryAfter time.Duration
+}
+
+func (err *SlackError) Error() string {
+	return fmt.Sprintf("slack request failed with http status %d: %s", err.StatusCode, err.Code)
+}
+
+// Builds the Block Kit layout of the notification: a header with the key, the message
+// and a context line with the severity, all next to a bar in the colour of the severity.
+// The plain text is kept as a fallback for notifications and clients without Block Kit support.
+func newSlackMessage(notification *data.Notification) slackMessage {
+	severity := notification.Type
+	if severity == "" {
+		severity = data.Info
+	}
+
+	color := severityColors[severity]
+	text := notification.Message
+	if notification.Resolved {
+		color = resolvedColor
+		text = resolvedMessagePrefix + notification.Message
+	}
+
+	header := notification.Key
+	if header == "" {
+		header = defaultSlackHeader
+	}
+
+	contextElements := []*slackText{{Type: "mrkdwn", Text: "*Severity:* " + string(severity)}}
+	if notification.Id != 0 {
+		contextElements = append(contextElements, &slackText{Type: "mrkdwn", Text: "*Notification:* " + strconv.Itoa(notification.Id)})
+	}
+	if !notification.CreatedAt.IsZero() {
+		contextElements = append(contextElements, &slackText{Type: "plain_text", Text: notification.CreatedAt.UTC().Format(time.RFC1123)})
+	}
+
+	return slackMessage{
+		Text: text,
+		Attachments: []slackAttachment{{
+			Color: color,
+			Blocks: []slackBlock{
+				{Type: "header", Text: &slackText{Type: "plain_text", Text: truncate(header, slackHeaderMaxLength)}},
+				{Type: "section", Text: &slackText{Type: "mrkdwn", Text: escapeSlackText(text)}},
+				{Type: "context", Elements: contextElements},
+			},
+		}},
+	}
+}
+
+// Escapes the characters which Slack treats as control characters in mrkdwn text.
+func escapeSlackText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// Truncates the text to at most maxLength characters without breaking a multi-byte character.
+func truncate(text string, maxLength int) string {
+	if utf8.RuneCountInString(text) <= maxLength {
+		return text
+	}
+
+	runes := []rune(text)
+	return string(runes[:maxLength-1]) + "…"
+}
@@ -3,47 +3,181 @@ package notifiers
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"time"
+	"net/url"
+	"strings"
 
+	"github.com/plyovchev/notifications-service/internal/blobstore"
+	"github.com/plyovchev/notifications-service/internal/config"
 	"github.com/plyovchev/notifications-service/internal/logger"
 	"github.com/plyovchev/notifications-service/internal/models/data"
 )
 
-const slackWebhookTimeout = 30 * time.Second
+const (
+	// The names of the providers built from the top level connection of a destination.
+	slackWebhookProviderName = "webhook"
+	slackApiProviderName     = "slack_api"
+
+	// The maximum size of a Slack response body which is read for error reporting.
+	slackResponseLimit = 4096
+	// The error code of the Slack Web API for rate limited requests.
+	slackRateLimitedCode = "ratelimited"
+)
+
+// The error codes of the Slack Web API which report a failure of Slack rather than of the request,
+// so the request could succeed when it is retried.
+var slackTransientCodes = []string{"internal_error", "fatal_error", "service_unavailable", "request_timeout"}
+
+func init() {
+	RegisterFactory(data.Slack, newSlackNotifierFromConfig)
+}
 
 type SlackNotifier struct {
 	logger     *logger.AppLogger
 	webhookUrl string
+	httpClient *http.Client
 }
 
 func NewSlackNotifier(webhookUrl string, logger *logger.AppLogger) *SlackNotifier {
 	return &SlackNotifier{
 		logger:     logger,
 		webhookUrl: webhookUrl,
+		httpClient: &http.Client{},
 	}
 }
 
-func (notifier *SlackNotifier) SendNotification(notification *data.Notification) error {
-	notifier.logger.Debug().Msg("Sending slack message")
+// Preview renders the payload posted to the webhook. The webhook is bound to its channel, so it has no recipients.
+func (notifier *SlackNotifier) Preview(_ context.Context, notification *data.Notification, _ blobstore.BlobStore) (Preview, error) {
+	return jsonPreview(newSlackMessage(notification))
+}
 
-	var jsonStr = fmt.Sprintf("{\"text\":\"%s\"}", notification.Message)
-	var jsonBytes = []byte(jsonStr)
+// SendNotification posts the notification to the webhook. Webhooks do not return an id of the posted message.
+func (notifier *SlackNotifier) SendNotification(ctx context.Context, notification *data.Notification) SendResult {
+	notifier.logger.Debug().Msg("Sending slack message")
 
-	ctx, cancel := context.WithTimeout(context.Background(), slackWebhookTimeout)
-	defer cancel()
+	jsonBytes, err := json.Marshal(newSlackMessage(notification))
+	if err != nil {
+		return failedResult(&PermanentError{Err: err})
+	}
 
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, notifier.webhookUrl, bytes.NewBuffer(jsonBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notifier.webhookUrl, bytes.NewReader(jsonBytes))
+	if err != nil {
+		return failedResult(&PermanentError{Err: err})
+	}
 	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		return err
+	if requestId := requestIdFromContext(ctx); requestId != "" {
+		req.Header.Set(config.RequestIdentifier, requestId)
 	}
 
+	resp, err := notifier.httpClient.Do(req)
+	if err != nil {
+		return failedResult(err)
+	}
 	defer resp.Body.Close()
 
+	// Incoming webhooks answer with a plain text body: 'ok' on success
+	// and an error code such as 'invalid_payload' or 'channel_not_found' otherwise.
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, slackResponseLimit))
+	responseText := strings.TrimSpace(string(body))
+	if resp.StatusCode != http.StatusOK || responseText != "ok" {
+		if responseText == "" {
+			responseText = http.StatusText(resp.StatusCode)
+		}
+		return failedResult(&SlackError{StatusCode: resp.StatusCode, Code: responseText, RetryAfter: parseRetryAfter(resp.Header)})
+	}
+
+	return deliveredResult("", resp.StatusCode)
+}
+
+// Builds the Slack notifier of every configured destination.
+func newSlackNotifierFromConfig(cfg *config.Config, dependencies Dependencies, logger *logger.AppLogger) (Notifier, error) {
+	build := func(destination string, settings config.SlackDestination) (Notifier, error) {
+		return newSlackDestinationNotifier(destination, settings, dependencies, logger)
+	}
+	return newDestinationRouter(cfg.Slack.SlackDestination, cfg.Slack.Destinations, cfg.Slack.DefaultDestination, build)
+}
+
+// Builds the Slack notifier of a destination with its providers in the configured order.
+// The top level connection is the only provider when no providers are listed;
+// the destination is not configured when neither is set.
+func newSlackDestinationNotifier(
+	destination string,
+	settings config.SlackDestination,
+	dependencies Dependencies,
+	logger *logger.AppLogger,
+) (Notifier, error) {
+	providerSettings := settings.Providers
+	if len(providerSettings) == 0 {
+		if settings.BotToken == "" && settings.WebhookUrl == "" {
+			return nil, ErrChannelNotConfigured
+		}
+
+		providerName := slackWebhookProviderName
+		if settings.BotToken != "" {
+			providerName = slackApiProviderName
+		}
+		providerSettings = []config.SlackProvider{{Name: providerName, SlackConnection: settings.SlackConnection}}
+	}
+
+	providers, err := newProviders(
+		providerSettings,
+		func(provider config.SlackProvider) string { return provider.Name },
+		func(provider config.SlackProvider) (Notifier, error) {
+			return newSlackProviderNotifier(destination, provider.SlackConnection, settings.DefaultChannel, dependencies, logger)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return newFailoverNotifier(providers, logger), nil
+}
+
+// Builds the Slack notifier of a provider. A bot token selects the Web API notifier,
+// otherwise the incoming webhook is used.
+func newSlackProviderNotifier(
+	destination string,
+	connection config.SlackConnection,
+	defaultChannel string,
+	dependencies Dependencies,
+	logger *logger.AppLogger,
+) (Notifier, error) {
+	if connection.BotToken != "" {
+		if connection.ApiBaseUrl != "" {
+			if err := validateHttpUrl(connection.ApiBaseUrl); err != nil {
+				return nil, fmt.Errorf("invalid api_base_url: %w", err)
+			}
+		}
+
+		slackApiConfig := SlackApiConfig{
+			Destination:    destination,
+			BotToken:       connection.BotToken,
+			ApiBaseUrl:     connection.ApiBaseUrl,
+			DefaultChannel: defaultChannel,
+		}
+		return NewSlackApiNotifier(slackApiConfig, dependencies.SlackThreadRepository, logger), nil
+	}
+
+	if connection.WebhookUrl == "" {
+		return nil, errors.New("either bot_token or webhook_url is required")
+	}
+	if err := validateHttpUrl(connection.WebhookUrl); err != nil {
+		return nil, fmt.Errorf("invalid webhook_url: %w", err)
+	}
+
+	return NewSlackNotifier(connection.WebhookUrl, logger), nil
+}
+
+func validateHttpUrl(rawUrl string) error {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%q is not an absolute http(s) url", rawUrl)
+	}
 	return nil
 }
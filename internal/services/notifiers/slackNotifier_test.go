@@ -0,0 +1,127 @@
+package notifiers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/logger"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/plyovchev/notifications-service/internal/services/notifiers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type webhookPayload struct {
+	Text        string `json:"text"`
+	Attachments []struct {
+		Color  string `json:"color"`
+		Blocks []struct {
+			Type string `json:"type"`
+			Text *struct {
+				Text string `json:"text"`
+			} `json:"text"`
+		} `json:"blocks"`
+	} `json:"attachments"`
+}
+
+func newWebhookServer(t *testing.T, statusCode int, response string, payload *webhookPayload) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("invalid_payload"))
+			return
+		}
+		w.WriteHeader(statusCode)
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSlackNotifier_EncodesSpecialCharacters(t *testing.T) {
+	var payload webhookPayload
+	server := newWebhookServer(t, http.StatusOK, "ok", &payload)
+	notifier := notifiers.NewSlackNotifier(server.URL, logger.Setup(config.ServiceEnv{Name: "test"}))
+	message := "Payment \"42\" failed\\n\nwith <error> & more"
+
+	err := notifier.SendNotification(context.Background(), &data.Notification{Key: "payment", Message: message, Type: data.Error}).Err
+
+	require.NoError(t, err)
+	assert.Equal(t, message, payload.Text)
+	require.Len(t, payload.Attachments, 1)
+	assert.Equal(t, "#a30200", payload.Attachments[0].Color)
+
+	blocks := payload.Attachments[0].Blocks
+	require.Len(t, blocks, 3)
+	assert.Equal(t, "header", blocks[0].Type)
+	assert.Equal(t, "payment", blocks[0].Text.Text)
+	assert.Equal(t, "section", blocks[1].Type)
+	assert.Equal(t, "Payment \"42\" failed\\n\nwith &lt;error&gt; &amp; more", blocks[1].Text.Text)
+	assert.Equal(t, "context", blocks[2].Type)
+}
+
+func TestSlackNotifier_PropagatesRequestId(t *testing.T) {
+	var requestId string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId = r.Header.Get(config.RequestIdentifier)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	notifier := notifiers.NewSlackNotifier(server.URL, logger.Setup(config.ServiceEnv{Name: "test"}))
+
+	ctx := context.WithValue(context.Background(), config.ContextKey(config.RequestIdentifier), "request-42")
+	require.NoError(t, notifier.SendNotification(ctx, &data.Notification{Message: "message"}).Err)
+
+	assert.Equal(t, "request-42", requestId)
+}
+
+func TestSlackNotifier_ReturnsSlackErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		response   string
+		code       string
+		outcome    notifiers.SendOutcome
+	}{
+		{"ChannelNotFound", http.StatusNotFound, "channel_not_found", "channel_not_found", notifiers.PermanentFailure},
+		{"ServerError", http.StatusInternalServerError, "", "Internal Server Error", notifiers.TransientFailure},
+		{"UnexpectedBody", http.StatusOK, "not ok", "not ok", notifiers.PermanentFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newWebhookServer(t, tt.statusCode, tt.response, &webhookPayload{})
+			notifier := notifiers.NewSlackNotifier(server.URL, logger.Setup(config.ServiceEnv{Name: "test"}))
+
+			result := notifier.SendNotification(context.Background(), &data.Notification{Message: "message"})
+
+			var slackErr *notifiers.SlackError
+			require.ErrorAs(t, result.Err, &slackErr)
+			assert.Equal(t, tt.statusCode, slackErr.StatusCode)
+			assert.Equal(t, tt.code, slackErr.Code)
+			assert.Equal(t, tt.outcome, result.Outcome)
+			assert.Equal(t, tt.statusCode, result.ResponseCode)
+		})
+	}
+}
+
+func TestSlackNotifier_RateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("rate_limited"))
+	}))
+	t.Cleanup(server.Close)
+	notifier := notifiers.NewSlackNotifier(server.URL, logger.Setup(config.ServiceEnv{Name: "test"}))
+
+	result := notifier.SendNotification(context.Background(), &data.Notification{Message: "message"})
+
+	require.Error(t, result.Err)
+	assert.Equal(t, notifiers.RateLimited, result.Outcome)
+	assert.Equal(t, 30*time.Second, result.RetryAfter)
+	assert.True(t, result.CanRetry())
+}
@@ -0,0 +1,222 @@
+package notifiers_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	smtpTestUsername = "sender@example.com"
+	smtpTestPassword = "secret"
+)
+
+// A minimal in-process SMTP server for testing the email notifier.
+type fakeSmtpServer struct {
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	implicitTls bool
+	startTls    bool
+	// The advertised AUTH mechanisms; empty for a relay without authentication.
+	authMechanisms string
+
+	lock        sync.Mutex
+	connections int
+	messages    []string
+	usedTls     []bool
+}
+
+type fakeSmtpServerOptions struct {
+	implicitTls    bool
+	startTls       bool
+	authMechanisms string
+}
+
+// Starts the fake server and returns it together with the path of the PEM file of its CA certificate.
+func startFakeSmtpServer(t *testing.T, options fakeSmtpServerOptions) (*fakeSmtpServer, string) {
+	certificate, certPem := newTestCertificate(t)
+	caCertFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caCertFile, certPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &fakeSmtpServer{
+		listener:       listener,
+		tlsConfig:      &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12},
+		implicitTls:    options.implicitTls,
+		startTls:       options.startTls,
+		authMechanisms: options.authMechanisms,
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go server.serve()
+	return server, caCertFile
+}
+
+func (server *fakeSmtpServer) port() string {
+	return strings.TrimPrefix(server.listener.Addr().String(), "127.0.0.1:")
+}
+
+func (server *fakeSmtpServer) stats() (int, []string, []bool) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.connections, append([]string(nil), server.messages...), append([]bool(nil), server.usedTls...)
+}
+
+func (server *fakeSmtpServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		server.lock.Lock()
+		server.connections++
+		server.lock.Unlock()
+
+		go server.handle(conn)
+	}
+}
+
+func (server *fakeSmtpServer) handle(conn net.Conn) {
+	isTls := server.implicitTls
+	if isTls {
+		conn = tls.Server(conn, server.tlsConfig)
+	}
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	_ = text.PrintfLine("220 localhost ESMTP")
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, argument, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			extensions := []string{"localhost", "8BITMIME"}
+			if server.startTls && !isTls {
+				extensions = append(extensions, "STARTTLS")
+			}
+			if server.authMechanisms != "" {
+				extensions = append(extensions, "AUTH "+server.authMechanisms)
+			}
+			for i, extension := range extensions {
+				separator := "-"
+				if i == len(extensions)-1 {
+					separator = " "
+				}
+				_ = text.PrintfLine("250%s%s", separator, extension)
+			}
+		case "STARTTLS":
+			_ = text.PrintfLine("220 Ready to start TLS")
+			conn = tls.Server(conn, server.tlsConfig)
+			text = textproto.NewConn(conn)
+			isTls = true
+		case "AUTH":
+			if server.authenticate(text, argument) {
+				_ = text.PrintfLine("235 Authentication successful")
+			} else {
+				_ = text.PrintfLine("535 Authentication failed")
+			}
+		case "RCPT":
+			if strings.Contains(argument, "rejected") {
+				_ = text.PrintfLine("550 No such user")
+			} else {
+				_ = text.PrintfLine("250 OK")
+			}
+		case "DATA":
+			_ = text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			message, _ := io.ReadAll(text.DotReader())
+			server.lock.Lock()
+			server.messages = append(server.messages, string(message))
+			server.usedTls = append(server.usedTls, isTls)
+			server.lock.Unlock()
+			_ = text.PrintfLine("250 OK")
+		case "QUIT":
+			_ = text.PrintfLine("221 Bye")
+			return
+		default:
+			_ = text.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (server *fakeSmtpServer) authenticate(text *textproto.Conn, argument string) bool {
+	mechanism, initialResponse, _ := strings.Cut(argument, " ")
+
+	readResponse := func(challenge string) string {
+		_ = text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+		line, _ := text.ReadLine()
+		decoded, _ := base64.StdEncoding.DecodeString(line)
+		return string(decoded)
+	}
+
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		decoded, _ := base64.StdEncoding.DecodeString(initialResponse)
+		return string(decoded) == "\x00"+smtpTestUsername+"\x00"+smtpTestPassword
+	case "LOGIN":
+		return readResponse("Username:") == smtpTestUsername && readResponse("Password:") == smtpTestPassword
+	case "CRAM-MD5":
+		challenge := "<1896.697170952@localhost>"
+		mac := hmac.New(md5.New, []byte(smtpTestPassword))
+		mac.Write([]byte(challenge))
+		return readResponse(challenge) == smtpTestUsername+" "+hex.EncodeToString(mac.Sum(nil))
+	}
+	return false
+}
+
+// Creates a self-signed certificate for 127.0.0.1 and returns it with its PEM encoding.
+func newTestCertificate(t *testing.T) (tls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake smtp server"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return certificate, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,365 @@
+package notifiers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"sync"
+	"time"
+)
+
+type SmtpTlsMode string
+
+const (
+	// Plain connection without TLS.
+	SmtpTlsNone SmtpTlsMode = "none"
+	// STARTTLS is used when the server supports it.
+	SmtpStartTlsOptional SmtpTlsMode = "starttls_optional"
+	// STARTTLS is required; the send fails if the server does not support it.
+	SmtpStartTlsRequired SmtpTlsMode = "starttls_required"
+	// TLS from the start of the connection, usually on port 465.
+	SmtpImplicitTls SmtpTlsMode = "implicit"
+)
+
+type SmtpAuthMechanism string
+
+const (
+	SmtpAuthNone    SmtpAuthMechanism = "none"
+	SmtpAuthPlain   SmtpAuthMechanism = "plain"
+	SmtpAuthLogin   SmtpAuthMechanism = "login"
+	SmtpAuthCramMd5 SmtpAuthMechanism = "cram-md5"
+)
+
+const (
+	defaultSmtpMaxIdleConn = 2
+	defaultSmtpQuitTimeout = 5 * time.Second
+	// The reply code of an SMTP server which accepted a message.
+	smtpOkCode = 250
+)
+
+var ErrStartTlsNotSupported = errors.New("smtp server does not support STARTTLS")
+
+type SmtpTransportConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	TlsMode  SmtpTlsMode
+	Auth     SmtpAuthMechanism
+	// Path to a PEM file with additional CA certificates trusted for the SMTP server.
+	CaCertFile string
+	// The maximum count of idle connections kept for reuse.
+	MaxIdleConnections int
+	// The time for which the server is awaited to acknowledge the QUIT of a connection which is no longer reused.
+	QuitTimeout time.Duration
+}
+
+// smtpTransport sends messages over pooled SMTP connections.
+// Connections are returned to the pool after a successful send and reused by the next send,
+// so a batch of emails is delivered over a single connection.
+type smtpTransport struct {
+	SmtpTransportConfig
+	tlsConfig *tls.Config
+	lock      sync.Mutex
+	idle      []*smtpConnection
+}
+
+// An SMTP client together with its network connection, whose deadline bounds the SMTP exchanges.
+type smtpConnection struct {
+	client *smtp.Client
+	conn   net.Conn
+	// Set when an exchange was aborted by its context; such a connection is not reused.
+	aborted bool
+}
+
+func newSmtpTransport(transportConfig SmtpTransportConfig) (*smtpTransport, error) {
+	if transportConfig.TlsMode == "" {
+		transportConfig.TlsMode = SmtpStartTlsOptional
+	}
+	if transportConfig.Auth == "" {
+		transportConfig.Auth = SmtpAuthPlain
+	}
+	if transportConfig.MaxIdleConnections <= 0 {
+		transportConfig.MaxIdleConnections = defaultSmtpMaxIdleConn
+	}
+	if transportConfig.QuitTimeout <= 0 {
+		transportConfig.QuitTimeout = defaultSmtpQuitTimeout
+	}
+
+	switch transportConfig.TlsMode {
+	case SmtpTlsNone, SmtpStartTlsOptional, SmtpStartTlsRequired, SmtpImplicitTls:
+	default:
+		return nil, fmt.Errorf("unsupported smtp tls mode %q", transportConfig.TlsMode)
+	}
+
+	switch transportConfig.Auth {
+	case SmtpAuthNone, SmtpAuthPlain, SmtpAuthLogin, SmtpAuthCramMd5:
+	default:
+		return nil, fmt.Errorf("unsupported smtp auth mechanism %q", transportConfig.Auth)
+	}
+
+	tlsConfig := &tls.Config{ServerName: transportConfig.Host, MinVersion: tls.VersionTLS12}
+	if transportConfig.CaCertFile != "" {
+		rootCAs, err := loadCertPool(transportConfig.CaCertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	return &smtpTransport{SmtpTransportConfig: transportConfig, tlsConfig: tlsConfig}, nil
+}
+
+// Send delivers the message to the recipients over a pooled connection.
+// The send is aborted when the context is done.
+func (transport *smtpTransport) Send(ctx context.Context, from string, recipients []string, message []byte) (string, int, error) {
+	connection, err := transport.acquire(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+
+	err = connection.exchange(ctx, func(client *smtp.Client) error {
+		return sendMail(client, from, recipients, message)
+	})
+	if err != nil {
+		// The state of the connection is unknown after a failure, so it is not reused.
+		_ = connection.client.Close()
+		return "", 0, err
+	}
+
+	transport.release(connection)
+	return "", smtpOkCode, nil
+}
+
+// Close closes all idle connections.
+func (transport *smtpTransport) Close() error {
+	transport.lock.Lock()
+	idle := transport.idle
+	transport.idle = nil
+	transport.lock.Unlock()
+
+	for _, connection := range idle {
+		connection.quit(transport.QuitTimeout)
+	}
+	return nil
+}
+
+// Returns an idle connection which is still alive or opens a new one.
+func (transport *smtpTransport) acquire(ctx context.Context) (*smtpConnection, error) {
+	for {
+		transport.lock.Lock()
+		if len(transport.idle) == 0 {
+			transport.lock.Unlock()
+			break
+		}
+		connection := transport.idle[len(transport.idle)-1]
+		transport.idle = transport.idle[:len(transport.idle)-1]
+		transport.lock.Unlock()
+
+		if err := connection.exchange(ctx, (*smtp.Client).Reset); err == nil && !connection.aborted {
+			return connection, nil
+		}
+		_ = connection.client.Close()
+	}
+
+	return transport.dial(ctx)
+}
+
+// Returns the connection to the pool or closes it if the pool is full.
+func (transport *smtpTransport) release(connection *smtpConnection) {
+	transport.lock.Lock()
+	if !connection.aborted && len(transport.idle) < transport.MaxIdleConnections {
+		transport.idle = append(transport.idle, connection)
+		connection = nil
+	}
+	transport.lock.Unlock()
+
+	if connection != nil {
+		connection.quit(transport.QuitTimeout)
+	}
+}
+
+// Opens a new connection, negotiates TLS according to the TLS mode and authenticates.
+func (transport *smtpTransport) dial(ctx context.Context) (*smtpConnection, error) {
+	address := net.JoinHostPort(transport.Host, transport.Port)
+
+	var conn net.Conn
+	var err error
+	if transport.TlsMode == SmtpImplicitTls {
+		dialer := &tls.Dialer{Config: transport.tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	} else {
+		dialer := &net.Dialer{}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	connection := &smtpConnection{conn: conn}
+	err = connection.exchange(ctx, func(*smtp.Client) error {
+		// The greeting of the server is read when the client is created.
+		client, err := smtp.NewClient(conn, transport.Host)
+		if err != nil {
+			return err
+		}
+		connection.client = client
+		return transport.handshake(client)
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return connection, nil
+}
+
+// Runs the SMTP exchange within the deadline of the context and aborts it when the context is cancelled,
+// so a hung server does not block the send beyond its deadline.
+func (connection *smtpConnection) exchange(ctx context.Context, exchange func(client *smtp.Client) error) error {
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		_ = connection.conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = connection.conn.SetDeadline(time.Now())
+	})
+
+	err := exchange(connection.client)
+	if !stop() {
+		connection.aborted = true
+	}
+	if err != nil {
+		ctxErr := ctx.Err()
+		if ctxErr == nil && hasDeadline && !time.Now().Before(deadline) {
+			// The deadline of the connection could expire just before the one of the context.
+			ctxErr = context.DeadlineExceeded
+		}
+		if ctxErr != nil && !errors.Is(err, ctxErr) {
+			err = fmt.Errorf("%w: %w", ctxErr, err)
+		}
+		return err
+	}
+
+	if !connection.aborted {
+		_ = connection.conn.SetDeadline(time.Time{})
+	}
+	return nil
+}
+
+// Ends the SMTP session within the timeout, so a server which stops responding does not block the caller, e.g. the
+// worker which closes the idle connections or the shutdown. The connection is closed when the QUIT fails.
+func (connection *smtpConnection) quit(timeout time.Duration) {
+	_ = connection.conn.SetDeadline(time.Now().Add(timeout))
+	if err := connection.client.Quit(); err != nil {
+		_ = connection.client.Close()
+	}
+}
+
+func (transport *smtpTransport) handshake(client *smtp.Client) error {
+	if transport.TlsMode == SmtpStartTlsOptional || transport.TlsMode == SmtpStartTlsRequired {
+		if supported, _ := client.Extension("STARTTLS"); supported {
+			if err := client.StartTLS(transport.tlsConfig); err != nil {
+				return err
+			}
+		} else if transport.TlsMode == SmtpStartTlsRequired {
+			return ErrStartTlsNotSupported
+		}
+	}
+
+	if transport.Auth == SmtpAuthNone {
+		return nil
+	}
+
+	return client.Auth(transport.auth())
+}
+
+func (transport *smtpTransport) auth() smtp.Auth {
+	switch transport.Auth {
+	case SmtpAuthLogin:
+		return &loginAuth{username: transport.Username, password: transport.Password, host: transport.Host}
+	case SmtpAuthCramMd5:
+		return smtp.CRAMMD5Auth(transport.Username, transport.Password)
+	case SmtpAuthNone, SmtpAuthPlain:
+	}
+	return smtp.PlainAuth("", transport.Username, transport.Password, transport.Host)
+}
+
+func sendMail(client *smtp.Client, from string, recipients []string, message []byte) error {
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		_ = writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+// Loads the system certificate pool extended with the certificates of the PEM file.
+func loadCertPool(caCertFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the smtp ca certificates: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caCertFile)
+	}
+	return pool, nil
+}
+
+// loginAuth implements the LOGIN authentication mechanism which is not provided by net/smtp.
+// Like smtp.PlainAuth it refuses to send the credentials over an unencrypted connection to a remote host.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (auth *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != auth.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (auth *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch string(fromServer) {
+	case "Username:", "User Name\x00":
+		return []byte(auth.username), nil
+	case "Password:", "Password\x00":
+		return []byte(auth.password), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -0,0 +1,71 @@
+package notifiers
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Starts an SMTP server which greets and accepts every command, but never acknowledges the QUIT.
+func startUnresponsiveQuitServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				text := textproto.NewConn(conn)
+				_ = text.PrintfLine("220 localhost ESMTP")
+				for {
+					line, err := text.ReadLine()
+					if err != nil {
+						return
+					}
+					if !strings.EqualFold(line, "QUIT") {
+						_ = text.PrintfLine("250 localhost")
+					}
+				}
+			}()
+		}
+	}()
+
+	return strings.TrimPrefix(listener.Addr().String(), "127.0.0.1:")
+}
+
+func TestSmtpTransport_CloseDoesNotWaitForUnresponsiveServer(t *testing.T) {
+	transport, err := newSmtpTransport(SmtpTransportConfig{
+		Host:        "127.0.0.1",
+		Port:        startUnresponsiveQuitServer(t),
+		TlsMode:     SmtpTlsNone,
+		Auth:        SmtpAuthNone,
+		QuitTimeout: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	connection, err := transport.dial(context.Background())
+	require.NoError(t, err)
+	transport.release(connection)
+
+	closed := make(chan struct{})
+	go func() {
+		_ = transport.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "closing the idle connections has waited for the QUIT of the server")
+	}
+}
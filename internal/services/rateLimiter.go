@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+)
+
+// The period and the burst of the rate limits which do not set them.
+const (
+	defaultRateLimitPeriod = time.Second
+	defaultRateLimitBurst  = 1
+)
+
+// The period of the eviction of the idle token buckets of the destinations.
+const destinationSweepInterval = time.Minute
+
+// rateLimiter holds back the sends of the delivery channels by a token bucket per channel and per destination
+// of the channel, as configured for the channel. A channel whose provider has asked to slow down with a Retry-After
+// is paused until then. The limits are kept per replica. The buckets of the destinations which are idle are evicted
+// periodically, so the buckets of the many recipients do not pile up.
+type rateLimiter struct {
+	config       *config.Config
+	lock         sync.Mutex
+	channels     map[data.DeliveryChannel]*rate.Limiter
+	destinations map[destinationKey]*rate.Limiter
+	pausedUntil  map[data.DeliveryChannel]time.Time
+	// The time of the last eviction of the idle buckets of the destinations.
+	sweptAt time.Time
+}
+
+type destinationKey struct {
+	deliveryChannel data.DeliveryChannel
+	destination     string
+}
+
+func newRateLimiter(config *config.Config) *rateLimiter {
+	return &rateLimiter{
+		config:       config,
+		channels:     make(map[data.DeliveryChannel]*rate.Limiter),
+		destinations: make(map[destinationKey]*rate.Limiter),
+		pausedUntil:  make(map[data.DeliveryChannel]time.Time),
+		sweptAt:      time.Now(),
+	}
+}
+
+// wait blocks until the notification could be sent within the rate limits of its channel and destination, and
+// the pause of its channel is over. Returns the error of the context when it is done before.
+func (limiter *rateLimiter) wait(ctx context.Context, notification *data.Notification) error {
+	if err := limiter.awaitPause(ctx, notification.DeliveryChannel); err != nil {
+		return err
+	}
+
+	// The destination is awaited first, so a send waiting for its destination does not hold a token of the channel.
+	channelLimiter, destinationLimiter := limiter.limiters(notification)
+	for _, bucket := range []*rate.Limiter{destinationLimiter, channelLimiter} {
+		if bucket == nil {
+			continue
+		}
+		if err := bucket.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pause holds back the sends of the channel for the duration. A longer pause in place is kept.
+func (limiter *rateLimiter) pause(deliveryChannel data.DeliveryChannel, duration time.Duration) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	until := time.Now().Add(duration)
+	if until.After(limiter.pausedUntil[deliveryChannel]) {
+		limiter.pausedUntil[deliveryChannel] = until
+	}
+}
+
+// Waits until the channel is not paused; the pause could be extended while waiting.
+func (limiter *rateLimiter) awaitPause(ctx context.Context, deliveryChannel data.DeliveryChannel) error {
+	for {
+		limiter.lock.Lock()
+		remaining := time.Until(limiter.pausedUntil[deliveryChannel])
+		limiter.lock.Unlock()
+		if remaining <= 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(remaining):
+		}
+	}
+}
+
+// Returns the token buckets of the channel and the destination of the notification, creating them on first use.
+// A bucket is nil when its sends are not limited.
+func (limiter *rateLimiter) limiters(notification *data.Notification) (*rate.Limiter, *rate.Limiter) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	if now := time.Now(); now.Sub(limiter.sweptAt) >= destinationSweepInterval {
+		limiter.sweepIdleDestinations(now)
+	}
+
+	deliveryChannel := notification.DeliveryChannel
+	settings := limiter.config.ChannelDelivery(string(deliveryChannel))
+
+	channelLimiter, ok := limiter.channels[deliveryChannel]
+	if !ok {
+		channelLimiter = newTokenBucket(settings.RateLimit)
+		limiter.channels[deliveryChannel] = channelLimiter
+	}
+
+	key := destinationKey{deliveryChannel: deliveryChannel, destination: notification.Recipient()}
+	destinationLimiter, ok := limiter.destinations[key]
+	if !ok {
+		destinationLimiter = newTokenBucket(settings.DestinationRateLimit)
+		limiter.destinations[key] = destinationLimiter
+	}
+	return channelLimiter, destinationLimiter
+}
+
+// Evicts the buckets of the destinations which are idle, i.e. whose buckets have refilled completely, as a new bucket
+// would hold the same tokens. The destinations without a limit are evicted too. The caller holds the lock.
+func (limiter *rateLimiter) sweepIdleDestinations(now time.Time) {
+	for key, bucket := range limiter.destinations {
+		if bucket == nil || bucket.TokensAt(now) >= float64(bucket.Burst()) {
+			delete(limiter.destinations, key)
+		}
+	}
+	limiter.sweptAt = now
+}
+
+// Returns the token bucket of the rate limit, or nil when the limit is not set.
+func newTokenBucket(limit config.RateLimit) *rate.Limiter {
+	if limit.Count <= 0 {
+		return nil
+	}
+	period := limit.Period
+	if period <= 0 {
+		period = defaultRateLimitPeriod
+	}
+	burst := limit.Burst
+	if burst <= 0 {
+		burst = defaultRateLimitBurst
+	}
+	return rate.NewLimiter(rate.Every(period/time.Duration(limit.Count)), burst)
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plyovchev/notifications-service/internal/config"
+	"github.com/plyovchev/notifications-service/internal/models/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_EvictsIdleDestinations(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Delivery.Channels = map[string]config.DeliverySettings{
+		"Slack": {DestinationRateLimit: config.RateLimit{Count: 1, Period: time.Hour}},
+	}
+	limiter := newRateLimiter(cfg)
+
+	notification := func(deliveryChannel data.DeliveryChannel, userId string, slackChannel string) *data.Notification {
+		return &data.Notification{DeliveryChannel: deliveryChannel, UserId: userId, SlackChannel: slackChannel}
+	}
+	_, busy := limiter.limiters(notification(data.Slack, "", "payments"))
+	assert.True(t, busy.Allow())
+	limiter.limiters(notification(data.Slack, "", "general"))
+	limiter.limiters(notification(data.InApp, "user-1", ""))
+	assert.Len(t, limiter.destinations, 3)
+
+	limiter.sweepIdleDestinations(time.Now().Add(destinationSweepInterval))
+
+	// Only the bucket whose token has not been refilled yet is kept.
+	assert.Equal(t, map[destinationKey]bool{{deliveryChannel: data.Slack, destination: "#payments"}: true}, keysOf(limiter.destinations))
+	_, same := limiter.limiters(notification(data.Slack, "", "payments"))
+	assert.Same(t, busy, same)
+}
+
+func keysOf[K comparable, V any](values map[K]V) map[K]bool {
+	keys := make(map[K]bool, len(values))
+	for key := range values {
+		keys[key] = true
+	}
+	return keys
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/plyovchev/notifications-service/internal/config"
@@ -38,8 +41,10 @@ func main() {
 		Str("port", serviceEnv.Port).
 		Msg("service details, starting the service")
 
-	// setup : start service
-	server.StartService(serviceEnv, cfg, lgr)
+	// setup : start service, which is shut down gracefully on SIGTERM or SIGINT
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	server.StartService(ctx, serviceEnv, cfg, lgr)
 
-	lgr.Fatal().Msg("service stopped")
+	lgr.Info().Msg("service stopped")
 }